@@ -0,0 +1,33 @@
+package server
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// SetDraining включает или выключает режим вывода из ротации: новые сессии не создаются
+// (CreateSession, BatchCreateSessions и LoginUser возвращают Unavailable), а чтение,
+// проверка токенов и отзыв продолжают работать
+func (s *Server) SetDraining(draining bool) {
+	s.draining.Store(draining)
+}
+
+// Draining сообщает, выведен ли сервер из ротации
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// checkDraining отказывает в создании сессий, пока сервер выведен из ротации.
+// Unavailable позволяет клиенту повторить запрос на другом экземпляре
+func (s *Server) checkDraining(log logger.Logger, method string) error {
+	if !s.draining.Load() {
+		return nil
+	}
+
+	log.Warn("request refused while draining",
+		"method", method,
+	)
+	return status.Error(codes.Unavailable, "server is draining, new sessions are not accepted")
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDrainingRefusesCreates(t *testing.T) {
+	e := newTestEnv(t, WithUserVerifier(newStubVerifier()))
+	ctx := context.Background()
+
+	created := e.createSession(t, "user@example.com")
+	accessToken := e.accessToken(t, "user@example.com", created.Id, time.Minute)
+
+	e.srv.SetDraining(true)
+	if !e.srv.Draining() {
+		t.Fatal("Draining = false after SetDraining(true)")
+	}
+
+	creates := map[string]func() error{
+		"CreateSession": func() error {
+			_, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com"})
+			return err
+		},
+		"BatchCreateSessions": func() error {
+			_, err := e.srv.BatchCreateSessions(ctx, &authPb.BatchCreateSessionsReq{
+				Sessions: []*authPb.SessionReq{{UserEmail: "user@example.com"}},
+			})
+			return err
+		},
+		"LoginUser": func() error {
+			_, err := e.srv.LoginUser(ctx, &authPb.LoginUserReq{Email: "user@example.com", Password: "user-password"})
+			return err
+		},
+	}
+	for name, call := range creates {
+		err := call()
+		wantCode(t, err, codes.Unavailable)
+		if !strings.Contains(status.Convert(err).Message(), "draining") {
+			t.Errorf("%s error = %v, want a draining message", name, err)
+		}
+	}
+
+	// Чтение, проверка и отзыв продолжают работать
+	if _, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Errorf("GetSession while draining: %v", err)
+	}
+	if res, err := e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: accessToken}); err != nil || res.SessionId != created.Id {
+		t.Errorf("ValidateToken while draining = %v, %v, want session %s", res, err, created.Id)
+	}
+	if res, err := e.srv.CheckSession(ctx, &authPb.CheckSessionReq{Id: created.Id}); err != nil || !res.Valid {
+		t.Errorf("CheckSession while draining = %v, %v, want valid", res, err)
+	}
+	if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Errorf("RevokeSession while draining: %v", err)
+	}
+
+	e.srv.SetDraining(false)
+	e.createSession(t, "user@example.com")
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// normalizeEmail приводит email к виду, в котором он хранится в индексе сессий:
+// без пробелов по краям и в нижнем регистре, чтобы A@x.com и a@x.com совпадали
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validEmail проверяет, что строка — голый адрес по RFC 5322, без имени
+// и угловых скобок ("Bob <bob@x.com>" не подходит)
+func validEmail(email string) bool {
+	email = strings.TrimSpace(email)
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return false
+	}
+
+	return addr.Name == "" && addr.Address == email
+}
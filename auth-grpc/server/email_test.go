@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+	"google.golang.org/grpc/codes"
+)
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"user@example.com", true},
+		{"First.Last+tag@sub.example.com", true},
+		{"  user@example.com  ", true},
+		{"not-an-email", false},
+		{"@example.com", false},
+		{"user@", false},
+		{"user@@example.com", false},
+		{"user example@example.com", false},
+		{"Bob <bob@example.com>", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := validEmail(tt.email); got != tt.want {
+			t.Errorf("validEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestCreateSessionNormalizesEmail(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	for _, email := range []string{"User@Example.COM", "user@example.com", " USER@example.com "} {
+		res := e.createSession(t, email)
+		if res.UserEmail != "user@example.com" {
+			t.Errorf("CreateSession(%q) user_email = %q, want user@example.com", email, res.UserEmail)
+		}
+	}
+
+	sessions, err := e.store.GetSessionsByEmail(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("GetSessionsByEmail: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Errorf("user index has %d sessions, want all 3 under the lowercase email", len(sessions))
+	}
+
+	// Поиск тоже нормализует email
+	count, err := e.srv.CountUserSessions(ctx, &authPb.CountUserSessionsReq{UserEmail: "USER@EXAMPLE.COM"})
+	if err != nil {
+		t.Fatalf("CountUserSessions: %v", err)
+	}
+	if count.Count != 3 {
+		t.Errorf("CountUserSessions(USER@EXAMPLE.COM) = %d, want 3", count.Count)
+	}
+
+	_, err = e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "Bob <bob@example.com>"})
+	wantCode(t, err, codes.InvalidArgument)
+}
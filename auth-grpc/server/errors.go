@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/rx3lixir/auth-service/internal/db"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain домен ошибок в ErrorInfo деталях статуса
+const errorDomain = "auth-service"
+
+// Машиночитаемые причины отказа в ErrorInfo деталях статуса
+const (
+	reasonTokenExpired    = "TOKEN_EXPIRED"
+	reasonTokenInvalid    = "TOKEN_INVALID"
+	reasonSessionNotFound = "SESSION_NOT_FOUND"
+	reasonSessionRevoked  = "SESSION_REVOKED"
+	reasonSessionExpired  = "SESSION_EXPIRED"
+)
+
+// storeErrorCode сопоставляет ошибку хранилища с gRPC кодом.
+// Все, что не является известной ошибкой хранилища, считается внутренней ошибкой
+func storeErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, db.ErrSessionNotFound):
+		return codes.NotFound
+	case errors.Is(err, db.ErrSessionRevoked):
+		return codes.FailedPrecondition
+	case errors.Is(err, db.ErrLabelTooLong), errors.Is(err, db.ErrInvalidMetadata), errors.Is(err, db.ErrInvalidExpiry),
+		errors.Is(err, db.ErrInvalidCursor):
+		return codes.InvalidArgument
+	case isTimeout(err):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	default:
+		return codes.Internal
+	}
+}
+
+// isTimeout сообщает, что операция прервана по таймауту: истек контекст
+// или сработал дедлайн соединения с Redis
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// storeError оборачивает ошибку хранилища в gRPC статус с подходящим кодом
+func storeError(err error, msg string) error {
+	return status.Errorf(storeErrorCode(err), "%s: %v", msg, err)
+}
+
+// statusWithReason создает gRPC статус с машиночитаемой причиной в деталях
+func statusWithReason(code codes.Code, reason, msg string) error {
+	st := status.New(code, msg)
+
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// invalidArgument создает статус InvalidArgument с описанием нарушенного поля запроса
+func invalidArgument(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
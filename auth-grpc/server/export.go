@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/auth-service/internal/db"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// SessionExportPath путь HTTP выгрузки сессий пользователя
+const SessionExportPath = "/admin/sessions"
+
+// Форматы выгрузки сессий
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+)
+
+// exportColumns колонки CSV выгрузки. Refresh токены, даже в виде хешей, не выгружаются
+var exportColumns = []string{
+	"id",
+	"user_email",
+	"is_revoked",
+	"revoked_reason",
+	"created_at",
+	"expires_at",
+	"last_accessed_at",
+	"ip_address",
+	"user_agent",
+	"device_name",
+	"label",
+}
+
+// exportedSession сессия в JSON выгрузке, без refresh токена
+type exportedSession struct {
+	ID             string `json:"id"`
+	UserEmail      string `json:"user_email"`
+	IsRevoked      bool   `json:"is_revoked"`
+	RevokedReason  string `json:"revoked_reason,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+	LastAccessedAt string `json:"last_accessed_at,omitempty"`
+	IPAddress      string `json:"ip_address"`
+	UserAgent      string `json:"user_agent"`
+	DeviceName     string `json:"device_name"`
+	Label          string `json:"label,omitempty"`
+}
+
+// SessionExportHandler обрабатывает GET /admin/sessions?email=... и выгружает активные
+// сессии пользователя в JSON или CSV. Формат задается параметром format (json | csv),
+// иначе выбирается по заголовку Accept. Доступ только с API ключом в заголовке X-Api-Key
+func SessionExportHandler(store db.SessionStorage, apiKey string, log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Без настроенного ключа выгрузка закрыта полностью
+		key := r.Header.Get(apiKeyHeader)
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+
+		email := normalizeEmail(r.URL.Query().Get("email"))
+		if email == "" {
+			http.Error(w, "email is required", http.StatusBadRequest)
+			return
+		}
+
+		format, ok := exportFormat(r)
+		if !ok {
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+			return
+		}
+
+		sessions, err := store.GetSessionsByEmail(r.Context(), email)
+		if err != nil {
+			log.Error("failed to export sessions",
+				"user_email", email,
+				"error", err,
+			)
+			http.Error(w, "failed to get sessions", http.StatusInternalServerError)
+			return
+		}
+
+		if format == exportFormatCSV {
+			writeSessionsCSV(w, sessions)
+			return
+		}
+		writeSessionsJSON(w, sessions)
+	})
+}
+
+// exportFormat выбирает формат выгрузки: параметр format важнее заголовка Accept
+func exportFormat(r *http.Request) (string, bool) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case exportFormatJSON, exportFormatCSV:
+		return format, true
+	case "":
+	default:
+		return "", false
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		return exportFormatCSV, true
+	}
+	return exportFormatJSON, true
+}
+
+// writeSessionsCSV пишет сессии построчно с заголовком из exportColumns
+func writeSessionsCSV(w http.ResponseWriter, sessions []*db.Session) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="sessions.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+
+	for _, session := range sessions {
+		e := exportSession(session)
+		cw.Write([]string{
+			e.ID,
+			e.UserEmail,
+			strconv.FormatBool(e.IsRevoked),
+			e.RevokedReason,
+			e.CreatedAt,
+			e.ExpiresAt,
+			e.LastAccessedAt,
+			e.IPAddress,
+			e.UserAgent,
+			e.DeviceName,
+			e.Label,
+		})
+	}
+
+	cw.Flush()
+}
+
+// writeSessionsJSON пишет сессии JSON массивом
+func writeSessionsJSON(w http.ResponseWriter, sessions []*db.Session) {
+	exported := make([]exportedSession, len(sessions))
+	for i, session := range sessions {
+		exported[i] = exportSession(session)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="sessions.json"`)
+	json.NewEncoder(w).Encode(exported)
+}
+
+// exportSession переводит сессию в запись выгрузки. Время в UTC, RFC3339
+func exportSession(session *db.Session) exportedSession {
+	e := exportedSession{
+		ID:            session.Id,
+		UserEmail:     session.UserEmail,
+		IsRevoked:     session.IsRevoked,
+		RevokedReason: string(session.RevokedReason),
+		CreatedAt:     session.CreatedAt.UTC().Format(time.RFC3339),
+		ExpiresAt:     session.ExpiresAt.UTC().Format(time.RFC3339),
+		IPAddress:     session.IPAddress,
+		UserAgent:     session.UserAgent,
+		DeviceName:    session.DeviceName,
+		Label:         session.Label,
+	}
+
+	if !session.LastAccessedAt.IsZero() {
+		e.LastAccessedAt = session.LastAccessedAt.UTC().Format(time.RFC3339)
+	}
+
+	return e
+}
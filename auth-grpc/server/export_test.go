@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionExportHandler(t *testing.T) {
+	e := newTestEnv(t)
+	created := e.createSession(t, "user@example.com")
+	e.createSession(t, "user@example.com")
+
+	stored, err := e.store.GetSession(context.Background(), created.Id)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	secrets := []string{created.RefreshToken, stored.RefreshToken}
+
+	handler := SessionExportHandler(e.store, "admin-key", nopLogger{})
+	export := func(t *testing.T, query, accept, key string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, SessionExportPath+"?"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	wantRedacted := func(t *testing.T, body string) {
+		t.Helper()
+		for _, secret := range secrets {
+			if strings.Contains(body, secret) {
+				t.Errorf("export contains a refresh token: %s", body)
+			}
+		}
+		if strings.Contains(strings.ToLower(body), "refresh") {
+			t.Errorf("export mentions refresh tokens: %s", body)
+		}
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		for _, rec := range []*httptest.ResponseRecorder{
+			export(t, "email=User@Example.com&format=csv", "", "admin-key"),
+			export(t, "email=user@example.com", "text/csv", "admin-key"),
+		} {
+			if rec.Code != http.StatusOK {
+				t.Fatalf("export = %d: %s", rec.Code, rec.Body)
+			}
+
+			rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+			if err != nil {
+				t.Fatalf("parse CSV: %v", err)
+			}
+			if len(rows) != 3 {
+				t.Fatalf("CSV has %d rows, want a header and 2 sessions", len(rows))
+			}
+			if got := strings.Join(rows[0], ","); got != strings.Join(exportColumns, ",") {
+				t.Errorf("CSV header = %s, want %s", got, strings.Join(exportColumns, ","))
+			}
+			wantRedacted(t, rec.Body.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rec := export(t, "email=user@example.com", "", "admin-key")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("export = %d: %s", rec.Code, rec.Body)
+		}
+
+		var sessions []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+			t.Fatalf("decode JSON: %v: %s", err, rec.Body)
+		}
+		if len(sessions) != 2 {
+			t.Errorf("JSON has %d sessions, want 2", len(sessions))
+		}
+		wantRedacted(t, rec.Body.String())
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tests := []struct {
+			query, key string
+			want       int
+		}{
+			{"email=user@example.com", "", http.StatusUnauthorized},
+			{"email=user@example.com", "wrong", http.StatusUnauthorized},
+			{"", "admin-key", http.StatusBadRequest},
+			{"email=user@example.com&format=xml", "admin-key", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if rec := export(t, tt.query, "", tt.key); rec.Code != tt.want {
+				t.Errorf("export %q with key %q = %d, want %d", tt.query, tt.key, rec.Code, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// requestIDHeader имя metadata заголовка с ID запроса
+const requestIDHeader = "x-request-id"
+
+// RequestIDInterceptor кладет в контекст ID запроса: берет его из metadata x-request-id
+// или генерирует новый. ID возвращается клиенту в заголовке ответа
+func RequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var requestID string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(requestIDHeader); len(ids) > 0 {
+				requestID = ids[0]
+			}
+		}
+
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+
+		// Ошибка возможна только вне gRPC вызова, ID в заголовке не критичен
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID))
+
+		return handler(logger.WithRequestID(ctx, requestID), req)
+	}
+}
+
+// newRequestID генерирует случайный ID запроса
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// LoggingInterceptor логирует каждый unary вызов: метод, длительность, код ответа и адрес клиента
+func LoggingInterceptor(log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		log := logger.WithContext(ctx, log)
+
+		code := status.Code(err)
+		fields := []any{
+			"method", info.FullMethod,
+			"duration", time.Since(start),
+			"code", code.String(),
+			"peer", peerAddr(ctx),
+		}
+
+		if err != nil {
+			log.Error("rpc failed", append(fields, "error", err)...)
+		} else {
+			log.Info("rpc completed", fields...)
+		}
+
+		return resp, err
+	}
+}
+
+// RPCObserver записывает длительность вызовов (реализуется metrics.Metrics)
+type RPCObserver interface {
+	ObserveRPC(method, code string, duration time.Duration)
+}
+
+// MetricsInterceptor записывает длительность каждого unary вызова по методу и коду ответа
+func MetricsInterceptor(observer RPCObserver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		observer.ObserveRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return resp, err
+	}
+}
+
+// MetricsStreamInterceptor аналог MetricsInterceptor для потоковых вызовов;
+// длительность считается до закрытия потока
+func MetricsStreamInterceptor(observer RPCObserver) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		observer.ObserveRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return err
+	}
+}
+
+// RecoveryInterceptor перехватывает панику в обработчике и возвращает клиенту codes.Internal,
+// не роняя процесс
+func RecoveryInterceptor(log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.WithContext(ctx, log).Error("panic recovered in rpc handler",
+					"method", info.FullMethod,
+					"panic", r,
+					"stack", string(debug.Stack()),
+				)
+				resp = nil
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// DefaultDeadlineInterceptor ограничивает по времени вызовы, пришедшие без дедлайна:
+// контекст получает дедлайн timeout. Дедлайн клиента, даже более длинный,
+// не меняется. Потоковые вызовы не ограничиваются: они открыты долго намеренно
+func DefaultDeadlineInterceptor(timeout time.Duration, log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := ctx.Deadline(); ok {
+			return handler(ctx, req)
+		}
+
+		logger.WithContext(ctx, log).Debug("default deadline applied",
+			"method", info.FullMethod,
+			"timeout", timeout,
+		)
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitInterceptor ограничивает частоту вызовов для каждого клиента по его IP адресу
+func RateLimitInterceptor(limiter *RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !limiter.Allow(peerIP(ctx)) {
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// apiKeyHeader имя metadata заголовка с API ключом
+const apiKeyHeader = "x-api-key"
+
+// APIKeyInterceptor пропускает только вызовы с корректным API ключом в metadata x-api-key.
+// Методы из exemptMethods (полные имена, например "/grpc.health.v1.Health/Check")
+// доступны без ключа
+func APIKeyInterceptor(apiKey string, exemptMethods ...string) grpc.UnaryServerInterceptor {
+	exempt := methodSet(exemptMethods)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := exempt[info.FullMethod]; ok {
+			return handler(ctx, req)
+		}
+
+		if err := checkAPIKey(ctx, apiKey); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// APIKeyStreamInterceptor аналог APIKeyInterceptor для потоковых вызовов
+func APIKeyStreamInterceptor(apiKey string, exemptMethods ...string) grpc.StreamServerInterceptor {
+	exempt := methodSet(exemptMethods)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := exempt[info.FullMethod]; ok {
+			return handler(srv, ss)
+		}
+
+		if err := checkAPIKey(ss.Context(), apiKey); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// checkAPIKey проверяет API ключ из metadata x-api-key
+func checkAPIKey(ctx context.Context, apiKey string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(apiKeyHeader)
+	if len(keys) == 0 || keys[0] == "" {
+		return status.Error(codes.Unauthenticated, "api key is required")
+	}
+
+	// Сравнение за постоянное время, чтобы не раскрывать ключ через тайминги
+	if subtle.ConstantTimeCompare([]byte(keys[0]), []byte(apiKey)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid api key")
+	}
+
+	return nil
+}
+
+// methodSet собирает множество полных имен методов
+func methodSet(methods []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		set[method] = struct{}{}
+	}
+	return set
+}
+
+// peerIP возвращает IP адрес клиента без порта
+func peerIP(ctx context.Context) string {
+	addr := peerAddr(ctx)
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// peerAddr возвращает адрес клиента из контекста вызова
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	return p.Addr.String()
+}
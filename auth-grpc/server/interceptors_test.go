@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/rx3lixir/auth-service/pkg/metrics"
+)
+
+// unaryInfo описание вызова для unary интерсепторов
+var unaryInfo = &grpc.UnaryServerInfo{FullMethod: "/auth.AuthService/GetSession"}
+
+// okHandler обработчик, который всегда отвечает успешно
+func okHandler(ctx context.Context, req any) (any, error) {
+	return "ok", nil
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	interceptor := RecoveryInterceptor(nopLogger{})
+
+	resp, err := interceptor(context.Background(), nil, unaryInfo, func(ctx context.Context, req any) (any, error) {
+		panic("nil map write")
+	})
+	wantCode(t, err, codes.Internal)
+	if resp != nil {
+		t.Errorf("response after panic = %v, want nil", resp)
+	}
+
+	if resp, err := interceptor(context.Background(), nil, unaryInfo, okHandler); err != nil || resp != "ok" {
+		t.Errorf("interceptor without panic = %v, %v, want ok", resp, err)
+	}
+}
+
+// peerContext контекст вызова от клиента с адресом addr
+func peerContext(addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	interceptor := RateLimitInterceptor(NewRateLimiter(1, 3, time.Minute))
+	client := peerContext("10.0.0.1:5000")
+
+	for i := 0; i < 3; i++ {
+		if _, err := interceptor(client, nil, unaryInfo, okHandler); err != nil {
+			t.Fatalf("call %d within burst: %v", i+1, err)
+		}
+	}
+
+	_, err := interceptor(client, nil, unaryInfo, okHandler)
+	wantCode(t, err, codes.ResourceExhausted)
+
+	// Лимит считается по IP: другой порт того же клиента не получает новый запас
+	_, err = interceptor(peerContext("10.0.0.1:5001"), nil, unaryInfo, okHandler)
+	wantCode(t, err, codes.ResourceExhausted)
+
+	if _, err := interceptor(peerContext("10.0.0.2:5000"), nil, unaryInfo, okHandler); err != nil {
+		t.Errorf("call from another client: %v", err)
+	}
+}
+
+func TestDefaultDeadlineInterceptor(t *testing.T) {
+	interceptor := DefaultDeadlineInterceptor(time.Second, nopLogger{})
+
+	var handlerCtx context.Context
+	handler := func(ctx context.Context, req any) (any, error) {
+		handlerCtx = ctx
+		return "ok", nil
+	}
+
+	start := time.Now()
+	if _, err := interceptor(context.Background(), nil, unaryInfo, handler); err != nil {
+		t.Fatalf("call without deadline: %v", err)
+	}
+	end := time.Now()
+	deadline, ok := handlerCtx.Deadline()
+	if !ok {
+		t.Fatal("handler context has no deadline")
+	}
+	if deadline.Before(start.Add(time.Second)) || deadline.After(end.Add(time.Second)) {
+		t.Errorf("deadline = %s, want 1s after the call started at %s", deadline, start)
+	}
+	// Контекст с дедлайном по умолчанию освобождается после ответа
+	if handlerCtx.Err() == nil {
+		t.Error("default deadline context is not released after the call")
+	}
+
+	// Дедлайн клиента, даже более длинный, остается как есть
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	if _, err := interceptor(ctx, nil, unaryInfo, handler); err != nil {
+		t.Fatalf("call with deadline: %v", err)
+	}
+	if got, _ := handlerCtx.Deadline(); !got.Equal(want) {
+		t.Errorf("deadline = %s, want the client deadline %s", got, want)
+	}
+}
+
+// contextStream серверный поток, у которого задан только контекст
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context { return s.ctx }
+
+func TestAPIKeyInterceptors(t *testing.T) {
+	const healthMethod = "/grpc.health.v1.Health/Check"
+
+	unary := APIKeyInterceptor("service-key", healthMethod)
+	stream := APIKeyStreamInterceptor("service-key", healthMethod)
+
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		method string
+		want   codes.Code
+	}{
+		{"valid key", metadata.Pairs(apiKeyHeader, "service-key"), "/auth.AuthService/GetSession", codes.OK},
+		{"invalid key", metadata.Pairs(apiKeyHeader, "other-key"), "/auth.AuthService/GetSession", codes.Unauthenticated},
+		{"empty key", metadata.Pairs(apiKeyHeader, ""), "/auth.AuthService/GetSession", codes.Unauthenticated},
+		{"missing key", nil, "/auth.AuthService/GetSession", codes.Unauthenticated},
+		{"exempt method", nil, healthMethod, codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, okHandler)
+			wantCode(t, err, tt.want)
+
+			called := false
+			err = stream(nil, contextStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, func(srv any, ss grpc.ServerStream) error {
+				called = true
+				return nil
+			})
+			wantCode(t, err, tt.want)
+			if called != (tt.want == codes.OK) {
+				t.Errorf("stream handler called = %v, want %v", called, tt.want == codes.OK)
+			}
+		})
+	}
+}
+
+func TestMetricsInterceptors(t *testing.T) {
+	m := metrics.New(metrics.WithRPCBuckets(0.01, 0.5))
+	unary := MetricsInterceptor(m)
+	stream := MetricsStreamInterceptor(m)
+
+	for i := 0; i < 2; i++ {
+		if _, err := unary(context.Background(), nil, unaryInfo, okHandler); err != nil {
+			t.Fatalf("unary call: %v", err)
+		}
+	}
+	unary(context.Background(), nil, unaryInfo, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "session not found")
+	})
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/auth.AuthService/WatchUserSessions", IsServerStream: true}
+	stream(nil, contextStream{ctx: context.Background()}, streamInfo, func(srv any, ss grpc.ServerStream) error {
+		return status.Error(codes.Canceled, "client went away")
+	})
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`auth_service_rpc_duration_seconds_count{code="OK",method="/auth.AuthService/GetSession"} 2`,
+		`auth_service_rpc_duration_seconds_count{code="NotFound",method="/auth.AuthService/GetSession"} 1`,
+		`auth_service_rpc_duration_seconds_count{code="Canceled",method="/auth.AuthService/WatchUserSessions"} 1`,
+		`auth_service_rpc_duration_seconds_bucket{code="OK",method="/auth.AuthService/GetSession",le="0.01"} 2`,
+		`auth_service_rpc_duration_seconds_bucket{code="OK",method="/auth.AuthService/GetSession",le="0.5"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
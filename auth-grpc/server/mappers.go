@@ -1,6 +1,7 @@
 package server
 
 import (
+	"maps"
 	"time"
 
 	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
@@ -8,21 +9,131 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// ConvertSessionToProto преобразует внутреннюю модель Session в protobuf SessionRes
-func ConvertSessionToProto(session *db.Session) *authPb.SessionRes {
+// ConvertSessionToProto преобразует внутреннюю модель Session в protobuf SessionRes.
+// Refresh токен в ответ не попадает: его получает только создатель сессии.
+// ExpiresInSeconds считается от now. Обратное преобразование — ConvertProtoResToSession
+func ConvertSessionToProto(session *db.Session, now time.Time) *authPb.SessionRes {
 	if session == nil {
 		return nil
 	}
 
 	return &authPb.SessionRes{
-		Id:           session.Id,
-		UserEmail:    session.UserEmail,
-		RefreshToken: session.RefreshToken,
-		IsRevoked:    session.IsRevoked,
-		ExpiresAt:    timestamppb.New(session.ExpiresAt),
+		Id:               session.Id,
+		UserEmail:        session.UserEmail,
+		IsRevoked:        session.IsRevoked,
+		ExpiresAt:        timestampOrNil(session.ExpiresAt),
+		IpAddress:        session.IPAddress,
+		UserAgent:        session.UserAgent,
+		DeviceName:       session.DeviceName,
+		Label:            session.Label,
+		ExpiresInSeconds: expiresInSeconds(session.ExpiresAt, now),
+		RevokedReason:    revokeReasonToProto(session.RevokedReason),
+		Metadata:         maps.Clone(session.Metadata),
+		Impersonated:     session.Impersonated,
+		ImpersonatedBy:   session.ImpersonatedBy,
+		CreatedAt:        timestampOrNil(session.CreatedAt),
+		LastAccessedAt:   timestampOrNil(session.LastAccessedAt),
 	}
 }
 
+// ConvertProtoResToSession восстанавливает Session из SessionRes, например на стороне
+// клиента или для проверки ConvertSessionToProto. Сохраняются все поля, кроме:
+//   - RefreshToken — его нет в SessionRes (есть только в ответах на создание);
+//   - IsAdmin — права администратора клиентам не передаются;
+//   - часового пояса — время возвращается в UTC, момент времени не меняется;
+//   - неизвестной причины отзыва — она становится RevokeReasonUnspecified.
+//
+// ExpiresInSeconds вычисляется из ExpiresAt и при обратном преобразовании не нужен
+func ConvertProtoResToSession(res *authPb.SessionRes) *db.Session {
+	if res == nil {
+		return nil
+	}
+
+	session := &db.Session{
+		Id:             res.Id,
+		UserEmail:      res.UserEmail,
+		RefreshToken:   res.RefreshToken,
+		IsRevoked:      res.IsRevoked,
+		CreatedAt:      timeOrZero(res.CreatedAt),
+		ExpiresAt:      timeOrZero(res.ExpiresAt),
+		LastAccessedAt: timeOrZero(res.LastAccessedAt),
+		IPAddress:      res.IpAddress,
+		UserAgent:      res.UserAgent,
+		DeviceName:     res.DeviceName,
+		Label:          res.Label,
+		Metadata:       maps.Clone(res.Metadata),
+		Impersonated:   res.Impersonated,
+		ImpersonatedBy: res.ImpersonatedBy,
+	}
+
+	// Причина хранится только у отозванных сессий
+	if res.IsRevoked {
+		session.RevokedReason = ConvertProtoToRevokeReason(res.RevokedReason)
+	}
+
+	return session
+}
+
+// timestampOrNil переводит время в Timestamp; нулевое время не передается вовсе,
+// чтобы клиент не получил 0001-01-01 вместо "не задано"
+func timestampOrNil(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timeOrZero переводит Timestamp во время UTC; nil = нулевое время
+func timeOrZero(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// ConvertCreatedSessionToProto аналог ConvertSessionToProto для ответов на создание
+// сессии: включает сырой refresh токен, который больше нигде не возвращается
+func ConvertCreatedSessionToProto(session *db.Session, now time.Time) *authPb.SessionRes {
+	res := ConvertSessionToProto(session, now)
+	if res != nil {
+		res.RefreshToken = session.RefreshToken
+	}
+	return res
+}
+
+// revokeReasonsToProto соответствие причин отзыва хранилища и proto
+var revokeReasonsToProto = map[db.RevokeReason]authPb.RevokeReason{
+	db.RevokeReasonUnspecified:    authPb.RevokeReason_REVOKE_REASON_UNSPECIFIED,
+	db.RevokeReasonLogout:         authPb.RevokeReason_REVOKE_REASON_LOGOUT,
+	db.RevokeReasonPasswordChange: authPb.RevokeReason_REVOKE_REASON_PASSWORD_CHANGE,
+	db.RevokeReasonAdmin:          authPb.RevokeReason_REVOKE_REASON_ADMIN,
+	db.RevokeReasonCompromised:    authPb.RevokeReason_REVOKE_REASON_COMPROMISED,
+}
+
+// revokeReasonToProto переводит причину отзыва в proto; неизвестные причины — UNSPECIFIED
+func revokeReasonToProto(reason db.RevokeReason) authPb.RevokeReason {
+	return revokeReasonsToProto[reason]
+}
+
+// ConvertProtoToRevokeReason переводит причину отзыва из proto
+func ConvertProtoToRevokeReason(reason authPb.RevokeReason) db.RevokeReason {
+	for dbReason, pbReason := range revokeReasonsToProto {
+		if pbReason == reason {
+			return dbReason
+		}
+	}
+	return db.RevokeReasonUnspecified
+}
+
+// expiresInSeconds возвращает оставшееся от now до expiresAt время в секундах, не меньше нуля
+func expiresInSeconds(expiresAt, now time.Time) int64 {
+	remaining := expiresAt.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return int64(remaining / time.Second)
+}
+
 // ConvertProtoToSession преобразует protobuf SessionReq во внутреннюю модель Session
 func ConvertProtoToSession(sessionReq *authPb.SessionReq) *db.Session {
 	if sessionReq == nil {
@@ -40,5 +151,65 @@ func ConvertProtoToSession(sessionReq *authPb.SessionReq) *db.Session {
 		RefreshToken: sessionReq.RefreshToken,
 		IsRevoked:    sessionReq.IsRevoked,
 		ExpiresAt:    expiresAt,
+		IPAddress:    sessionReq.IpAddress,
+		UserAgent:    sessionReq.UserAgent,
+		DeviceName:   sessionReq.DeviceName,
+		Label:        sessionReq.Label,
+		Metadata:     maps.Clone(sessionReq.Metadata),
+	}
+}
+
+// ConvertProtoToRenewAccessTokenReq преобразует protobuf RenewAccessTokenReq во внутреннюю модель
+func ConvertProtoToRenewAccessTokenReq(req *authPb.RenewAccessTokenReq) *db.RenewAccessTokenReq {
+	if req == nil {
+		return nil
+	}
+
+	return &db.RenewAccessTokenReq{
+		SessionId:          req.SessionId,
+		RefreshToken:       req.RefreshToken,
+		RotateRefreshToken: req.RotateRefreshToken,
+	}
+}
+
+// ConvertRenewAccessTokenResToProto преобразует внутреннюю модель RenewAccessTokenRes в protobuf
+func ConvertRenewAccessTokenResToProto(res *db.RenewAccessTokenRes) *authPb.RenewAccessTokenRes {
+	if res == nil {
+		return nil
+	}
+
+	return &authPb.RenewAccessTokenRes{
+		AccessToken:          res.AccessToken,
+		AccessTokenExpiresAt: timestamppb.New(res.AccessTokenExpiresAt),
+		RefreshToken:         res.RefreshToken,
+	}
+}
+
+// ConvertLoginUserResToProto преобразует внутреннюю модель LoginUserRes в protobuf
+func ConvertLoginUserResToProto(res *db.LoginUserRes) *authPb.LoginUserRes {
+	if res == nil {
+		return nil
+	}
+
+	return &authPb.LoginUserRes{
+		SessionId:             res.SessionId,
+		AccessToken:           res.AccessToken,
+		RefreshToken:          res.RefreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(res.AccessTokenExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(res.RefreshTokenExpiresAt),
+		User: &authPb.UserRes{
+			Name:    res.User.Name,
+			Email:   res.User.Email,
+			IsAdmin: res.User.IsAdmin,
+		},
+	}
+}
+
+// ConvertStatsToProto преобразует счетчики сессий в protobuf GetStatsRes
+func ConvertStatsToProto(stats *db.SessionStats) *authPb.GetStatsRes {
+	return &authPb.GetStatsRes{
+		ActiveSessions: stats.ActiveSessions,
+		UniqueUsers:    stats.UniqueUsers,
+		SnapshotTime:   timestamppb.New(stats.SnapshotTime),
 	}
 }
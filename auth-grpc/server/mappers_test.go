@@ -0,0 +1,142 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+	"github.com/rx3lixir/auth-service/internal/db"
+)
+
+// fuzzTime время из произвольных чисел в диапазоне, который представим Timestamp;
+// sec == 0 дает нулевое время
+func fuzzTime(sec, nsec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	const maxSec = 253402300799 // 9999-12-31T23:59:59Z
+	sec %= maxSec
+	if sec < 0 {
+		sec = -sec
+	}
+	nsec %= int64(time.Second)
+	if nsec < 0 {
+		nsec = -nsec
+	}
+	return time.Unix(sec, nsec).UTC()
+}
+
+var fuzzRevokeReasons = []db.RevokeReason{
+	db.RevokeReasonUnspecified,
+	db.RevokeReasonLogout,
+	db.RevokeReasonPasswordChange,
+	db.RevokeReasonAdmin,
+	db.RevokeReasonCompromised,
+}
+
+func FuzzSessionRoundTrip(f *testing.F) {
+	f.Add("s1", "user@example.com", "refresh", true, uint8(1), int64(1735732800), int64(0), int64(1736337600), int64(500), int64(0), int64(0),
+		"10.0.0.1", "curl/8.0", "laptop", "work", "tenant", "acme", false, "")
+	f.Add("", "", "", false, uint8(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0),
+		"", "", "", "", "", "", true, "admin@example.com")
+
+	f.Fuzz(func(t *testing.T, id, email, refreshToken string, revoked bool, reasonIdx uint8,
+		createdSec, createdNsec, expiresSec, expiresNsec, accessedSec, accessedNsec int64,
+		ip, userAgent, device, label, metaKey, metaValue string, impersonated bool, impersonatedBy string,
+	) {
+		for _, s := range []string{id, email, refreshToken, ip, userAgent, device, label, metaKey, metaValue, impersonatedBy} {
+			if !utf8.ValidString(s) {
+				t.Skip("proto strings must be valid UTF-8")
+			}
+		}
+
+		session := &db.Session{
+			Id:             id,
+			UserEmail:      email,
+			RefreshToken:   refreshToken,
+			IsRevoked:      revoked,
+			CreatedAt:      fuzzTime(createdSec, createdNsec),
+			ExpiresAt:      fuzzTime(expiresSec, expiresNsec),
+			LastAccessedAt: fuzzTime(accessedSec, accessedNsec),
+			IPAddress:      ip,
+			UserAgent:      userAgent,
+			DeviceName:     device,
+			Label:          label,
+			Impersonated:   impersonated,
+			ImpersonatedBy: impersonatedBy,
+		}
+		if revoked {
+			session.RevokedReason = fuzzRevokeReasons[int(reasonIdx)%len(fuzzRevokeReasons)]
+		}
+		if metaKey != "" || metaValue != "" {
+			session.Metadata = map[string]string{metaKey: metaValue}
+		}
+
+		res := ConvertCreatedSessionToProto(session, time.Unix(1735732800, 0))
+		for name, ts := range map[string]interface{ IsValid() bool }{
+			"expires_at": res.ExpiresAt, "created_at": res.CreatedAt, "last_accessed_at": res.LastAccessedAt,
+		} {
+			if reflect.ValueOf(ts).IsNil() {
+				continue
+			}
+			if !ts.IsValid() {
+				t.Fatalf("%s is not a valid timestamp", name)
+			}
+		}
+
+		// Через wire формат, как на стороне клиента
+		data, err := proto.Marshal(res)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var decoded authPb.SessionRes
+		if err := proto.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+
+		got := ConvertProtoResToSession(&decoded)
+		if !reflect.DeepEqual(got, session) {
+			t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, session)
+		}
+	})
+}
+
+func TestConvertSessionToProtoOmitsZeroTimes(t *testing.T) {
+	res := ConvertSessionToProto(&db.Session{Id: "s1"}, time.Now())
+
+	if res.ExpiresAt != nil || res.CreatedAt != nil || res.LastAccessedAt != nil {
+		t.Errorf("zero times = %v, %v, %v, want all nil", res.ExpiresAt, res.CreatedAt, res.LastAccessedAt)
+	}
+	if res.ExpiresInSeconds != 0 {
+		t.Errorf("expires_in_seconds = %d, want 0", res.ExpiresInSeconds)
+	}
+}
+
+func TestConvertSessionToProtoExpiresInSeconds(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      int64
+	}{
+		{"active", now.Add(90 * time.Minute), 5400},
+		{"partial second", now.Add(10*time.Second + 900*time.Millisecond), 10},
+		{"expires now", now, 0},
+		{"expired", now.Add(-time.Hour), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ConvertSessionToProto(&db.Session{Id: "s1", ExpiresAt: tt.expiresAt}, now)
+			if res.ExpiresInSeconds != tt.want {
+				t.Errorf("expires_in_seconds = %d, want %d", res.ExpiresInSeconds, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rx3lixir/auth-service/internal/db"
+)
+
+// Metrics счетчики событий жизненного цикла сессий
+type Metrics interface {
+	SessionCreated()
+	SessionsRevoked(count int)
+	SessionDeleted()
+}
+
+// noopMetrics используется, когда метрики не подключены
+type noopMetrics struct{}
+
+func (noopMetrics) SessionCreated()     {}
+func (noopMetrics) SessionsRevoked(int) {}
+func (noopMetrics) SessionDeleted()     {}
+
+// UserVerifier проверяет учетные данные пользователя во внешнем сервисе пользователей
+type UserVerifier interface {
+	// VerifyCredentials возвращает пользователя или ErrInvalidCredentials при неверных данных
+	VerifyCredentials(ctx context.Context, email, password string) (*db.GetUserRes, error)
+}
+
+// ErrInvalidCredentials возвращается UserVerifier при неверном email или пароле
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Option функция для настройки gRPC сервера
+type Option func(*Server)
+
+// WithMetrics подключает сбор метрик по сессиям
+func WithMetrics(metrics Metrics) Option {
+	return func(s *Server) {
+		s.metrics = metrics
+	}
+}
+
+// WithAuditLogger заменяет журнал аудита, по умолчанию записи пишутся в лог сервиса
+func WithAuditLogger(audit AuditLogger) Option {
+	return func(s *Server) {
+		s.audit = audit
+	}
+}
+
+// WithClock подменяет источник времени для TTL сессий и проверок истечения.
+// Хранилищу нужно передать те же часы через db.WithClock
+func WithClock(clock db.Clock) Option {
+	return func(s *Server) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+// WithUserVerifier подключает проверку учетных данных для LoginUser
+func WithUserVerifier(verifier UserVerifier) Option {
+	return func(s *Server) {
+		s.userVerifier = verifier
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// peerLimiter лимитер одного клиента и время его последнего обращения
+type peerLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter хранит token-bucket лимитеры по ключу клиента.
+// Лимитеры, не использовавшиеся дольше idleTTL, периодически удаляются
+type RateLimiter struct {
+	mu        sync.Mutex
+	limiters  map[string]*peerLimiter
+	limit     rate.Limit
+	burst     int
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+// NewRateLimiter создает лимитер на rps запросов в секунду с допустимым всплеском burst
+func NewRateLimiter(rps, burst int, idleTTL time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limiters:  make(map[string]*peerLimiter),
+		limit:     rate.Limit(rps),
+		burst:     burst,
+		idleTTL:   idleTTL,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow сообщает, можно ли выполнить запрос клиента с ключом key прямо сейчас
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	pl, ok := l.limiters[key]
+	if !ok {
+		pl = &peerLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = pl
+	}
+	pl.lastSeen = now
+
+	return pl.limiter.AllowN(now, 1)
+}
+
+// sweep удаляет простаивающие лимитеры не чаще одного раза за idleTTL.
+// Вызывается под мьютексом
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+
+	for key, pl := range l.limiters {
+		if now.Sub(pl.lastSeen) >= l.idleTTL {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
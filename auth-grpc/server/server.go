@@ -2,239 +2,1640 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
 	"github.com/rx3lixir/auth-service/internal/config"
 	"github.com/rx3lixir/auth-service/internal/db"
+	"github.com/rx3lixir/auth-service/internal/token"
 	"github.com/rx3lixir/auth-service/pkg/logger"
 )
 
+// maxBatchSize максимальное количество элементов в batch запросах
+const maxBatchSize = 100
+
+// impersonationTTL наибольшее время жизни сессии ImpersonateUser, независимо от настроек TTL
+const impersonationTTL = 15 * time.Minute
+
+// Границы ttl_seconds в BlacklistToken: токен не может пережить сессию
+const (
+	minBlacklistTokenTTL = time.Minute
+	maxBlacklistTokenTTL = db.MaxSessionLifetime
+)
+
+// statsCacheTTL сколько GetStats отдает сохраненный подсчет: полный обход индексов дорогой
+const statsCacheTTL = 30 * time.Second
+
+// Размеры страницы ListUserSessions
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type Server struct {
-	storer *db.RedisStore
+	storer db.SessionStorage
 	authPb.UnsafeAuthServiceServer
-	log  logger.Logger
-	conf *config.AppConfig
+	tokenMaker token.Maker
+	log        logger.Logger
+	conf       atomic.Pointer[config.AppConfig] // Меняется при перезагрузке конфигурации
+	metrics    Metrics
+	audit      AuditLogger
+	clock      db.Clock
+
+	userVerifier UserVerifier // nil = LoginUser недоступен
+
+	draining atomic.Bool // Новые сессии не создаются, см. SetDraining
+
+	statsMu    sync.Mutex // Один подсчет GetStats одновременно
+	statsCache *db.SessionStats
 }
 
-func NewServer(storer *db.RedisStore, log logger.Logger, config *config.AppConfig) *Server {
-	return &Server{
-		storer: storer,
-		log:    log,
-		conf:   config,
+func NewServer(storer db.SessionStorage, tokenMaker token.Maker, log logger.Logger, config *config.AppConfig, opts ...Option) *Server {
+	s := &Server{
+		storer:     storer,
+		tokenMaker: tokenMaker,
+		log:        log,
+		metrics:    noopMetrics{},
+		audit:      NewLogAuditLogger(log),
+		clock:      db.SystemClock{},
+	}
+	s.conf.Store(config)
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// SetConfig заменяет конфигурацию сервера; безопасно вызывать во время обработки запросов
+func (s *Server) SetConfig(config *config.AppConfig) {
+	s.conf.Store(config)
 }
 
 // CreateSession создает новую сессию
 func (s *Server) CreateSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
-	s.log.Info("starting create session",
-		"method", "CreateSession",
-		"user_email", req.UserEmail,
-		"session_id", req.Id,
-	)
-
-	session := ConvertProtoToSession(req)
+	log := logger.WithContext(ctx, s.log)
 
-	if session.UserEmail == "" {
-		s.log.Error("missing required field",
-			"method", "CreateSession",
-			"missing_field", "user_email",
-		)
-		return nil, status.Error(codes.InvalidArgument, "user_email is required")
+	if err := s.checkDraining(log, "CreateSession"); err != nil {
+		return nil, err
 	}
 
-	if session.Id == "" {
-		s.log.Error("missing required field",
-			"method", "CreateSession",
-			"missing_field", "session_id",
-		)
-		return nil, status.Error(codes.InvalidArgument, "id is required")
+	session, err := s.prepareSession(log, "CreateSession", req)
+	if err != nil {
+		return nil, err
 	}
 
-	// Устанавливаем время истечения из конфигурации
-	session.ExpiresAt = time.Now().Add(s.conf.Service.GetSessionTTL())
+	if err := s.checkCreateRateLimit(ctx, log, "CreateSession", session.UserEmail); err != nil {
+		return nil, err
+	}
 
 	createdSession, err := s.storer.CreateSession(ctx, session)
 	if err != nil {
-		s.log.Error("failed to create session",
+		log.Error("failed to create session",
 			"method", "CreateSession",
 			"error", err,
 			"user_email", req.UserEmail,
 			"session_id", req.Id,
 		)
-		return nil, status.Errorf(codes.Internal, "failed to create session: %v", err)
+		return nil, storeError(err, "failed to create session")
 	}
 
-	s.log.Info("session created successfully",
+	s.metrics.SessionCreated()
+
+	log.Info("session created successfully",
 		"method", "CreateSession",
 		"session_id", createdSession.Id,
 		"user_email", createdSession.UserEmail,
 		"expires_at", createdSession.ExpiresAt,
 	)
-	return ConvertSessionToProto(createdSession), nil
+	return ConvertCreatedSessionToProto(createdSession, s.clock.Now()), nil
+}
+
+// prepareSession проверяет запрос на создание сессии и собирает сессию для записи:
+// генерирует ID и refresh токен, если они не переданы, и задает время истечения
+func (s *Server) prepareSession(log logger.Logger, method string, req *authPb.SessionReq) (*db.Session, error) {
+	session := ConvertProtoToSession(req)
+
+	if session.UserEmail == "" {
+		log.Error("missing required field",
+			"method", method,
+			"missing_field", "user_email",
+		)
+		return nil, invalidArgument("user_email", "user_email is required")
+	}
+
+	// Email становится ключом индекса сессий, поэтому мусор сюда не пускаем
+	if !validEmail(session.UserEmail) {
+		log.Error("invalid field",
+			"method", method,
+			"invalid_field", "user_email",
+		)
+		return nil, invalidArgument("user_email", "user_email must be a valid email address")
+	}
+	session.UserEmail = normalizeEmail(session.UserEmail)
+
+	idFormat := s.conf.Load().Service.SessionIDFormat
+
+	// Если не переданы ни ID, ни refresh токен, генерируем их на сервере.
+	// Переданное только одно из двух значение скорее всего означает ошибку клиента
+	switch {
+	case session.Id == "" && session.RefreshToken == "":
+		if err := generateSessionCredentials(session, idFormat); err != nil {
+			log.Error("failed to generate session credentials",
+				"method", method,
+				"error", err,
+			)
+			return nil, status.Errorf(codes.Internal, "failed to generate session credentials: %v", err)
+		}
+
+	case session.Id == "":
+		log.Error("missing required field",
+			"method", method,
+			"missing_field", "session_id",
+		)
+		return nil, invalidArgument("id", "id is required when refresh_token is set")
+
+	case session.RefreshToken == "":
+		log.Error("missing required field",
+			"method", method,
+			"missing_field", "refresh_token",
+		)
+		return nil, invalidArgument("refresh_token", "refresh_token is required when id is set")
+
+	case !validSessionID(idFormat, session.Id):
+		log.Error("invalid field",
+			"method", method,
+			"invalid_field", "id",
+			"id_format", idFormat,
+		)
+		return nil, invalidArgument("id", fmt.Sprintf("id must be a valid %s", idFormat))
+	}
+
+	if utf8.RuneCountInString(session.Label) > db.MaxSessionLabelLength {
+		log.Error("invalid field",
+			"method", method,
+			"invalid_field", "label",
+		)
+		return nil, invalidArgument("label", fmt.Sprintf("label must be at most %d characters", db.MaxSessionLabelLength))
+	}
+
+	if err := db.ValidateMetadata(session.Metadata); err != nil {
+		log.Error("invalid field",
+			"method", method,
+			"invalid_field", "metadata",
+		)
+		return nil, invalidArgument("metadata", err.Error())
+	}
+
+	// Время истечения задает сервер по TTL, но явно переданное клиентом значение
+	// проверяем: прошедшая или слишком далекая дата — ошибка клиента
+	if req.ExpiresAt != nil {
+		if err := session.ValidateExpiry(s.clock.Now()); err != nil {
+			log.Error("invalid field",
+				"method", method,
+				"invalid_field", "expires_at",
+			)
+			return nil, invalidArgument("expires_at", err.Error())
+		}
+	}
+
+	ttl, err := s.sessionTTL(req.TtlSeconds)
+	if err != nil {
+		log.Error("invalid field",
+			"method", method,
+			"invalid_field", "ttl_seconds",
+			"ttl_seconds", req.TtlSeconds,
+		)
+		return nil, err
+	}
+
+	// Устанавливаем время истечения из запроса или конфигурации
+	session.ExpiresAt = s.clock.Now().UTC().Add(ttl)
+
+	return session, nil
+}
+
+// checkCreateRateLimit ограничивает число новых сессий пользователя за окно из
+// конфигурации. Ошибка хранилища не блокирует вход: лимит защищает от злоупотреблений,
+// а не от сбоев
+func (s *Server) checkCreateRateLimit(ctx context.Context, log logger.Logger, method, email string) error {
+	conf := s.conf.Load().Service
+	if conf.CreateRateLimit <= 0 {
+		return nil
+	}
+
+	allowed, err := s.storer.AllowSessionCreate(ctx, email, conf.CreateRateLimit, conf.CreateRateWindow)
+	if err != nil {
+		log.Warn("failed to check session create rate limit",
+			"method", method,
+			"user_email", email,
+			"error", err,
+		)
+		return nil
+	}
+
+	if !allowed {
+		log.Warn("session create rate limit exceeded",
+			"method", method,
+			"user_email", email,
+			"limit", conf.CreateRateLimit,
+			"window", conf.CreateRateWindow,
+		)
+		return status.Errorf(codes.ResourceExhausted, "too many new sessions for user: limit is %d per %s",
+			conf.CreateRateLimit, conf.CreateRateWindow)
+	}
+
+	return nil
+}
+
+// sessionTTL возвращает время жизни новой сессии: ttl_seconds из запроса,
+// если он задан и попадает в границы из конфигурации, иначе TTL по умолчанию
+func (s *Server) sessionTTL(ttlSeconds int64) (time.Duration, error) {
+	conf := s.conf.Load().Service
+
+	if ttlSeconds == 0 {
+		return conf.GetSessionTTL(), nil
+	}
+
+	if !conf.SessionTTLOverrideAllowed() {
+		return 0, invalidArgument("ttl_seconds", "session ttl override is disabled")
+	}
+
+	ttl := time.Duration(ttlSeconds) * time.Second
+	if ttlSeconds < 0 || ttl < conf.MinSessionTTL || ttl > conf.MaxSessionTTL {
+		return 0, invalidArgument("ttl_seconds", fmt.Sprintf("ttl_seconds must be between %d and %d",
+			int64(conf.MinSessionTTL.Seconds()), int64(conf.MaxSessionTTL.Seconds())))
+	}
+
+	return ttl, nil
+}
+
+// generateSessionCredentials заполняет сессию случайным ID в заданном формате
+// и 256-битным refresh токеном
+func generateSessionCredentials(session *db.Session, idFormat string) error {
+	id, err := newSessionID(idFormat)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := token.NewRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	session.Id = id
+	session.RefreshToken = refreshToken
+	return nil
 }
 
 // GetSession получает сессию по ID
 func (s *Server) GetSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
-	s.log.Info("starting get session",
-		"method", "GetSession",
-		"session_id", req.Id,
-	)
+	log := logger.WithContext(ctx, s.log)
 
 	if req.Id == "" {
-		s.log.Error("missing required field",
+		log.Error("missing required field",
 			"method", "GetSession",
 			"missing_field", "session_id",
 		)
-		return nil, status.Error(codes.InvalidArgument, "session id is required")
+		return nil, invalidArgument("id", "session id is required")
 	}
 
 	session, err := s.storer.GetSession(ctx, req.Id)
 	if err != nil {
-		s.log.Error("session not found",
+		log.Error("failed to get session",
 			"method", "GetSession",
 			"session_id", req.Id,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.NotFound, "session not found: %v", err)
+		return nil, storeError(err, "failed to get session")
+	}
+
+	// По запросу клиента продлеваем сессию (sliding expiration)
+	// Срок сессии ImpersonateUser ограничен и продлению не подлежит
+	if req.Touch && !session.IsRevoked && !session.Impersonated {
+		ttl := s.conf.Load().Service.GetSessionTTL()
+		if err := s.storer.ExtendSession(ctx, session.Id, ttl); err != nil {
+			log.Error("failed to extend session",
+				"method", "GetSession",
+				"session_id", session.Id,
+				"error", err,
+			)
+			return nil, storeError(err, "failed to extend session")
+		}
+
+		now := s.clock.Now().UTC()
+		session.LastAccessedAt = now
+		session.ExpiresAt = now.Add(ttl)
 	}
 
-	s.log.Info("session retrieved successfully",
+	log.Info("session retrieved successfully",
 		"method", "GetSession",
 		"session_id", session.Id,
 		"is_revoked", session.IsRevoked,
-		"expires_in", time.Until(session.ExpiresAt),
+		"expires_in", session.ExpiresAt.Sub(s.clock.Now()),
+	)
+	return ConvertSessionToProto(session, s.clock.Now()), nil
+}
+
+// GetSessionByRefreshToken находит сессию по refresh токену, когда клиенту
+// не известен ID сессии. Сам токен в ответ не попадает
+func (s *Server) GetSessionByRefreshToken(ctx context.Context, req *authPb.GetSessionByRefreshTokenReq) (*authPb.SessionRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.RefreshToken == "" {
+		log.Error("missing required field",
+			"method", "GetSessionByRefreshToken",
+			"missing_field", "refresh_token",
+		)
+		return nil, invalidArgument("refresh_token", "refresh token is required")
+	}
+
+	session, err := s.storer.GetSessionByRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		log.Error("failed to get session by refresh token",
+			"method", "GetSessionByRefreshToken",
+			"error", err,
+		)
+		return nil, storeError(err, "failed to get session")
+	}
+
+	log.Info("session retrieved successfully",
+		"method", "GetSessionByRefreshToken",
+		"session_id", session.Id,
+		"is_revoked", session.IsRevoked,
+	)
+	return ConvertSessionToProto(session, s.clock.Now()), nil
+}
+
+// CheckSession сообщает, действительна ли сессия, и причину отказа. Отсутствующая
+// сессия — не ошибка, а ответ с причиной not_found
+func (s *Server) CheckSession(ctx context.Context, req *authPb.CheckSessionReq) (*authPb.CheckSessionRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.Id == "" {
+		log.Error("missing required field",
+			"method", "CheckSession",
+			"missing_field", "session_id",
+		)
+		return nil, invalidArgument("id", "session id is required")
+	}
+
+	valid, reason, err := s.storer.IsSessionValid(ctx, req.Id)
+	if err != nil {
+		log.Error("failed to check session",
+			"method", "CheckSession",
+			"session_id", req.Id,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to check session")
+	}
+
+	log.Debug("session checked",
+		"method", "CheckSession",
+		"session_id", req.Id,
+		"reason", reason,
+	)
+	return &authPb.CheckSessionRes{Valid: valid, Reason: reason}, nil
+}
+
+// CheckBlacklist проверяет пачку refresh токенов в черном списке одним обращением
+// к хранилищу. Пустые и повторяющиеся токены отбрасываются до проверки
+func (s *Server) CheckBlacklist(ctx context.Context, req *authPb.CheckBlacklistReq) (*authPb.CheckBlacklistRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	tokens := uniqueNonEmpty(req.RefreshTokens)
+
+	if len(tokens) == 0 {
+		log.Error("missing required field",
+			"method", "CheckBlacklist",
+			"missing_field", "refresh_tokens",
+		)
+		return nil, invalidArgument("refresh_tokens", "at least one refresh token is required")
+	}
+
+	if len(tokens) > maxBatchSize {
+		log.Error("batch size exceeded",
+			"method", "CheckBlacklist",
+			"batch_size", len(tokens),
+			"max_batch_size", maxBatchSize,
+		)
+		return nil, invalidArgument("refresh_tokens", fmt.Sprintf("too many refresh tokens: %d, max %d", len(tokens), maxBatchSize))
+	}
+
+	blacklisted, err := s.storer.AreTokensBlacklisted(ctx, tokens)
+	if err != nil {
+		log.Error("failed to check blacklist",
+			"method", "CheckBlacklist",
+			"batch_size", len(tokens),
+			"error", err,
+		)
+		return nil, storeError(err, "failed to check blacklist")
+	}
+
+	log.Debug("blacklist checked",
+		"method", "CheckBlacklist",
+		"batch_size", len(tokens),
+	)
+	return &authPb.CheckBlacklistRes{Blacklisted: blacklisted}, nil
+}
+
+// BlacklistToken вносит утекший refresh токен в черный список на ttl_seconds,
+// не требуя найти его сессию. Доступно только администраторам, действие попадает в аудит
+func (s *Server) BlacklistToken(ctx context.Context, req *authPb.BlacklistTokenReq) (*authPb.BlacklistTokenRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.AdminToken == "" {
+		log.Error("missing required field",
+			"method", "BlacklistToken",
+			"missing_field", "admin_token",
+		)
+		return nil, invalidArgument("admin_token", "admin_token is required")
+	}
+
+	if req.Token == "" {
+		log.Error("missing required field",
+			"method", "BlacklistToken",
+			"missing_field", "token",
+		)
+		return nil, invalidArgument("token", "token is required")
+	}
+
+	// Сравнение в секундах: большое ttl_seconds переполнило бы Duration
+	minSeconds, maxSeconds := int64(minBlacklistTokenTTL/time.Second), int64(maxBlacklistTokenTTL/time.Second)
+	if req.TtlSeconds < minSeconds || req.TtlSeconds > maxSeconds {
+		log.Error("invalid field",
+			"method", "BlacklistToken",
+			"invalid_field", "ttl_seconds",
+			"ttl_seconds", req.TtlSeconds,
+		)
+		return nil, invalidArgument("ttl_seconds", fmt.Sprintf("ttl_seconds must be between %d and %d", minSeconds, maxSeconds))
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+
+	admin, err := s.verifyAccessToken(ctx, log, "BlacklistToken", req.AdminToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !admin.IsAdmin {
+		log.Warn("blacklist denied for non-admin",
+			"method", "BlacklistToken",
+			"actor", admin.Email,
+		)
+		return nil, status.Error(codes.PermissionDenied, "blacklisting a token requires an admin token")
+	}
+
+	if err := s.storer.BlacklistToken(ctx, req.Token, ttl); err != nil {
+		log.Error("failed to blacklist token",
+			"method", "BlacklistToken",
+			"actor", admin.Email,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to blacklist token")
+	}
+
+	s.recordAudit(ctx, AuditEvent{
+		Action: AuditActionBlacklist,
+		Count:  1,
+		Actor:  admin.Email,
+		Reason: req.Reason,
+	})
+
+	expiresAt := s.clock.Now().UTC().Add(ttl)
+
+	log.Info("token blacklisted",
+		"method", "BlacklistToken",
+		"actor", admin.Email,
+		"ttl", ttl,
+	)
+	return &authPb.BlacklistTokenRes{ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+// BatchCreateSessions создает несколько сессий за один запрос. Каждая сессия
+// проверяется так же, как в CreateSession; невалидные возвращаются с ошибкой,
+// не мешая созданию остальных
+func (s *Server) BatchCreateSessions(ctx context.Context, req *authPb.BatchCreateSessionsReq) (*authPb.BatchCreateSessionsRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if err := s.checkDraining(log, "BatchCreateSessions"); err != nil {
+		return nil, err
+	}
+
+	if len(req.Sessions) == 0 {
+		log.Error("missing required field",
+			"method", "BatchCreateSessions",
+			"missing_field", "sessions",
+		)
+		return nil, invalidArgument("sessions", "at least one session is required")
+	}
+
+	if len(req.Sessions) > maxBatchSize {
+		log.Error("batch size exceeded",
+			"method", "BatchCreateSessions",
+			"batch_size", len(req.Sessions),
+			"max_batch_size", maxBatchSize,
+		)
+		return nil, invalidArgument("sessions", fmt.Sprintf("too many sessions: %d, max %d", len(req.Sessions), maxBatchSize))
+	}
+
+	results := make([]*authPb.BatchCreateSessionResult, len(req.Sessions))
+	sessions := make([]*db.Session, 0, len(req.Sessions))
+	indexes := make([]int, 0, len(req.Sessions)) // Позиция каждой валидной сессии в запросе
+
+	for i, item := range req.Sessions {
+		session, err := s.prepareSession(log, "BatchCreateSessions", item)
+		if err != nil {
+			results[i] = batchCreateError(err)
+			continue
+		}
+		// Лимит считается по каждой сессии: пачка не должна обходить лимит CreateSession
+		if err := s.checkCreateRateLimit(ctx, log, "BatchCreateSessions", session.UserEmail); err != nil {
+			results[i] = batchCreateError(err)
+			continue
+		}
+		sessions = append(sessions, session)
+		indexes = append(indexes, i)
+	}
+
+	var itemErrs []error
+	if len(sessions) > 0 {
+		var err error
+		itemErrs, err = s.storer.BatchCreateSessions(ctx, sessions)
+		if err != nil && itemErrs == nil {
+			log.Error("failed to create sessions",
+				"method", "BatchCreateSessions",
+				"batch_size", len(sessions),
+				"error", err,
+			)
+			return nil, storeError(err, "failed to create sessions")
+		}
+		if err != nil {
+			// Сессии уже записаны, не удалось только вытеснить лишние
+			log.Warn("failed to enforce session limit after batch create",
+				"method", "BatchCreateSessions",
+				"error", err,
+			)
+		}
+	}
+
+	created := 0
+	for j, session := range sessions {
+		i := indexes[j]
+		if err := itemErrs[j]; err != nil {
+			results[i] = batchCreateError(storeError(err, "failed to create session"))
+			continue
+		}
+
+		s.metrics.SessionCreated()
+		results[i] = &authPb.BatchCreateSessionResult{Session: ConvertCreatedSessionToProto(session, s.clock.Now())}
+		created++
+	}
+
+	log.Info("sessions created",
+		"method", "BatchCreateSessions",
+		"batch_size", len(req.Sessions),
+		"created_count", created,
 	)
-	return ConvertSessionToProto(session), nil
+	return &authPb.BatchCreateSessionsRes{
+		Results:      results,
+		CreatedCount: int32(created),
+	}, nil
+}
+
+// batchCreateError переводит ошибку gRPC статуса в результат элемента пачки
+func batchCreateError(err error) *authPb.BatchCreateSessionResult {
+	st := status.Convert(err)
+	return &authPb.BatchCreateSessionResult{
+		Error: st.Message(),
+		Code:  int32(st.Code()),
+	}
+}
+
+// BatchGetSessions получает несколько сессий по списку ID за один запрос
+func (s *Server) BatchGetSessions(ctx context.Context, req *authPb.BatchGetSessionsReq) (*authPb.BatchGetSessionsRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	ids := uniqueNonEmpty(req.Ids)
+
+	if len(ids) == 0 {
+		log.Error("missing required field",
+			"method", "BatchGetSessions",
+			"missing_field", "ids",
+		)
+		return nil, invalidArgument("ids", "at least one session id is required")
+	}
+
+	if len(ids) > maxBatchSize {
+		log.Error("batch size exceeded",
+			"method", "BatchGetSessions",
+			"batch_size", len(ids),
+			"max_batch_size", maxBatchSize,
+		)
+		return nil, invalidArgument("ids", fmt.Sprintf("too many session ids: %d, max %d", len(ids), maxBatchSize))
+	}
+
+	sessions, err := s.storer.BatchGetSessions(ctx, ids)
+	if err != nil {
+		log.Error("failed to get sessions",
+			"method", "BatchGetSessions",
+			"batch_size", len(ids),
+			"error", err,
+		)
+		return nil, storeError(err, "failed to get sessions")
+	}
+
+	res := &authPb.BatchGetSessionsRes{
+		Sessions: make(map[string]*authPb.SessionRes, len(sessions)),
+	}
+
+	for id, session := range sessions {
+		res.Sessions[id] = ConvertSessionToProto(session, s.clock.Now())
+	}
+
+	log.Info("sessions retrieved successfully",
+		"method", "BatchGetSessions",
+		"requested_count", len(ids),
+		"found_count", len(res.Sessions),
+	)
+	return res, nil
 }
 
 // GetSessionByEmail получает все активные сессии пользователя по его email
+//
+// Deprecated: используйте ListUserSessions
 func (s *Server) GetSessionByEmail(ctx context.Context, req *authPb.GetSessionByEmailReq) (*authPb.SessionListRes, error) {
-	s.log.Info("starting get sessions by email",
-		"method", "GetSessionByEmail",
-		"user_email", req.UserEmail,
-	)
+	return s.ListUserSessions(ctx, &authPb.ListUserSessionsReq{UserEmail: req.UserEmail})
+}
+
+// ListUserSessions возвращает все активные (не отозванные) сессии пользователя
+func (s *Server) ListUserSessions(ctx context.Context, req *authPb.ListUserSessionsReq) (*authPb.SessionListRes, error) {
+	log := logger.WithContext(ctx, s.log)
+	email := normalizeEmail(req.UserEmail)
 
-	if req.UserEmail == "" {
-		s.log.Error("missing required field",
-			"method", "GetSessionByEmail",
+	if email == "" {
+		log.Error("missing required field",
+			"method", "ListUserSessions",
 			"missing_field", "user_email",
 		)
-		return nil, status.Error(codes.InvalidArgument, "user email is required")
+		return nil, invalidArgument("user_email", "user email is required")
+	}
+
+	limit := int(req.Limit)
+	switch {
+	case limit < 0 || limit > maxPageSize:
+		log.Error("invalid field",
+			"method", "ListUserSessions",
+			"invalid_field", "limit",
+			"limit", req.Limit,
+		)
+		return nil, invalidArgument("limit", fmt.Sprintf("limit must be between 0 and %d", maxPageSize))
+	case limit == 0:
+		limit = defaultPageSize
 	}
 
-	sessions, err := s.storer.GetSessionsByEmail(ctx, req.UserEmail)
+	// Отозванные сессии отфильтровываются на уровне хранилища
+	sessions, nextCursor, err := s.storer.GetSessionsByEmailPaged(ctx, email, req.Cursor, limit)
 	if err != nil {
-		s.log.Error("failed to get sessions",
-			"method", "GetSessionByEmail",
-			"user_email", req.UserEmail,
+		log.Error("failed to get sessions",
+			"method", "ListUserSessions",
+			"user_email", email,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.Internal, "failed to get sessions: %v", err)
+		return nil, storeError(err, "failed to get sessions")
 	}
 
 	// Преобразуем массив сессий в ответ
 	sessionListRes := &authPb.SessionListRes{
-		Sessions: make([]*authPb.SessionRes, 0, len(sessions)),
+		Sessions:   make([]*authPb.SessionRes, 0, len(sessions)),
+		NextCursor: nextCursor,
 	}
 
 	for _, session := range sessions {
-		sessionListRes.Sessions = append(sessionListRes.Sessions, ConvertSessionToProto(session))
+		sessionListRes.Sessions = append(sessionListRes.Sessions, ConvertSessionToProto(session, s.clock.Now()))
 	}
 
-	s.log.Info("sessions retrieved successfully",
-		"method", "GetSessionByEmail",
-		"user_email", req.UserEmail,
+	log.Info("sessions retrieved successfully",
+		"method", "ListUserSessions",
+		"user_email", email,
 		"sessions_count", len(sessionListRes.Sessions),
 	)
 
 	return sessionListRes, nil
 }
 
+// WatchUserSessions отправляет текущий список сессий пользователя, а затем
+// обновленный список после каждого отзыва или удаления его сессий.
+// Поток завершается, когда клиент отключается
+func (s *Server) WatchUserSessions(req *authPb.WatchUserSessionsReq, stream authPb.AuthService_WatchUserSessionsServer) error {
+	ctx := stream.Context()
+	log := logger.WithContext(ctx, s.log)
+	email := normalizeEmail(req.UserEmail)
+
+	if email == "" {
+		log.Error("missing required field",
+			"method", "WatchUserSessions",
+			"missing_field", "user_email",
+		)
+		return invalidArgument("user_email", "user email is required")
+	}
+
+	// Подписываемся до чтения списка, чтобы не пропустить отзыв между ними
+	events, err := s.storer.SubscribeRevocations(ctx)
+	if err != nil {
+		log.Error("failed to subscribe to revocations",
+			"method", "WatchUserSessions",
+			"user_email", email,
+			"error", err,
+		)
+		return status.Errorf(codes.Unavailable, "failed to subscribe to session updates: %v", err)
+	}
+
+	if err := s.sendSessionUpdate(ctx, stream, email, "snapshot", ""); err != nil {
+		return err
+	}
+
+	log.Info("session watch started",
+		"method", "WatchUserSessions",
+		"user_email", email,
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("session watch finished",
+				"method", "WatchUserSessions",
+				"user_email", email,
+			)
+			return nil
+
+		case event, ok := <-events:
+			if !ok {
+				// Отмена контекста тоже закрывает канал, это не ошибка
+				if ctx.Err() != nil {
+					return nil
+				}
+				return status.Error(codes.Unavailable, "session updates subscription closed")
+			}
+
+			if event.UserEmail != email {
+				continue
+			}
+
+			if err := s.sendSessionUpdate(ctx, stream, email, event.Reason, event.SessionId); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSessionUpdate отправляет в поток актуальный список сессий пользователя
+func (s *Server) sendSessionUpdate(ctx context.Context, stream authPb.AuthService_WatchUserSessionsServer, email, reason, sessionID string) error {
+	sessions, err := s.storer.GetSessionsByEmail(ctx, email)
+	if err != nil {
+		logger.WithContext(ctx, s.log).Error("failed to get sessions",
+			"method", "WatchUserSessions",
+			"user_email", email,
+			"error", err,
+		)
+		return storeError(err, "failed to get sessions")
+	}
+
+	update := &authPb.SessionUpdate{
+		Reason:    reason,
+		SessionId: sessionID,
+		Sessions:  make([]*authPb.SessionRes, 0, len(sessions)),
+	}
+
+	for _, session := range sessions {
+		update.Sessions = append(update.Sessions, ConvertSessionToProto(session, s.clock.Now()))
+	}
+
+	return stream.Send(update)
+}
+
+// CountUserSessions возвращает количество сессий пользователя
+func (s *Server) CountUserSessions(ctx context.Context, req *authPb.CountUserSessionsReq) (*authPb.CountUserSessionsRes, error) {
+	log := logger.WithContext(ctx, s.log)
+	email := normalizeEmail(req.UserEmail)
+
+	if email == "" {
+		log.Error("missing required field",
+			"method", "CountUserSessions",
+			"missing_field", "user_email",
+		)
+		return nil, invalidArgument("user_email", "user email is required")
+	}
+
+	count, err := s.storer.CountActiveSessions(ctx, email)
+	if err != nil {
+		log.Error("failed to count sessions",
+			"method", "CountUserSessions",
+			"user_email", email,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to count sessions")
+	}
+
+	log.Info("sessions counted successfully",
+		"method", "CountUserSessions",
+		"user_email", email,
+		"sessions_count", count,
+	)
+	return &authPb.CountUserSessionsRes{
+		Count: count,
+	}, nil
+}
+
 // RevokeSession отзывает сессию
 func (s *Server) RevokeSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
-	s.log.Info("starting revoke session",
-		"method", "RevokeSession",
-		"session_id", req.Id,
-	)
+	log := logger.WithContext(ctx, s.log)
 
 	if req.Id == "" {
-		s.log.Error("missing required field",
+		log.Error("missing required field",
 			"method", "RevokeSession",
 			"missing_field", "session_id",
 		)
-		return nil, status.Error(codes.InvalidArgument, "session id is required")
+		return nil, invalidArgument("id", "session id is required")
 	}
 
 	session, err := s.storer.GetSession(ctx, req.Id)
 	if err != nil {
-		s.log.Error("session not found for revoke",
+		log.Error("failed to get session",
 			"method", "RevokeSession",
 			"session_id", req.Id,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.NotFound, "session not found: %v", err)
+		return nil, storeError(err, "failed to get session")
+	}
+
+	if session.IsRevoked {
+		log.Info("session already revoked",
+			"method", "RevokeSession",
+			"session_id", req.Id,
+		)
+		return ConvertSessionToProto(session, s.clock.Now()), nil
 	}
 
-	if err := s.storer.RevokeSession(ctx, req.Id); err != nil {
-		s.log.Error("failed to revoke session",
+	reason := ConvertProtoToRevokeReason(req.RevokeReason)
+	if err := s.storer.RevokeSession(ctx, req.Id, reason); err != nil {
+		log.Error("failed to revoke session",
 			"method", "RevokeSession",
 			"session_id", req.Id,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.Internal, "failed to revoke session: %v", err)
+		return nil, storeError(err, "failed to revoke session")
 	}
 
-	s.log.Info("session revoked successfully",
+	s.metrics.SessionsRevoked(1)
+	s.publishRevocation(ctx, db.RevocationEvent{
+		SessionId:    session.Id,
+		UserEmail:    session.UserEmail,
+		RefreshToken: session.RefreshToken,
+		Reason:       "revoke",
+	})
+	s.recordAudit(ctx, AuditEvent{
+		Action:    AuditActionRevoke,
+		SessionID: session.Id,
+		UserEmail: session.UserEmail,
+		Count:     1,
+		Reason:    string(reason),
+	})
+
+	log.Info("session revoked successfully",
 		"method", "RevokeSession",
 		"session_id", req.Id,
 	)
 	session.IsRevoked = true
+	session.RevokedReason = reason
 
-	return ConvertSessionToProto(session), nil
+	return ConvertSessionToProto(session, s.clock.Now()), nil
 }
 
-// DeleteSession удаляет сессию
-func (s *Server) DeleteSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
-	s.log.Info("starting delete session",
-		"method", "DeleteSession",
+// UpdateSessionLabel переименовывает сессию; отозванные сессии переименовать нельзя
+func (s *Server) UpdateSessionLabel(ctx context.Context, req *authPb.UpdateSessionLabelReq) (*authPb.SessionRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.Id == "" {
+		log.Error("missing required field",
+			"method", "UpdateSessionLabel",
+			"missing_field", "session_id",
+		)
+		return nil, invalidArgument("id", "session id is required")
+	}
+
+	if utf8.RuneCountInString(req.Label) > db.MaxSessionLabelLength {
+		log.Error("invalid field",
+			"method", "UpdateSessionLabel",
+			"invalid_field", "label",
+		)
+		return nil, invalidArgument("label", fmt.Sprintf("label must be at most %d characters", db.MaxSessionLabelLength))
+	}
+
+	if err := s.storer.UpdateSessionLabel(ctx, req.Id, req.Label); err != nil {
+		log.Error("failed to update session label",
+			"method", "UpdateSessionLabel",
+			"session_id", req.Id,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to update session label")
+	}
+
+	session, err := s.storer.GetSession(ctx, req.Id)
+	if err != nil {
+		log.Error("failed to get session",
+			"method", "UpdateSessionLabel",
+			"session_id", req.Id,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to get session")
+	}
+
+	log.Info("session label updated successfully",
+		"method", "UpdateSessionLabel",
 		"session_id", req.Id,
 	)
+	return ConvertSessionToProto(session, s.clock.Now()), nil
+}
+
+// RevokeAllUserSessions отзывает все сессии пользователя ("выйти на всех устройствах").
+// С dry_run только возвращает список сессий, которые были бы отозваны
+func (s *Server) RevokeAllUserSessions(ctx context.Context, req *authPb.RevokeAllUserSessionsReq) (*authPb.RevokeAllUserSessionsRes, error) {
+	log := logger.WithContext(ctx, s.log)
+	email := normalizeEmail(req.UserEmail)
+
+	if email == "" {
+		log.Error("missing required field",
+			"method", "RevokeAllUserSessions",
+			"missing_field", "user_email",
+		)
+		return nil, invalidArgument("user_email", "user email is required")
+	}
+
+	reason := ConvertProtoToRevokeReason(req.Reason)
+	revokedIDs, err := s.storer.RevokeUserSessions(ctx, email, reason, req.DryRun)
+	if err != nil {
+		log.Error("failed to revoke user sessions",
+			"method", "RevokeAllUserSessions",
+			"user_email", email,
+			"dry_run", req.DryRun,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to revoke user sessions")
+	}
+
+	revokedCount := len(revokedIDs)
+
+	if req.DryRun {
+		log.Info("user sessions revoke dry run",
+			"method", "RevokeAllUserSessions",
+			"user_email", email,
+			"affected_count", revokedCount,
+		)
+		return &authPb.RevokeAllUserSessionsRes{
+			RevokedCount: int64(revokedCount),
+			SessionIds:   revokedIDs,
+			DryRun:       true,
+		}, nil
+	}
+
+	s.metrics.SessionsRevoked(revokedCount)
+	if revokedCount > 0 {
+		s.publishRevocation(ctx, db.RevocationEvent{
+			UserEmail: email,
+			Reason:    "revoke_all",
+		})
+	}
+	s.recordAudit(ctx, AuditEvent{
+		Action:    AuditActionRevokeAll,
+		UserEmail: email,
+		Count:     revokedCount,
+		Reason:    string(reason),
+	})
+
+	log.Info("user sessions revoked successfully",
+		"method", "RevokeAllUserSessions",
+		"user_email", email,
+		"revoked_count", revokedCount,
+	)
+	return &authPb.RevokeAllUserSessionsRes{
+		RevokedCount: int64(revokedCount),
+		SessionIds:   revokedIDs,
+	}, nil
+}
+
+// GetStats возвращает число активных сессий и пользователей. Подсчет обходит все
+// индексы, поэтому результат кешируется на statsCacheTTL, а параллельные вызовы
+// ждут один общий подсчет
+func (s *Server) GetStats(ctx context.Context, req *authPb.GetStatsReq) (*authPb.GetStatsRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if cached := s.statsCache; cached != nil && s.clock.Now().Sub(cached.SnapshotTime) < statsCacheTTL {
+		return ConvertStatsToProto(cached), nil
+	}
+
+	stats, err := s.storer.SessionStats(ctx)
+	if err != nil {
+		log.Error("failed to count sessions",
+			"method", "GetStats",
+			"error", err,
+		)
+		return nil, storeError(err, "failed to count sessions")
+	}
+	s.statsCache = stats
+
+	log.Info("session stats computed",
+		"method", "GetStats",
+		"active_sessions", stats.ActiveSessions,
+		"unique_users", stats.UniqueUsers,
+	)
+	return ConvertStatsToProto(stats), nil
+}
+
+// TriggerReap вручную запускает очистку индексов сессий: одного пользователя или всех
+func (s *Server) TriggerReap(ctx context.Context, req *authPb.TriggerReapReq) (*authPb.TriggerReapRes, error) {
+	log := logger.WithContext(ctx, s.log)
+	email := normalizeEmail(req.UserEmail)
+
+	if email != "" {
+		pruned, err := s.storer.ReconcileUser(ctx, email)
+		if err != nil {
+			log.Error("failed to reconcile user sessions",
+				"method", "TriggerReap",
+				"user_email", email,
+				"error", err,
+			)
+			return nil, storeError(err, "failed to reconcile user sessions")
+		}
+
+		log.Info("user session index reconciled",
+			"method", "TriggerReap",
+			"user_email", email,
+			"pruned_ids", pruned,
+		)
+		return &authPb.TriggerReapRes{
+			UsersScanned: 1,
+			PrunedIds:    int64(pruned),
+		}, nil
+	}
+
+	result, err := s.storer.ReapUserIndexes(ctx)
+	if err != nil {
+		log.Error("failed to reap session indexes",
+			"method", "TriggerReap",
+			"error", err,
+		)
+		return nil, storeError(err, "failed to reap session indexes")
+	}
+
+	log.Info("session indexes reaped",
+		"method", "TriggerReap",
+		"users_scanned", result.UsersScanned,
+		"pruned_ids", result.PrunedIDs,
+	)
+	return &authPb.TriggerReapRes{
+		UsersScanned: int64(result.UsersScanned),
+		PrunedIds:    int64(result.PrunedIDs),
+	}, nil
+}
+
+// DeleteSession удаляет сессию
+func (s *Server) DeleteSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
+	log := logger.WithContext(ctx, s.log)
 
 	if req.Id == "" {
-		s.log.Error("missing required field",
+		log.Error("missing required field",
 			"method", "DeleteSession",
 			"missing_field", "session_id",
 		)
-		return nil, status.Error(codes.InvalidArgument, "session id is required")
+		return nil, invalidArgument("id", "session id is required")
 	}
 
 	session, err := s.storer.GetSession(ctx, req.Id)
 	if err != nil {
-		s.log.Error("session not found for delete",
+		// Повторное удаление не ошибка: возвращаем пустой ответ с ID
+		if errors.Is(err, db.ErrSessionNotFound) {
+			log.Info("session already deleted",
+				"method", "DeleteSession",
+				"session_id", req.Id,
+			)
+			return &authPb.SessionRes{Id: req.Id}, nil
+		}
+
+		log.Error("failed to get session",
 			"method", "DeleteSession",
 			"session_id", req.Id,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.NotFound, "session not found: %v", err)
+		return nil, storeError(err, "failed to get session")
 	}
 
 	if err := s.storer.DeleteSession(ctx, req.Id); err != nil {
-		s.log.Error("failed to delete session",
+		log.Error("failed to delete session",
 			"method", "DeleteSession",
 			"session_id", req.Id,
 			"error", err,
 		)
-		return nil, status.Errorf(codes.Internal, "failed to delete session: %v", err)
+		return nil, storeError(err, "failed to delete session")
 	}
 
-	s.log.Info("session deleted successfully",
+	s.metrics.SessionDeleted()
+	s.publishRevocation(ctx, db.RevocationEvent{
+		SessionId:    session.Id,
+		UserEmail:    session.UserEmail,
+		RefreshToken: session.RefreshToken,
+		Reason:       "delete",
+	})
+	s.recordAudit(ctx, AuditEvent{
+		Action:    AuditActionDelete,
+		SessionID: session.Id,
+		UserEmail: session.UserEmail,
+		Count:     1,
+	})
+
+	log.Info("session deleted successfully",
 		"method", "DeleteSession",
 		"session_id", req.Id,
 		"user_email", session.UserEmail,
 	)
-	return ConvertSessionToProto(session), nil
+	return ConvertSessionToProto(session, s.clock.Now()), nil
+}
+
+// RenewAccessToken выпускает новый access токен по действующему refresh токену
+func (s *Server) RenewAccessToken(ctx context.Context, req *authPb.RenewAccessTokenReq) (*authPb.RenewAccessTokenRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	renewReq := ConvertProtoToRenewAccessTokenReq(req)
+
+	if renewReq.RefreshToken == "" {
+		log.Error("missing required field",
+			"method", "RenewAccessToken",
+			"missing_field", "refresh_token",
+		)
+		return nil, invalidArgument("refresh_token", "refresh token is required")
+	}
+
+	isBlacklisted, err := s.storer.IsTokenBlacklisted(ctx, renewReq.RefreshToken)
+	if err != nil {
+		log.Error("failed to check token blacklist",
+			"method", "RenewAccessToken",
+			"session_id", renewReq.SessionId,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to check refresh token")
+	}
+
+	if isBlacklisted {
+		log.Warn("refresh token is blacklisted",
+			"method", "RenewAccessToken",
+			"session_id", renewReq.SessionId,
+		)
+		return nil, status.Error(codes.Unauthenticated, "refresh token is revoked")
+	}
+
+	// session_id необязателен: без него сессия ищется по refresh токену,
+	// а переданный ID только сверяется с токеном
+	var session *db.Session
+	if renewReq.SessionId == "" {
+		session, err = s.storer.GetSessionByRefreshToken(ctx, renewReq.RefreshToken)
+		if errors.Is(err, db.ErrSessionNotFound) {
+			log.Warn("refresh token does not match any session",
+				"method", "RenewAccessToken",
+			)
+			return nil, status.Error(codes.Unauthenticated, "refresh token does not match any session")
+		}
+	} else {
+		session, err = s.storer.GetSession(ctx, renewReq.SessionId)
+	}
+	if err != nil {
+		log.Error("failed to get session",
+			"method", "RenewAccessToken",
+			"session_id", renewReq.SessionId,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to get session")
+	}
+
+	if !session.RefreshTokenMatches(renewReq.RefreshToken) {
+		log.Warn("refresh token mismatch",
+			"method", "RenewAccessToken",
+			"session_id", session.Id,
+		)
+		return nil, status.Error(codes.Unauthenticated, "refresh token does not match session")
+	}
+
+	if session.IsRevoked {
+		log.Warn("session is revoked",
+			"method", "RenewAccessToken",
+			"session_id", session.Id,
+		)
+		return nil, status.Error(codes.Unauthenticated, "session is revoked")
+	}
+
+	if s.clock.Now().After(session.ExpiresAt) {
+		log.Warn("session is expired",
+			"method", "RenewAccessToken",
+			"session_id", session.Id,
+			"expires_at", session.ExpiresAt,
+		)
+		return nil, status.Error(codes.Unauthenticated, "session is expired")
+	}
+
+	accessToken, payload, err := s.tokenMaker.CreateToken(session.UserEmail, session.IsAdmin, session.Id, s.conf.Load().Service.GetAccessTokenTTL())
+	if err != nil {
+		log.Error("failed to create access token",
+			"method", "RenewAccessToken",
+			"session_id", session.Id,
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Internal, "failed to create access token: %v", err)
+	}
+
+	renewRes := &db.RenewAccessTokenRes{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: payload.ExpiresAt,
+	}
+
+	// При ротации выдаем новый refresh токен, а старый попадает в черный список
+	if renewReq.RotateRefreshToken {
+		refreshToken, err := token.NewRefreshToken()
+		if err != nil {
+			log.Error("failed to generate refresh token",
+				"method", "RenewAccessToken",
+				"session_id", session.Id,
+				"error", err,
+			)
+			return nil, status.Errorf(codes.Internal, "failed to generate refresh token: %v", err)
+		}
+
+		if err := s.storer.RotateRefreshToken(ctx, session.Id, refreshToken); err != nil {
+			log.Error("failed to rotate refresh token",
+				"method", "RenewAccessToken",
+				"session_id", session.Id,
+				"error", err,
+			)
+			return nil, storeError(err, "failed to rotate refresh token")
+		}
+
+		renewRes.RefreshToken = refreshToken
+	} else if session.HasLegacyRefreshToken() {
+		// Сессия записана до хеширования refresh токенов: переводим ее на хеш, не прерывая обновление
+		if err := s.storer.RehashRefreshToken(ctx, session.Id, renewReq.RefreshToken); err != nil {
+			log.Warn("failed to rehash legacy refresh token",
+				"method", "RenewAccessToken",
+				"session_id", session.Id,
+				"error", err,
+			)
+		}
+	}
+
+	log.Info("access token renewed successfully",
+		"method", "RenewAccessToken",
+		"session_id", session.Id,
+		"user_email", session.UserEmail,
+		"access_token_expires_at", payload.ExpiresAt,
+		"refresh_token_rotated", renewReq.RotateRefreshToken,
+	)
+	return ConvertRenewAccessTokenResToProto(renewRes), nil
+}
+
+// LoginUser проверяет учетные данные пользователя и открывает для него новую сессию
+func (s *Server) LoginUser(ctx context.Context, req *authPb.LoginUserReq) (*authPb.LoginUserRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if s.userVerifier == nil {
+		return nil, status.Error(codes.Unimplemented, "login is not configured")
+	}
+
+	if err := s.checkDraining(log, "LoginUser"); err != nil {
+		return nil, err
+	}
+
+	if req.Email == "" {
+		log.Error("missing required field",
+			"method", "LoginUser",
+			"missing_field", "email",
+		)
+		return nil, invalidArgument("email", "email is required")
+	}
+
+	if req.Password == "" {
+		log.Error("missing required field",
+			"method", "LoginUser",
+			"missing_field", "password",
+		)
+		return nil, invalidArgument("password", "password is required")
+	}
+
+	user, err := s.userVerifier.VerifyCredentials(ctx, req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			log.Warn("invalid credentials",
+				"method", "LoginUser",
+				"user_email", req.Email,
+			)
+			return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+		}
+
+		log.Error("failed to verify credentials",
+			"method", "LoginUser",
+			"user_email", req.Email,
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Unavailable, "failed to verify credentials: %v", err)
+	}
+
+	conf := s.conf.Load()
+
+	session := &db.Session{
+		UserEmail:  normalizeEmail(user.Email),
+		ExpiresAt:  s.clock.Now().UTC().Add(conf.Service.GetSessionTTL()),
+		IPAddress:  req.IpAddress,
+		UserAgent:  req.UserAgent,
+		DeviceName: req.DeviceName,
+		IsAdmin:    user.IsAdmin,
+	}
+
+	if err := s.checkCreateRateLimit(ctx, log, "LoginUser", session.UserEmail); err != nil {
+		return nil, err
+	}
+
+	if err := generateSessionCredentials(session, conf.Service.SessionIDFormat); err != nil {
+		log.Error("failed to generate session credentials",
+			"method", "LoginUser",
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Internal, "failed to generate session credentials: %v", err)
+	}
+
+	createdSession, err := s.storer.CreateSession(ctx, session)
+	if err != nil {
+		log.Error("failed to create session",
+			"method", "LoginUser",
+			"user_email", user.Email,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to create session")
+	}
+
+	s.metrics.SessionCreated()
+
+	accessToken, payload, err := s.tokenMaker.CreateToken(user.Email, user.IsAdmin, createdSession.Id, conf.Service.GetAccessTokenTTL())
+	if err != nil {
+		log.Error("failed to create access token",
+			"method", "LoginUser",
+			"session_id", createdSession.Id,
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Internal, "failed to create access token: %v", err)
+	}
+
+	log.Info("user logged in successfully",
+		"method", "LoginUser",
+		"session_id", createdSession.Id,
+		"user_email", user.Email,
+	)
+	return ConvertLoginUserResToProto(&db.LoginUserRes{
+		SessionId:             createdSession.Id,
+		AccessToken:           accessToken,
+		RefreshToken:          createdSession.RefreshToken,
+		AccessTokenExpiresAt:  payload.ExpiresAt,
+		RefreshTokenExpiresAt: createdSession.ExpiresAt,
+		User:                  *user,
+	}), nil
+}
+
+// ImpersonateUser создает короткую сессию пользователя target_email по access токену
+// администратора, чтобы поддержка могла воспроизвести проблему. Сессия помечается
+// Impersonated, а действие записывается в аудит с администратором в качестве инициатора
+func (s *Server) ImpersonateUser(ctx context.Context, req *authPb.ImpersonateUserReq) (*authPb.ImpersonateUserRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.AdminToken == "" {
+		log.Error("missing required field",
+			"method", "ImpersonateUser",
+			"missing_field", "admin_token",
+		)
+		return nil, invalidArgument("admin_token", "admin_token is required")
+	}
+
+	if !validEmail(req.TargetEmail) {
+		log.Error("invalid field",
+			"method", "ImpersonateUser",
+			"invalid_field", "target_email",
+		)
+		return nil, invalidArgument("target_email", "target_email must be a valid email address")
+	}
+	targetEmail := normalizeEmail(req.TargetEmail)
+
+	admin, err := s.verifyAccessToken(ctx, log, "ImpersonateUser", req.AdminToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !admin.IsAdmin {
+		log.Warn("impersonation denied for non-admin",
+			"method", "ImpersonateUser",
+			"actor", admin.Email,
+			"user_email", targetEmail,
+		)
+		return nil, status.Error(codes.PermissionDenied, "impersonation requires an admin token")
+	}
+
+	if err := s.checkDraining(log, "ImpersonateUser"); err != nil {
+		return nil, err
+	}
+
+	conf := s.conf.Load()
+	ttl := min(conf.Service.GetSessionTTL(), impersonationTTL)
+
+	session := &db.Session{
+		UserEmail:      targetEmail,
+		ExpiresAt:      s.clock.Now().UTC().Add(ttl),
+		IPAddress:      peerIP(ctx),
+		DeviceName:     "impersonation",
+		Impersonated:   true,
+		ImpersonatedBy: admin.Email,
+	}
+
+	if err := generateSessionCredentials(session, conf.Service.SessionIDFormat); err != nil {
+		log.Error("failed to generate session credentials",
+			"method", "ImpersonateUser",
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Internal, "failed to generate session credentials: %v", err)
+	}
+
+	createdSession, err := s.storer.CreateSession(ctx, session)
+	if err != nil {
+		log.Error("failed to create session",
+			"method", "ImpersonateUser",
+			"user_email", targetEmail,
+			"actor", admin.Email,
+			"error", err,
+		)
+		return nil, storeError(err, "failed to create session")
+	}
+
+	s.metrics.SessionCreated()
+
+	// Права администратора на сессию пользователя не переносятся
+	accessToken, payload, err := s.tokenMaker.CreateToken(targetEmail, false, createdSession.Id, min(conf.Service.GetAccessTokenTTL(), ttl))
+	if err != nil {
+		log.Error("failed to create access token",
+			"method", "ImpersonateUser",
+			"session_id", createdSession.Id,
+			"error", err,
+		)
+		return nil, status.Errorf(codes.Internal, "failed to create access token: %v", err)
+	}
+
+	s.recordAudit(ctx, AuditEvent{
+		Action:    AuditActionImpersonate,
+		SessionID: createdSession.Id,
+		UserEmail: targetEmail,
+		Count:     1,
+		Actor:     admin.Email,
+		Reason:    req.Reason,
+	})
+
+	log.Info("impersonation session created",
+		"method", "ImpersonateUser",
+		"session_id", createdSession.Id,
+		"user_email", targetEmail,
+		"actor", admin.Email,
+		"expires_at", createdSession.ExpiresAt,
+	)
+	return &authPb.ImpersonateUserRes{
+		SessionId:            createdSession.Id,
+		AccessToken:          accessToken,
+		RefreshToken:         createdSession.RefreshToken,
+		AccessTokenExpiresAt: timestamppb.New(payload.ExpiresAt),
+		SessionExpiresAt:     timestamppb.New(createdSession.ExpiresAt),
+	}, nil
+}
+
+// ValidateToken проверяет access токен и возвращает данные пользователя.
+// Токен отозванной или удаленной сессии считается недействительным
+func (s *Server) ValidateToken(ctx context.Context, req *authPb.ValidateTokenReq) (*authPb.ValidateTokenRes, error) {
+	log := logger.WithContext(ctx, s.log)
+
+	if req.Token == "" {
+		log.Error("missing required field",
+			"method", "ValidateToken",
+			"missing_field", "token",
+		)
+		return nil, invalidArgument("token", "token is required")
+	}
+
+	payload, err := s.verifyAccessToken(ctx, log, "ValidateToken", req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("access token validated",
+		"method", "ValidateToken",
+		"session_id", payload.SessionID,
+		"user_email", payload.Email,
+	)
+	return &authPb.ValidateTokenRes{
+		Email:     payload.Email,
+		IsAdmin:   payload.IsAdmin,
+		SessionId: payload.SessionID,
+		ExpiresAt: timestamppb.New(payload.ExpiresAt),
+	}, nil
+}
+
+// verifyAccessToken проверяет подпись и срок access токена, а также то, что его сессия
+// существует, не истекла, не отозвана и ее refresh токен не в черном списке.
+// Ошибки — статусы Unauthenticated с причиной в ErrorInfo
+func (s *Server) verifyAccessToken(ctx context.Context, log logger.Logger, method, accessToken string) (*token.Payload, error) {
+	payload, err := s.tokenMaker.VerifyToken(accessToken)
+	if err != nil {
+		log.Warn("access token rejected",
+			"method", method,
+			"error", err,
+		)
+
+		if errors.Is(err, token.ErrExpiredToken) {
+			return nil, statusWithReason(codes.Unauthenticated, reasonTokenExpired, "token has expired")
+		}
+		return nil, statusWithReason(codes.Unauthenticated, reasonTokenInvalid, "token is invalid")
+	}
+
+	if payload.SessionID != "" {
+		// IsSessionValid проверяет и отзыв, и refresh токен сессии в черном списке
+		valid, reason, err := s.storer.IsSessionValid(ctx, payload.SessionID)
+		if err != nil {
+			log.Error("failed to check session",
+				"method", method,
+				"session_id", payload.SessionID,
+				"error", err,
+			)
+			return nil, storeError(err, "failed to check session")
+		}
+
+		if !valid {
+			log.Warn("session of access token is not valid",
+				"method", method,
+				"session_id", payload.SessionID,
+				"reason", reason,
+			)
+
+			switch reason {
+			case db.SessionReasonNotFound:
+				return nil, statusWithReason(codes.Unauthenticated, reasonSessionNotFound, "session not found")
+			case db.SessionReasonExpired:
+				return nil, statusWithReason(codes.Unauthenticated, reasonSessionExpired, "session is expired")
+			default:
+				return nil, statusWithReason(codes.Unauthenticated, reasonSessionRevoked, "session is revoked")
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+// publishRevocation оповещает подписчиков об отзыве сессии.
+// Ошибка публикации только логируется: сам отзыв уже выполнен
+func (s *Server) publishRevocation(ctx context.Context, event db.RevocationEvent) {
+	if err := s.storer.PublishRevocation(ctx, event); err != nil {
+		logger.WithContext(ctx, s.log).Error("failed to publish revocation event",
+			"session_id", event.SessionId,
+			"user_email", event.UserEmail,
+			"reason", event.Reason,
+			"error", err,
+		)
+	}
+}
+
+// uniqueNonEmpty возвращает значения без дубликатов и пустых строк, сохраняя порядок
+func uniqueNonEmpty(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+
+	return result
 }
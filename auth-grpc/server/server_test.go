@@ -0,0 +1,1763 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+	"github.com/rx3lixir/auth-service/internal/config"
+	"github.com/rx3lixir/auth-service/internal/db"
+	"github.com/rx3lixir/auth-service/internal/token"
+)
+
+const testSecretKey = "36080001349340267925113477454910"
+
+// nopLogger отбрасывает логи сервера в тестах
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) Fatal(string, ...interface{}) {}
+func (nopLogger) Panic(string, ...interface{}) {}
+
+// fakeClock управляемые часы для проверок истечения
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testEnv сервер поверх хранилища в памяти с общими управляемыми часами
+type testEnv struct {
+	srv   *Server
+	store *db.MemoryStore
+	maker token.Maker
+	clock *fakeClock
+}
+
+func testConfig() *config.AppConfig {
+	return &config.AppConfig{
+		Service: config.ServiceParams{
+			Env:                "test",
+			SessionTTLDays:     7,
+			AccessTokenTTLMins: 15,
+			MaxSessionsPerUser: 10,
+			RateLimitRPS:       50,
+			RateLimitBurst:     100,
+		},
+		Server: config.ServerParams{
+			SecretKey: testSecretKey,
+		},
+	}
+}
+
+func newTestEnv(t *testing.T, opts ...Option) *testEnv {
+	t.Helper()
+
+	clock := newFakeClock()
+	maker, err := token.NewJWTMaker(testSecretKey, token.WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewJWTMaker: %v", err)
+	}
+	t.Cleanup(func() { maker.Close() })
+
+	conf := testConfig()
+	store := db.NewMemoryStore(
+		db.WithClock(clock),
+		db.WithMaxSessionsPerUser(conf.Service.MaxSessionsPerUser),
+	)
+
+	opts = append([]Option{WithClock(clock)}, opts...)
+	return &testEnv{
+		srv:   NewServer(store, maker, nopLogger{}, conf, opts...),
+		store: store,
+		maker: maker,
+		clock: clock,
+	}
+}
+
+// createSession создает сессию через сервер и возвращает ответ с сырым refresh токеном
+func (e *testEnv) createSession(t *testing.T, email string) *authPb.SessionRes {
+	t.Helper()
+
+	res, err := e.srv.CreateSession(context.Background(), &authPb.SessionReq{UserEmail: email})
+	if err != nil {
+		t.Fatalf("CreateSession(%q): %v", email, err)
+	}
+	return res
+}
+
+// accessToken выпускает access токен сессии тем же Maker, что и сервер
+func (e *testEnv) accessToken(t *testing.T, email, sessionID string, ttl time.Duration) string {
+	t.Helper()
+
+	tok, _, err := e.maker.CreateToken(email, false, sessionID, ttl)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	return tok
+}
+
+// errorReason возвращает причину из ErrorInfo деталей статуса
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// violatedField возвращает поле первого нарушения из BadRequest деталей статуса
+func violatedField(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if bad, ok := detail.(*errdetails.BadRequest); ok && len(bad.FieldViolations) > 0 {
+			return bad.FieldViolations[0].Field
+		}
+	}
+	return ""
+}
+
+func wantCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %s, want %s (err: %v)", got, want, err)
+	}
+}
+
+func TestRenewAccessToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq
+		want  codes.Code
+	}{
+		{
+			name: "valid",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.OK,
+		},
+		{
+			name: "blacklisted token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				if err := e.store.BlacklistToken(context.Background(), res.RefreshToken, time.Hour); err != nil {
+					t.Fatalf("BlacklistToken: %v", err)
+				}
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "revoked session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				if err := e.store.RevokeSession(context.Background(), res.Id, db.RevokeReasonLogout); err != nil {
+					t.Fatalf("RevokeSession: %v", err)
+				}
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "expired session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				// Хранилище еще держит ключ, а часы сервиса уже ушли за срок сессии
+				later := &fakeClock{now: res.ExpiresAt.AsTime().Add(time.Second)}
+				e.srv.clock = later
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "expired and removed session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				e.clock.Advance(8 * 24 * time.Hour)
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "wrong refresh token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: "not-the-token"}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "unknown session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{SessionId: "missing", RefreshToken: res.RefreshToken}
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "refresh token only",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{RefreshToken: res.RefreshToken}
+			},
+			want: codes.OK,
+		},
+		{
+			name: "unknown refresh token only",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{RefreshToken: "not-the-token"}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "refresh token of another session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				other := e.createSession(t, "user@example.com")
+				return &authPb.RenewAccessTokenReq{SessionId: other.Id, RefreshToken: res.RefreshToken}
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "missing refresh token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) *authPb.RenewAccessTokenReq {
+				return &authPb.RenewAccessTokenReq{SessionId: res.Id}
+			},
+			want: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			res := e.createSession(t, "user@example.com")
+
+			got, err := e.srv.RenewAccessToken(context.Background(), tt.setup(t, e, res))
+			wantCode(t, err, tt.want)
+			if tt.want != codes.OK {
+				return
+			}
+
+			payload, err := e.maker.VerifyToken(got.AccessToken)
+			if err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+			if payload.Email != "user@example.com" || payload.SessionID != res.Id {
+				t.Errorf("payload = %+v, want email user@example.com and session %s", payload, res.Id)
+			}
+			want := e.clock.Now().Add(15 * time.Minute)
+			if !got.AccessTokenExpiresAt.AsTime().Equal(want) || !payload.ExpiresAt.Equal(want) {
+				t.Errorf("access token expires at %s (claim %s), want %s", got.AccessTokenExpiresAt.AsTime(), payload.ExpiresAt, want)
+			}
+		})
+	}
+}
+
+func TestRenewAccessTokenRotation(t *testing.T) {
+	e := newTestEnv(t)
+	res := e.createSession(t, "user@example.com")
+	ctx := context.Background()
+
+	got, err := e.srv.RenewAccessToken(ctx, &authPb.RenewAccessTokenReq{
+		SessionId:          res.Id,
+		RefreshToken:       res.RefreshToken,
+		RotateRefreshToken: true,
+	})
+	if err != nil {
+		t.Fatalf("RenewAccessToken: %v", err)
+	}
+	if got.RefreshToken == "" || got.RefreshToken == res.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+
+	_, err = e.srv.RenewAccessToken(ctx, &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: res.RefreshToken})
+	wantCode(t, err, codes.Unauthenticated)
+
+	if _, err := e.srv.RenewAccessToken(ctx, &authPb.RenewAccessTokenReq{SessionId: res.Id, RefreshToken: got.RefreshToken}); err != nil {
+		t.Fatalf("RenewAccessToken with rotated token: %v", err)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	created := e.createSession(t, "User@Example.com")
+	if created.RefreshToken == "" {
+		t.Fatal("CreateSession did not return the refresh token")
+	}
+	if created.UserEmail != "user@example.com" {
+		t.Errorf("user_email = %q, want normalized user@example.com", created.UserEmail)
+	}
+
+	got, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if got.RefreshToken != "" {
+		t.Error("GetSession exposed the refresh token")
+	}
+
+	check, err := e.srv.CheckSession(ctx, &authPb.CheckSessionReq{Id: created.Id})
+	if err != nil {
+		t.Fatalf("CheckSession: %v", err)
+	}
+	if !check.Valid {
+		t.Errorf("CheckSession = %q, want valid", check.Reason)
+	}
+
+	revoked, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id, RevokeReason: authPb.RevokeReason_REVOKE_REASON_LOGOUT})
+	if err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if !revoked.IsRevoked || revoked.RevokedReason != authPb.RevokeReason_REVOKE_REASON_LOGOUT {
+		t.Errorf("RevokeSession = revoked %v reason %s, want revoked by logout", revoked.IsRevoked, revoked.RevokedReason)
+	}
+
+	check, err = e.srv.CheckSession(ctx, &authPb.CheckSessionReq{Id: created.Id})
+	if err != nil {
+		t.Fatalf("CheckSession: %v", err)
+	}
+	if check.Valid || check.Reason != db.SessionReasonRevoked {
+		t.Errorf("CheckSession after revoke = %v %q, want %q", check.Valid, check.Reason, db.SessionReasonRevoked)
+	}
+
+	blacklist, err := e.srv.CheckBlacklist(ctx, &authPb.CheckBlacklistReq{RefreshTokens: []string{created.RefreshToken}})
+	if err != nil {
+		t.Fatalf("CheckBlacklist: %v", err)
+	}
+	if !blacklist.Blacklisted[created.RefreshToken] {
+		t.Error("refresh token of the revoked session is not blacklisted")
+	}
+
+	if _, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	_, err = e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestCreateSessionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *authPb.SessionReq
+		want codes.Code
+	}{
+		{"missing email", &authPb.SessionReq{}, codes.InvalidArgument},
+		{"invalid email", &authPb.SessionReq{UserEmail: "not-an-email"}, codes.InvalidArgument},
+		{"too many metadata keys", &authPb.SessionReq{UserEmail: "user@example.com", Metadata: tooManyMetadata()}, codes.InvalidArgument},
+		{"id without refresh token", &authPb.SessionReq{UserEmail: "user@example.com", Id: "c6a1c9f4-9a57-4d0e-8d8a-7c1f0c7c2b1e"}, codes.InvalidArgument},
+		{"refresh token without id", &authPb.SessionReq{UserEmail: "user@example.com", RefreshToken: "refresh"}, codes.InvalidArgument},
+		{"valid", &authPb.SessionReq{UserEmail: "user@example.com"}, codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			_, err := e.srv.CreateSession(context.Background(), tt.req)
+			wantCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestCreateSessionGeneratesCredentials(t *testing.T) {
+	e := newTestEnv(t)
+
+	const n = 20
+	ids := make(map[string]struct{}, n)
+	tokens := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		res := e.createSession(t, fmt.Sprintf("user%d@example.com", i))
+
+		if !validSessionID(SessionIDFormatUUID, res.Id) {
+			t.Errorf("generated id %q is not a UUID", res.Id)
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(res.RefreshToken)
+		if err != nil {
+			t.Fatalf("refresh token %q is not base64url: %v", res.RefreshToken, err)
+		}
+		if len(raw) != 32 {
+			t.Errorf("refresh token has %d bytes of entropy, want 32", len(raw))
+		}
+
+		ids[res.Id] = struct{}{}
+		tokens[res.RefreshToken] = struct{}{}
+	}
+
+	if len(ids) != n || len(tokens) != n {
+		t.Errorf("generated %d unique ids and %d unique refresh tokens for %d sessions", len(ids), len(tokens), n)
+	}
+}
+
+func tooManyMetadata() map[string]string {
+	metadata := make(map[string]string, db.MaxSessionMetadataKeys+1)
+	for i := 0; i <= db.MaxSessionMetadataKeys; i++ {
+		metadata[fmt.Sprintf("key%d", i)] = "value"
+	}
+	return metadata
+}
+
+func TestListUserSessions(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		e.createSession(t, "user@example.com")
+		e.clock.Advance(time.Minute)
+	}
+	e.createSession(t, "other@example.com")
+
+	res, err := e.srv.ListUserSessions(ctx, &authPb.ListUserSessionsReq{UserEmail: "user@example.com", Limit: 2})
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(res.Sessions) != 2 || res.NextCursor == "" {
+		t.Fatalf("first page = %d sessions, cursor %q; want 2 and a cursor", len(res.Sessions), res.NextCursor)
+	}
+
+	next, err := e.srv.ListUserSessions(ctx, &authPb.ListUserSessionsReq{UserEmail: "user@example.com", Limit: 2, Cursor: res.NextCursor})
+	if err != nil {
+		t.Fatalf("ListUserSessions page 2: %v", err)
+	}
+	if len(next.Sessions) != 1 || next.NextCursor != "" {
+		t.Errorf("second page = %d sessions, cursor %q; want 1 and no cursor", len(next.Sessions), next.NextCursor)
+	}
+}
+
+// stubVerifier UserVerifier с фиксированным набором пользователей
+type stubVerifier struct {
+	passwords map[string]string
+	users     map[string]*db.GetUserRes
+	err       error // Ошибка сервиса пользователей, если задана
+}
+
+func (v *stubVerifier) VerifyCredentials(ctx context.Context, email, password string) (*db.GetUserRes, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	if want, ok := v.passwords[email]; !ok || want != password {
+		return nil, ErrInvalidCredentials
+	}
+	return v.users[email], nil
+}
+
+func newStubVerifier() *stubVerifier {
+	return &stubVerifier{
+		passwords: map[string]string{
+			"admin@example.com": "admin-password",
+			"user@example.com":  "user-password",
+		},
+		users: map[string]*db.GetUserRes{
+			"admin@example.com": {Name: "Admin", Email: "admin@example.com", IsAdmin: true},
+			"user@example.com":  {Name: "User", Email: "user@example.com"},
+		},
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	verifier := newStubVerifier()
+	e := newTestEnv(t, WithUserVerifier(verifier))
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		req      *authPb.LoginUserReq
+		want     codes.Code
+		wantRole bool
+	}{
+		{"admin", &authPb.LoginUserReq{Email: "admin@example.com", Password: "admin-password"}, codes.OK, true},
+		{"user", &authPb.LoginUserReq{Email: "user@example.com", Password: "user-password"}, codes.OK, false},
+		{"wrong password", &authPb.LoginUserReq{Email: "user@example.com", Password: "nope"}, codes.Unauthenticated, false},
+		{"unknown user", &authPb.LoginUserReq{Email: "ghost@example.com", Password: "nope"}, codes.Unauthenticated, false},
+		{"missing password", &authPb.LoginUserReq{Email: "user@example.com"}, codes.InvalidArgument, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := e.srv.LoginUser(ctx, tt.req)
+			wantCode(t, err, tt.want)
+			if tt.want != codes.OK {
+				return
+			}
+
+			payload, err := e.maker.VerifyToken(res.AccessToken)
+			if err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+			if payload.IsAdmin != tt.wantRole {
+				t.Errorf("access token is_admin = %v, want %v", payload.IsAdmin, tt.wantRole)
+			}
+
+			session, err := e.store.GetSession(ctx, res.SessionId)
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			if session.IsAdmin != tt.wantRole {
+				t.Errorf("session is_admin = %v, want %v", session.IsAdmin, tt.wantRole)
+			}
+		})
+	}
+
+	t.Run("verifier unavailable", func(t *testing.T) {
+		e := newTestEnv(t, WithUserVerifier(&stubVerifier{err: fmt.Errorf("connection refused")}))
+		_, err := e.srv.LoginUser(ctx, &authPb.LoginUserReq{Email: "user@example.com", Password: "user-password"})
+		wantCode(t, err, codes.Unavailable)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := newTestEnv(t).srv.LoginUser(ctx, &authPb.LoginUserReq{Email: "user@example.com", Password: "user-password"})
+		wantCode(t, err, codes.Unimplemented)
+	})
+}
+
+func TestRenewAccessTokenKeepsAdminRights(t *testing.T) {
+	e := newTestEnv(t, WithUserVerifier(newStubVerifier()))
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		email, password string
+		wantAdmin       bool
+	}{
+		{"admin@example.com", "admin-password", true},
+		{"user@example.com", "user-password", false},
+	} {
+		login, err := e.srv.LoginUser(ctx, &authPb.LoginUserReq{Email: tt.email, Password: tt.password})
+		if err != nil {
+			t.Fatalf("LoginUser(%s): %v", tt.email, err)
+		}
+
+		renewed, err := e.srv.RenewAccessToken(ctx, &authPb.RenewAccessTokenReq{
+			SessionId:          login.SessionId,
+			RefreshToken:       login.RefreshToken,
+			RotateRefreshToken: true,
+		})
+		if err != nil {
+			t.Fatalf("RenewAccessToken(%s): %v", tt.email, err)
+		}
+
+		payload, err := e.maker.VerifyToken(renewed.AccessToken)
+		if err != nil {
+			t.Fatalf("VerifyToken: %v", err)
+		}
+		if payload.IsAdmin != tt.wantAdmin {
+			t.Errorf("%s: renewed access token is_admin = %v, want %v", tt.email, payload.IsAdmin, tt.wantAdmin)
+		}
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	const email = "user@example.com"
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, e *testEnv, res *authPb.SessionRes) string
+		want       codes.Code
+		wantReason string
+	}{
+		{
+			name: "valid",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				return e.accessToken(t, email, res.Id, time.Minute)
+			},
+			want: codes.OK,
+		},
+		{
+			name: "expired token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				return e.accessToken(t, email, res.Id, -time.Minute)
+			},
+			want:       codes.Unauthenticated,
+			wantReason: reasonTokenExpired,
+		},
+		{
+			name: "tampered signature",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				tok := e.accessToken(t, email, res.Id, time.Minute)
+				return tok[:len(tok)-2] + "xx"
+			},
+			want:       codes.Unauthenticated,
+			wantReason: reasonTokenInvalid,
+		},
+		{
+			name: "revoked session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				if err := e.store.RevokeSession(context.Background(), res.Id, db.RevokeReasonLogout); err != nil {
+					t.Fatalf("RevokeSession: %v", err)
+				}
+				return e.accessToken(t, email, res.Id, time.Minute)
+			},
+			want:       codes.Unauthenticated,
+			wantReason: reasonSessionRevoked,
+		},
+		{
+			name: "blacklisted refresh token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				if err := e.store.BlacklistToken(context.Background(), res.RefreshToken, time.Hour); err != nil {
+					t.Fatalf("BlacklistToken: %v", err)
+				}
+				return e.accessToken(t, email, res.Id, time.Minute)
+			},
+			want:       codes.Unauthenticated,
+			wantReason: reasonSessionRevoked,
+		},
+		{
+			name: "deleted session",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				if err := e.store.DeleteSession(context.Background(), res.Id); err != nil {
+					t.Fatalf("DeleteSession: %v", err)
+				}
+				return e.accessToken(t, email, res.Id, time.Minute)
+			},
+			want:       codes.Unauthenticated,
+			wantReason: reasonSessionNotFound,
+		},
+		{
+			name: "missing token",
+			setup: func(t *testing.T, e *testEnv, res *authPb.SessionRes) string {
+				return ""
+			},
+			want: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			res := e.createSession(t, email)
+
+			got, err := e.srv.ValidateToken(context.Background(), &authPb.ValidateTokenReq{Token: tt.setup(t, e, res)})
+			wantCode(t, err, tt.want)
+			if reason := errorReason(err); reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			if tt.want != codes.OK {
+				return
+			}
+
+			if got.Email != email || got.SessionId != res.Id || got.IsAdmin {
+				t.Errorf("ValidateToken = %+v, want %s, session %s, not admin", got, email, res.Id)
+			}
+		})
+	}
+}
+
+// auditRecorder AuditLogger, запоминающий события
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (r *auditRecorder) RecordRevocation(ctx context.Context, event AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestServerUsesClock(t *testing.T) {
+	audit := &auditRecorder{}
+	e := newTestEnv(t, WithAuditLogger(audit))
+	ctx := context.Background()
+	created := e.createSession(t, "user@example.com")
+
+	const sessionTTL = 7 * 24 * time.Hour
+	if got := created.ExpiresInSeconds; got != int64(sessionTTL/time.Second) {
+		t.Errorf("expires_in_seconds at creation = %d, want %d", got, int64(sessionTTL/time.Second))
+	}
+
+	e.clock.Advance(time.Hour)
+	got, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if want := int64((sessionTTL - time.Hour) / time.Second); got.ExpiresInSeconds != want {
+		t.Errorf("expires_in_seconds after an hour = %d, want %d", got.ExpiresInSeconds, want)
+	}
+
+	// Access токен истекает ровно через AccessTokenTTLMins по часам сервиса
+	accessToken := e.accessToken(t, "user@example.com", created.Id, 15*time.Minute)
+	e.clock.Advance(15*time.Minute - time.Second)
+	if _, err := e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: accessToken}); err != nil {
+		t.Fatalf("ValidateToken before expiry: %v", err)
+	}
+	e.clock.Advance(time.Second)
+	_, err = e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: accessToken})
+	wantCode(t, err, codes.Unauthenticated)
+	if reason := errorReason(err); reason != reasonTokenExpired {
+		t.Errorf("reason = %q, want %q", reason, reasonTokenExpired)
+	}
+
+	if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if len(audit.events) != 1 || !audit.events[0].Time.Equal(e.clock.Now()) {
+		t.Errorf("audit events = %+v, want one event at %s", audit.events, e.clock.Now())
+	}
+}
+
+// outageStore хранилище, которое можно "отключить": чтение возвращает ошибку соединения
+type outageStore struct {
+	db.SessionStorage
+	down bool
+}
+
+var errStoreOutage = errors.New("redis: connection refused")
+
+func (s *outageStore) GetSession(ctx context.Context, id string) (*db.Session, error) {
+	if s.down {
+		return nil, errStoreOutage
+	}
+	return s.SessionStorage.GetSession(ctx, id)
+}
+
+func (s *outageStore) IsSessionValid(ctx context.Context, id string) (bool, string, error) {
+	if s.down {
+		return false, "", errStoreOutage
+	}
+	return s.SessionStorage.IsSessionValid(ctx, id)
+}
+
+func TestValidateTokenDuringStoreOutage(t *testing.T) {
+	e := newTestEnv(t)
+	backend := &outageStore{SessionStorage: e.store}
+	e.srv.storer = db.NewCachedStore(backend, 16, time.Hour, db.WithClock(e.clock))
+	ctx := context.Background()
+
+	cached := e.createSession(t, "user@example.com")
+	cachedToken := e.accessToken(t, "user@example.com", cached.Id, time.Minute)
+	if _, err := e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: cachedToken}); err != nil {
+		t.Fatalf("ValidateToken before outage: %v", err)
+	}
+
+	unknownToken := e.accessToken(t, "user@example.com", "never-seen", time.Minute)
+
+	backend.down = true
+
+	res, err := e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: cachedToken})
+	if err != nil {
+		t.Fatalf("ValidateToken of a cached session during outage: %v", err)
+	}
+	if res.SessionId != cached.Id {
+		t.Errorf("session_id = %s, want %s", res.SessionId, cached.Id)
+	}
+
+	_, err = e.srv.ValidateToken(ctx, &authPb.ValidateTokenReq{Token: unknownToken})
+	wantCode(t, err, codes.Unauthenticated)
+}
+
+func TestBatchCreateSessionsRateLimit(t *testing.T) {
+	e := newTestEnv(t)
+	conf := testConfig()
+	conf.Service.CreateRateLimit = 2
+	conf.Service.CreateRateWindow = time.Minute
+	e.srv.SetConfig(conf)
+	ctx := context.Background()
+
+	if _, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com"}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	res, err := e.srv.BatchCreateSessions(ctx, &authPb.BatchCreateSessionsReq{Sessions: []*authPb.SessionReq{
+		{UserEmail: "user@example.com"},
+		{UserEmail: "user@example.com"},
+		{UserEmail: "other@example.com"},
+		{UserEmail: "user@example.com"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateSessions: %v", err)
+	}
+
+	// Одна сессия user@example.com уже создана, в лимит помещается еще одна
+	wantCodes := []codes.Code{codes.OK, codes.ResourceExhausted, codes.OK, codes.ResourceExhausted}
+	for i, result := range res.Results {
+		if got := codes.Code(result.Code); got != wantCodes[i] {
+			t.Errorf("result %d code = %s, want %s (%s)", i, got, wantCodes[i], result.Error)
+		}
+		if (result.Session != nil) != (wantCodes[i] == codes.OK) {
+			t.Errorf("result %d session = %v, want set only on success", i, result.Session)
+		}
+	}
+	if res.CreatedCount != 2 {
+		t.Errorf("created_count = %d, want 2", res.CreatedCount)
+	}
+
+	sessions, err := e.store.GetSessionsByEmail(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("GetSessionsByEmail: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("user@example.com has %d sessions, want 2", len(sessions))
+	}
+}
+
+func TestBatchGetSessions(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	first := e.createSession(t, "user@example.com")
+	second := e.createSession(t, "user@example.com")
+
+	res, err := e.srv.BatchGetSessions(ctx, &authPb.BatchGetSessionsReq{
+		Ids: []string{first.Id, "missing", second.Id, first.Id},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetSessions: %v", err)
+	}
+	if len(res.Sessions) != 2 || res.Sessions[first.Id] == nil || res.Sessions[second.Id] == nil {
+		t.Errorf("BatchGetSessions = %v, want sessions %s and %s", res.Sessions, first.Id, second.Id)
+	}
+
+	_, err = e.srv.BatchGetSessions(ctx, &authPb.BatchGetSessionsReq{})
+	wantCode(t, err, codes.InvalidArgument)
+
+	ids := make([]string, maxBatchSize+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("s%d", i)
+	}
+	_, err = e.srv.BatchGetSessions(ctx, &authPb.BatchGetSessionsReq{Ids: ids})
+	wantCode(t, err, codes.InvalidArgument)
+
+	// Дубликаты не учитываются в лимите
+	dups := make([]string, maxBatchSize+1)
+	for i := range dups {
+		dups[i] = first.Id
+	}
+	if _, err := e.srv.BatchGetSessions(ctx, &authPb.BatchGetSessionsReq{Ids: dups}); err != nil {
+		t.Errorf("BatchGetSessions with duplicate ids: %v", err)
+	}
+}
+
+// useRedisStore переключает сервер на RedisStore поверх miniredis с часами окружения
+func (e *testEnv) useRedisStore(t *testing.T) (*db.RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	store, err := db.NewRedisStore("redis://"+mr.Addr(), context.Background(), db.WithClock(e.clock))
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	e.srv.storer = store
+	return store, mr
+}
+
+func TestRevokeSessionPublishesEvent(t *testing.T) {
+	e := newTestEnv(t)
+	store, _ := e.useRedisStore(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := store.SubscribeRevocations(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeRevocations: %v", err)
+	}
+
+	created := e.createSession(t, "user@example.com")
+	if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.SessionId != created.Id || event.UserEmail != "user@example.com" || event.Reason != "revoke" {
+			t.Errorf("revocation event = %+v, want session %s of user@example.com with reason revoke", event, created.Id)
+		}
+		if event.RefreshToken == "" || event.RefreshToken == created.RefreshToken {
+			t.Errorf("event refresh token = %q, want the token hash", event.RefreshToken)
+		}
+	case <-ctx.Done():
+		t.Fatal("no revocation event received")
+	}
+}
+
+func TestStoreConnectionFailureIsInternal(t *testing.T) {
+	e := newTestEnv(t)
+	_, mr := e.useRedisStore(t)
+	ctx := context.Background()
+
+	created := e.createSession(t, "user@example.com")
+
+	_, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: "missing"})
+	wantCode(t, err, codes.NotFound)
+
+	mr.Close()
+
+	calls := map[string]func() error{
+		"GetSession": func() error {
+			_, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+			return err
+		},
+		"RevokeSession": func() error {
+			_, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id})
+			return err
+		},
+		"DeleteSession": func() error {
+			_, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: created.Id})
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			wantCode(t, call(), codes.Internal)
+		})
+	}
+}
+
+func TestInvalidArgumentFieldViolations(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		call  func() error
+		field string
+	}{
+		{"CreateSession without email", func() error {
+			_, err := e.srv.CreateSession(ctx, &authPb.SessionReq{})
+			return err
+		}, "user_email"},
+		{"CreateSession with invalid email", func() error {
+			_, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "not-an-email"})
+			return err
+		}, "user_email"},
+		{"CreateSession with id only", func() error {
+			_, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com", Id: "c6a1c9f4-9a57-4d0e-8d8a-7c1f0c7c2b1e"})
+			return err
+		}, "refresh_token"},
+		{"GetSession", func() error {
+			_, err := e.srv.GetSession(ctx, &authPb.SessionReq{})
+			return err
+		}, "id"},
+		{"RevokeSession", func() error {
+			_, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{})
+			return err
+		}, "id"},
+		{"DeleteSession", func() error {
+			_, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{})
+			return err
+		}, "id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			wantCode(t, err, codes.InvalidArgument)
+			if got := violatedField(err); got != tt.field {
+				t.Errorf("violated field = %q, want %q", got, tt.field)
+			}
+		})
+	}
+}
+
+// newHungRedis запускает TCP сервер, который отвечает только на PING при подключении,
+// а остальные команды оставляет без ответа, как зависший Redis
+func newHungRedis(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		lis.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			go func() {
+				buf := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if strings.Contains(strings.ToLower(string(buf[:n])), "ping") {
+						conn.Write([]byte("+PONG\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func TestStoreTimeoutIsDeadlineExceeded(t *testing.T) {
+	addr := newHungRedis(t)
+
+	tests := []struct {
+		name    string
+		opts    []db.Option
+		timeout time.Duration
+	}{
+		{"store op timeout", []db.Option{db.WithOpTimeout(50 * time.Millisecond)}, 0},
+		{"caller deadline", nil, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			store, err := db.NewRedisStore("redis://"+addr, context.Background(), tt.opts...)
+			if err != nil {
+				t.Fatalf("NewRedisStore: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			e.srv.storer = store
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err = e.srv.GetSession(ctx, &authPb.SessionReq{Id: "s1"})
+			wantCode(t, err, codes.DeadlineExceeded)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("GetSession returned after %s, want about the timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestDeleteSessionIsIdempotent(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	res, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: "never-existed"})
+	if err != nil {
+		t.Fatalf("DeleteSession of a never existing ID: %v", err)
+	}
+	if res.Id != "never-existed" || res.UserEmail != "" {
+		t.Errorf("DeleteSession = %+v, want an empty response with the requested ID", res)
+	}
+
+	created := e.createSession(t, "user@example.com")
+	res, err = e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: created.Id})
+	if err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if res.UserEmail != "user@example.com" {
+		t.Errorf("DeleteSession user_email = %q, want the last known state", res.UserEmail)
+	}
+
+	if _, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Errorf("second DeleteSession: %v", err)
+	}
+}
+
+func TestUpdateSessionLabel(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	created, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com", Label: "My iPhone"})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if created.Label != "My iPhone" {
+		t.Errorf("created label = %q, want My iPhone", created.Label)
+	}
+
+	renamed, err := e.srv.UpdateSessionLabel(ctx, &authPb.UpdateSessionLabelReq{Id: created.Id, Label: "Work laptop"})
+	if err != nil {
+		t.Fatalf("UpdateSessionLabel: %v", err)
+	}
+	if renamed.Label != "Work laptop" {
+		t.Errorf("renamed label = %q, want Work laptop", renamed.Label)
+	}
+
+	_, err = e.srv.UpdateSessionLabel(ctx, &authPb.UpdateSessionLabelReq{Id: created.Id, Label: strings.Repeat("x", db.MaxSessionLabelLength+1)})
+	wantCode(t, err, codes.InvalidArgument)
+
+	_, err = e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com", Label: strings.Repeat("x", db.MaxSessionLabelLength+1)})
+	wantCode(t, err, codes.InvalidArgument)
+
+	if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	_, err = e.srv.UpdateSessionLabel(ctx, &authPb.UpdateSessionLabelReq{Id: created.Id, Label: "Stolen"})
+	wantCode(t, err, codes.FailedPrecondition)
+}
+
+// watchStream поток WatchUserSessions, передающий отправленные обновления в канал
+type watchStream struct {
+	contextStream
+	updates chan *authPb.SessionUpdate
+}
+
+func (s watchStream) Send(update *authPb.SessionUpdate) error {
+	s.updates <- update
+	return nil
+}
+
+func TestWatchUserSessionsReceivesRevocation(t *testing.T) {
+	e := newTestEnv(t)
+	e.useRedisStore(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := watchStream{contextStream: contextStream{ctx: ctx}, updates: make(chan *authPb.SessionUpdate, 4)}
+	done := make(chan error, 1)
+	go func() {
+		done <- e.srv.WatchUserSessions(&authPb.WatchUserSessionsReq{UserEmail: "user@example.com"}, stream)
+	}()
+
+	next := func() *authPb.SessionUpdate {
+		t.Helper()
+		select {
+		case update := <-stream.updates:
+			return update
+		case <-ctx.Done():
+			t.Fatal("no session update received")
+			return nil
+		}
+	}
+
+	// У пользователя еще нет сессий
+	if snapshot := next(); snapshot.Reason != "snapshot" || len(snapshot.Sessions) != 0 {
+		t.Fatalf("snapshot = %v, want an empty snapshot", snapshot)
+	}
+
+	created := e.createSession(t, "user@example.com")
+	other := e.createSession(t, "other@example.com")
+
+	// Отзыв чужой сессии в поток не попадает
+	for _, id := range []string{other.Id, created.Id} {
+		if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: id}); err != nil {
+			t.Fatalf("RevokeSession(%s): %v", id, err)
+		}
+	}
+
+	update := next()
+	if update.Reason != "revoke" || update.SessionId != created.Id {
+		t.Fatalf("update = reason %q session %q, want revoke of %s", update.Reason, update.SessionId, created.Id)
+	}
+	if len(update.Sessions) != 0 {
+		t.Errorf("update sessions = %v, want no active sessions after the revoke", update.Sessions)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("WatchUserSessions after cancel: %v", err)
+	}
+}
+
+func TestAuditRecordsEachRevocation(t *testing.T) {
+	audit := &auditRecorder{}
+	e := newTestEnv(t, WithAuditLogger(audit))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(actorHeader, "support@example.com", auditReasonHeader, "ticket-42"))
+
+	revoked := e.createSession(t, "user@example.com")
+	deleted := e.createSession(t, "user@example.com")
+	e.createSession(t, "other@example.com")
+	e.createSession(t, "other@example.com")
+
+	// Повторные вызовы ничего не меняют и в аудит не попадают
+	for i := 0; i < 2; i++ {
+		if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: revoked.Id}); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		if _, err := e.srv.DeleteSession(ctx, &authPb.SessionReq{Id: deleted.Id}); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+	}
+	if _, err := e.srv.RevokeAllUserSessions(ctx, &authPb.RevokeAllUserSessionsReq{UserEmail: "other@example.com", DryRun: true}); err != nil {
+		t.Fatalf("RevokeAllUserSessions dry run: %v", err)
+	}
+	if _, err := e.srv.RevokeAllUserSessions(ctx, &authPb.RevokeAllUserSessionsReq{UserEmail: "other@example.com"}); err != nil {
+		t.Fatalf("RevokeAllUserSessions: %v", err)
+	}
+
+	want := []AuditEvent{
+		{Action: AuditActionRevoke, SessionID: revoked.Id, UserEmail: "user@example.com", Count: 1},
+		{Action: AuditActionDelete, SessionID: deleted.Id, UserEmail: "user@example.com", Count: 1},
+		{Action: AuditActionRevokeAll, UserEmail: "other@example.com", Count: 2},
+	}
+	if len(audit.events) != len(want) {
+		t.Fatalf("audit events = %+v, want %d events", audit.events, len(want))
+	}
+	for i, event := range audit.events {
+		w := want[i]
+		if event.Action != w.Action || event.SessionID != w.SessionID || event.UserEmail != w.UserEmail || event.Count != w.Count {
+			t.Errorf("audit event %d = %+v, want %+v", i, event, w)
+		}
+		if event.Actor != "support@example.com" || event.Reason != "ticket-42" {
+			t.Errorf("audit event %d actor %q reason %q, want them from metadata", i, event.Actor, event.Reason)
+		}
+	}
+}
+
+func TestRevokeAllUserSessionsDryRun(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	created := []string{e.createSession(t, "user@example.com").Id, e.createSession(t, "user@example.com").Id}
+	sort.Strings(created)
+
+	dryRun, err := e.srv.RevokeAllUserSessions(ctx, &authPb.RevokeAllUserSessionsReq{UserEmail: "user@example.com", DryRun: true})
+	if err != nil {
+		t.Fatalf("RevokeAllUserSessions dry run: %v", err)
+	}
+	if !dryRun.DryRun || dryRun.RevokedCount != 2 {
+		t.Errorf("dry run = %+v, want dry_run with 2 sessions", dryRun)
+	}
+	count, err := e.srv.CountUserSessions(ctx, &authPb.CountUserSessionsReq{UserEmail: "user@example.com"})
+	if err != nil {
+		t.Fatalf("CountUserSessions: %v", err)
+	}
+	if count.Count != 2 {
+		t.Errorf("active sessions after dry run = %d, want 2", count.Count)
+	}
+
+	res, err := e.srv.RevokeAllUserSessions(ctx, &authPb.RevokeAllUserSessionsReq{UserEmail: "user@example.com"})
+	if err != nil {
+		t.Fatalf("RevokeAllUserSessions: %v", err)
+	}
+	if res.DryRun || res.RevokedCount != dryRun.RevokedCount {
+		t.Errorf("revoke = %+v, want the dry run count %d", res, dryRun.RevokedCount)
+	}
+
+	for name, ids := range map[string][]string{"dry run": dryRun.SessionIds, "revoke": res.SessionIds} {
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != fmt.Sprint(created) {
+			t.Errorf("%s session ids = %v, want %v", name, ids, created)
+		}
+	}
+}
+
+func TestCreateSessionTTLOverride(t *testing.T) {
+	const defaultTTL = 7 * 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		maxTTL     time.Duration
+		ttlSeconds int64
+		want       time.Duration
+		wantCode   codes.Code
+	}{
+		{"default", 30 * 24 * time.Hour, 0, defaultTTL, codes.OK},
+		{"within bounds", 30 * 24 * time.Hour, 3600, time.Hour, codes.OK},
+		{"at max", 30 * 24 * time.Hour, 30 * 24 * 3600, 30 * 24 * time.Hour, codes.OK},
+		{"below min", 30 * 24 * time.Hour, 30, 0, codes.InvalidArgument},
+		{"above max", 30 * 24 * time.Hour, 30*24*3600 + 1, 0, codes.InvalidArgument},
+		{"negative", 30 * 24 * time.Hour, -3600, 0, codes.InvalidArgument},
+		{"override disabled", 0, 3600, 0, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			conf := testConfig()
+			conf.Service.MinSessionTTL = time.Minute
+			conf.Service.MaxSessionTTL = tt.maxTTL
+			e.srv.SetConfig(conf)
+
+			res, err := e.srv.CreateSession(context.Background(), &authPb.SessionReq{UserEmail: "user@example.com", TtlSeconds: tt.ttlSeconds})
+			wantCode(t, err, tt.wantCode)
+			if tt.wantCode != codes.OK {
+				if field := violatedField(err); field != "ttl_seconds" {
+					t.Errorf("violated field = %q, want ttl_seconds", field)
+				}
+				return
+			}
+
+			if got := res.ExpiresAt.AsTime().Sub(e.clock.Now()); got != tt.want {
+				t.Errorf("session ttl = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeReasonRoundTrip(t *testing.T) {
+	reasons := []authPb.RevokeReason{
+		authPb.RevokeReason_REVOKE_REASON_UNSPECIFIED,
+		authPb.RevokeReason_REVOKE_REASON_LOGOUT,
+		authPb.RevokeReason_REVOKE_REASON_PASSWORD_CHANGE,
+		authPb.RevokeReason_REVOKE_REASON_ADMIN,
+		authPb.RevokeReason_REVOKE_REASON_COMPROMISED,
+	}
+
+	e := newTestEnv(t)
+	e.useRedisStore(t)
+	ctx := context.Background()
+
+	for _, reason := range reasons {
+		t.Run(reason.String(), func(t *testing.T) {
+			created := e.createSession(t, "user@example.com")
+			if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: created.Id, RevokeReason: reason}); err != nil {
+				t.Fatalf("RevokeSession: %v", err)
+			}
+
+			got, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			if !got.IsRevoked || got.RevokedReason != reason {
+				t.Errorf("GetSession = revoked %v reason %s, want revoked with %s", got.IsRevoked, got.RevokedReason, reason)
+			}
+		})
+	}
+
+	t.Run("RevokeAllUserSessions", func(t *testing.T) {
+		created := e.createSession(t, "other@example.com")
+		_, err := e.srv.RevokeAllUserSessions(ctx, &authPb.RevokeAllUserSessionsReq{
+			UserEmail: "other@example.com",
+			Reason:    authPb.RevokeReason_REVOKE_REASON_PASSWORD_CHANGE,
+		})
+		if err != nil {
+			t.Fatalf("RevokeAllUserSessions: %v", err)
+		}
+
+		got, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if got.RevokedReason != authPb.RevokeReason_REVOKE_REASON_PASSWORD_CHANGE {
+			t.Errorf("revoked reason = %s, want %s", got.RevokedReason, authPb.RevokeReason_REVOKE_REASON_PASSWORD_CHANGE)
+		}
+	})
+}
+
+func TestReadResponsesOmitRefreshToken(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	created := e.createSession(t, "user@example.com")
+	if created.RefreshToken == "" {
+		t.Fatal("CreateSession response has no refresh token")
+	}
+
+	reads := map[string]func() ([]*authPb.SessionRes, error){
+		"GetSession": func() ([]*authPb.SessionRes, error) {
+			res, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+			return []*authPb.SessionRes{res}, err
+		},
+		"GetSessionByRefreshToken": func() ([]*authPb.SessionRes, error) {
+			res, err := e.srv.GetSessionByRefreshToken(ctx, &authPb.GetSessionByRefreshTokenReq{RefreshToken: created.RefreshToken})
+			return []*authPb.SessionRes{res}, err
+		},
+		"GetSessionByEmail": func() ([]*authPb.SessionRes, error) {
+			res, err := e.srv.GetSessionByEmail(ctx, &authPb.GetSessionByEmailReq{UserEmail: "user@example.com"})
+			if err != nil {
+				return nil, err
+			}
+			return res.Sessions, nil
+		},
+		"ListUserSessions": func() ([]*authPb.SessionRes, error) {
+			res, err := e.srv.ListUserSessions(ctx, &authPb.ListUserSessionsReq{UserEmail: "user@example.com"})
+			if err != nil {
+				return nil, err
+			}
+			return res.Sessions, nil
+		},
+	}
+
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			sessions, err := read()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if len(sessions) != 1 {
+				t.Fatalf("%s returned %d sessions, want 1", name, len(sessions))
+			}
+			if sessions[0].RefreshToken != "" {
+				t.Errorf("%s refresh_token = %q, want empty", name, sessions[0].RefreshToken)
+			}
+		})
+	}
+}
+
+func TestSessionMetadata(t *testing.T) {
+	t.Run("size cap", func(t *testing.T) {
+		full := make(map[string]string, db.MaxSessionMetadataKeys)
+		for i := 0; i < db.MaxSessionMetadataKeys; i++ {
+			full[fmt.Sprintf("key%d", i)] = strings.Repeat("v", db.MaxSessionMetadataValueLength)
+		}
+
+		tests := []struct {
+			name     string
+			metadata map[string]string
+			want     codes.Code
+		}{
+			{"at the limits", full, codes.OK},
+			{"too many keys", tooManyMetadata(), codes.InvalidArgument},
+			{"value too long", map[string]string{"tenant": strings.Repeat("v", db.MaxSessionMetadataValueLength+1)}, codes.InvalidArgument},
+			{"key too long", map[string]string{strings.Repeat("k", db.MaxSessionMetadataKeyLength+1): "acme"}, codes.InvalidArgument},
+			{"empty key", map[string]string{"": "acme"}, codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				e := newTestEnv(t)
+				_, err := e.srv.CreateSession(context.Background(), &authPb.SessionReq{UserEmail: "user@example.com", Metadata: tt.metadata})
+				wantCode(t, err, tt.want)
+				if tt.want != codes.OK && violatedField(err) != "metadata" {
+					t.Errorf("violated field = %q, want metadata", violatedField(err))
+				}
+			})
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.useRedisStore(t)
+		ctx := context.Background()
+
+		metadata := map[string]string{"tenant": "acme", "roles": "admin,support", "note": "Пользователь из \"support\""}
+		created, err := e.srv.CreateSession(ctx, &authPb.SessionReq{UserEmail: "user@example.com", Metadata: metadata})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		got, err := e.srv.GetSession(ctx, &authPb.SessionReq{Id: created.Id})
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if !reflect.DeepEqual(got.Metadata, metadata) {
+			t.Errorf("metadata = %v, want %v", got.Metadata, metadata)
+		}
+
+		list, err := e.srv.ListUserSessions(ctx, &authPb.ListUserSessionsReq{UserEmail: "user@example.com"})
+		if err != nil {
+			t.Fatalf("ListUserSessions: %v", err)
+		}
+		if len(list.Sessions) != 1 || !reflect.DeepEqual(list.Sessions[0].Metadata, metadata) {
+			t.Errorf("ListUserSessions metadata = %v, want %v", list.Sessions, metadata)
+		}
+	})
+}
+
+func TestCheckBlacklistMixedTokens(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	revoked := e.createSession(t, "user@example.com")
+	clean := e.createSession(t, "user@example.com")
+	if _, err := e.srv.RevokeSession(ctx, &authPb.SessionReq{Id: revoked.Id}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	res, err := e.srv.CheckBlacklist(ctx, &authPb.CheckBlacklistReq{
+		RefreshTokens: []string{revoked.RefreshToken, clean.RefreshToken, "unknown", revoked.RefreshToken, ""},
+	})
+	if err != nil {
+		t.Fatalf("CheckBlacklist: %v", err)
+	}
+	want := map[string]bool{
+		revoked.RefreshToken: true,
+		clean.RefreshToken:   false,
+		"unknown":            false,
+	}
+	if !reflect.DeepEqual(res.Blacklisted, want) {
+		t.Errorf("CheckBlacklist = %v, want %v", res.Blacklisted, want)
+	}
+
+	_, err = e.srv.CheckBlacklist(ctx, &authPb.CheckBlacklistReq{RefreshTokens: []string{"", ""}})
+	wantCode(t, err, codes.InvalidArgument)
+
+	tooMany := make([]string, maxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("token-%d", i)
+	}
+	_, err = e.srv.CheckBlacklist(ctx, &authPb.CheckBlacklistReq{RefreshTokens: tooMany})
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+func TestCreateSessionRejectsBadExpiry(t *testing.T) {
+	e := newTestEnv(t)
+	now := e.clock.Now()
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+	}{
+		{"past", now.Add(-time.Minute)},
+		{"now", now},
+		{"far future", now.Add(db.MaxSessionLifetime + time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.srv.CreateSession(context.Background(), &authPb.SessionReq{
+				UserEmail: "user@example.com",
+				ExpiresAt: timestamppb.New(tt.expiresAt),
+			})
+			wantCode(t, err, codes.InvalidArgument)
+			if field := violatedField(err); field != "expires_at" {
+				t.Errorf("violated field = %q, want expires_at", field)
+			}
+		})
+	}
+
+	// Допустимое значение проходит проверку, но срок по-прежнему задает сервер
+	res, err := e.srv.CreateSession(context.Background(), &authPb.SessionReq{
+		UserEmail: "user@example.com",
+		ExpiresAt: timestamppb.New(now.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("CreateSession with a valid expiry: %v", err)
+	}
+	ttl, err := e.srv.sessionTTL(0)
+	if err != nil {
+		t.Fatalf("sessionTTL: %v", err)
+	}
+	if got, want := res.ExpiresAt.AsTime(), now.Add(ttl); !got.Equal(want) {
+		t.Errorf("ExpiresAt = %s, want the server TTL %s", got, want)
+	}
+}
+
+func TestImpersonateUser(t *testing.T) {
+	audit := &auditRecorder{}
+	e := newTestEnv(t, WithAuditLogger(audit))
+	ctx := context.Background()
+
+	adminSession := e.createSession(t, "admin@example.com")
+	adminToken, _, err := e.maker.CreateToken("admin@example.com", true, adminSession.Id, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	res, err := e.srv.ImpersonateUser(ctx, &authPb.ImpersonateUserReq{
+		AdminToken:  adminToken,
+		TargetEmail: "User@Example.com",
+		Reason:      "ticket-42",
+	})
+	if err != nil {
+		t.Fatalf("ImpersonateUser: %v", err)
+	}
+
+	session, err := e.store.GetSession(ctx, res.SessionId)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if session.UserEmail != "user@example.com" || !session.Impersonated || session.ImpersonatedBy != "admin@example.com" {
+		t.Errorf("session = %s impersonated %v by %q, want user@example.com impersonated by admin@example.com",
+			session.UserEmail, session.Impersonated, session.ImpersonatedBy)
+	}
+	// Срок короче обычной сессии независимо от конфигурации
+	if want := e.clock.Now().Add(impersonationTTL); !session.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %s, want %s", session.ExpiresAt, want)
+	}
+
+	payload, err := e.maker.VerifyToken(res.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if payload.Email != "user@example.com" || payload.IsAdmin || payload.SessionID != res.SessionId {
+		t.Errorf("access token = %s admin %v session %s, want a non-admin token of the new session", payload.Email, payload.IsAdmin, payload.SessionID)
+	}
+
+	audit.mu.Lock()
+	events := append([]AuditEvent(nil), audit.events...)
+	audit.mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("audit events = %+v, want one", events)
+	}
+	if got := events[0]; got.Action != AuditActionImpersonate || got.SessionID != res.SessionId ||
+		got.UserEmail != "user@example.com" || got.Actor != "admin@example.com" || got.Reason != "ticket-42" {
+		t.Errorf("audit event = %+v, want impersonate of user@example.com by admin@example.com", got)
+	}
+
+	// Токен обычного пользователя не дает права входа от чужого имени
+	userToken := e.accessToken(t, "user@example.com", res.SessionId, time.Minute)
+	_, err = e.srv.ImpersonateUser(ctx, &authPb.ImpersonateUserReq{AdminToken: userToken, TargetEmail: "other@example.com"})
+	wantCode(t, err, codes.PermissionDenied)
+
+	if sessions, err := e.store.GetSessionsByEmail(ctx, "other@example.com"); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions of other@example.com after denied impersonation = %v, %v, want none", sessions, err)
+	}
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if len(audit.events) != 1 {
+		t.Errorf("audit events after denied impersonation = %d, want 1", len(audit.events))
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	for _, email := range []string{"a@example.com", "a@example.com", "a@example.com", "b@example.com", "c@example.com", "c@example.com"} {
+		e.createSession(t, email)
+	}
+
+	res, err := e.srv.GetStats(ctx, &authPb.GetStatsReq{})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if res.UniqueUsers != 3 || res.ActiveSessions != 6 {
+		t.Errorf("GetStats = %d users, %d sessions, want 3 users, 6 sessions", res.UniqueUsers, res.ActiveSessions)
+	}
+	if !res.SnapshotTime.AsTime().Equal(e.clock.Now()) {
+		t.Errorf("SnapshotTime = %s, want %s", res.SnapshotTime.AsTime(), e.clock.Now())
+	}
+
+	// В пределах statsCacheTTL отдается сохраненный подсчет
+	e.createSession(t, "d@example.com")
+	if res, err := e.srv.GetStats(ctx, &authPb.GetStatsReq{}); err != nil || res.UniqueUsers != 3 {
+		t.Errorf("cached GetStats = %v, %v, want 3 users", res, err)
+	}
+
+	e.clock.Advance(statsCacheTTL)
+	res, err = e.srv.GetStats(ctx, &authPb.GetStatsReq{})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if res.UniqueUsers != 4 || res.ActiveSessions != 7 {
+		t.Errorf("GetStats after cache expiry = %d users, %d sessions, want 4 users, 7 sessions", res.UniqueUsers, res.ActiveSessions)
+	}
+}
+
+func TestBlacklistTokenRPC(t *testing.T) {
+	for _, backend := range []string{"memory", "redis"} {
+		t.Run(backend, func(t *testing.T) {
+			audit := &auditRecorder{}
+			e := newTestEnv(t, WithAuditLogger(audit))
+			advance := e.clock.Advance
+			if backend == "redis" {
+				_, mr := e.useRedisStore(t)
+				advance = func(d time.Duration) {
+					e.clock.Advance(d)
+					mr.FastForward(d)
+				}
+			}
+			ctx := context.Background()
+
+			adminSession := e.createSession(t, "admin@example.com")
+			adminToken, _, err := e.maker.CreateToken("admin@example.com", true, adminSession.Id, time.Hour)
+			if err != nil {
+				t.Fatalf("CreateToken: %v", err)
+			}
+			isBlacklisted := func() bool {
+				t.Helper()
+				res, err := e.srv.CheckBlacklist(ctx, &authPb.CheckBlacklistReq{RefreshTokens: []string{"leaked"}})
+				if err != nil {
+					t.Fatalf("CheckBlacklist: %v", err)
+				}
+				return res.Blacklisted["leaked"]
+			}
+
+			// Обычный пользователь не может вносить токены в черный список
+			userSession := e.createSession(t, "user@example.com")
+			_, err = e.srv.BlacklistToken(ctx, &authPb.BlacklistTokenReq{
+				AdminToken: e.accessToken(t, "user@example.com", userSession.Id, time.Hour),
+				Token:      "leaked",
+				TtlSeconds: 60,
+			})
+			wantCode(t, err, codes.PermissionDenied)
+			if isBlacklisted() {
+				t.Fatal("token blacklisted by a non-admin")
+			}
+
+			res, err := e.srv.BlacklistToken(ctx, &authPb.BlacklistTokenReq{
+				AdminToken: adminToken,
+				Token:      "leaked",
+				TtlSeconds: 60,
+				Reason:     "incident-7",
+			})
+			if err != nil {
+				t.Fatalf("BlacklistToken: %v", err)
+			}
+			if want := e.clock.Now().Add(time.Minute); !res.ExpiresAt.AsTime().Equal(want) {
+				t.Errorf("ExpiresAt = %s, want %s", res.ExpiresAt.AsTime(), want)
+			}
+			if !isBlacklisted() {
+				t.Error("token is not blacklisted after BlacklistToken")
+			}
+
+			audit.mu.Lock()
+			events := append([]AuditEvent(nil), audit.events...)
+			audit.mu.Unlock()
+			if len(events) != 1 || events[0].Action != AuditActionBlacklist || events[0].Actor != "admin@example.com" || events[0].Reason != "incident-7" {
+				t.Errorf("audit events = %+v, want one blacklist by admin@example.com", events)
+			}
+
+			advance(59 * time.Second)
+			if !isBlacklisted() {
+				t.Error("token left the blacklist before the TTL")
+			}
+			advance(time.Second)
+			if isBlacklisted() {
+				t.Error("token is still blacklisted after the TTL")
+			}
+		})
+	}
+}
+
+func TestBlacklistTokenValidation(t *testing.T) {
+	e := newTestEnv(t)
+	adminSession := e.createSession(t, "admin@example.com")
+	adminToken, _, err := e.maker.CreateToken("admin@example.com", true, adminSession.Id, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		req       *authPb.BlacklistTokenReq
+		wantField string
+	}{
+		{"no admin token", &authPb.BlacklistTokenReq{Token: "leaked", TtlSeconds: 60}, "admin_token"},
+		{"no token", &authPb.BlacklistTokenReq{AdminToken: adminToken, TtlSeconds: 60}, "token"},
+		{"ttl too short", &authPb.BlacklistTokenReq{AdminToken: adminToken, Token: "leaked", TtlSeconds: 59}, "ttl_seconds"},
+		{"ttl too long", &authPb.BlacklistTokenReq{AdminToken: adminToken, Token: "leaked", TtlSeconds: int64(maxBlacklistTokenTTL/time.Second) + 1}, "ttl_seconds"},
+		{"ttl overflows duration", &authPb.BlacklistTokenReq{AdminToken: adminToken, Token: "leaked", TtlSeconds: 1 << 62}, "ttl_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.srv.BlacklistToken(context.Background(), tt.req)
+			wantCode(t, err, codes.InvalidArgument)
+			if field := violatedField(err); field != tt.wantField {
+				t.Errorf("violated field = %q, want %q", field, tt.wantField)
+			}
+		})
+	}
+}
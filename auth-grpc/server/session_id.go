@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// Форматы ID сессий (service_params.session_id_format)
+const (
+	SessionIDFormatUUID = "uuid"
+	SessionIDFormatULID = "ulid"
+	SessionIDFormatAny  = "any"
+)
+
+// uuidStringLength длина UUID в каноническом виде xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+const uuidStringLength = 36
+
+// newSessionID генерирует ID сессии в заданном формате; для any и пустого формата — UUID
+func newSessionID(format string) (string, error) {
+	if format == SessionIDFormatULID {
+		id, err := ulid.New(ulid.Timestamp(time.Now()), rand.Reader)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate session id: %w", err)
+		}
+		return id.String(), nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return id.String(), nil
+}
+
+// validSessionID проверяет, что переданный клиентом ID соответствует формату
+func validSessionID(format, id string) bool {
+	switch format {
+	case SessionIDFormatUUID:
+		// uuid.Parse принимает и формы с urn: и фигурными скобками
+		if len(id) != uuidStringLength {
+			return false
+		}
+		_, err := uuid.Parse(id)
+		return err == nil
+
+	case SessionIDFormatULID:
+		_, err := ulid.ParseStrict(id)
+		return err == nil
+
+	default:
+		return true
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"time"
+)
+
+// Stopper сервер, поддерживающий мягкую и принудительную остановку (например, *grpc.Server)
+type Stopper interface {
+	GracefulStop()
+	Stop()
+}
+
+// GracefulStopWithTimeout пытается мягко остановить сервер и, если за timeout
+// остановка не завершилась, останавливает его принудительно.
+// Возвращает true, если остановка прошла мягко
+func GracefulStopWithTimeout(srv Stopper, timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		// Обрываем зависшие вызовы; GracefulStop в горутине вернется сразу после Stop
+		srv.Stop()
+		<-done
+		return false
+	}
+}
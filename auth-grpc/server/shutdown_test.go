@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+)
+
+// hungServer обработчик GetSession, который не завершается сам, пока вызов не отменят
+type hungServer struct {
+	authPb.UnimplementedAuthServiceServer
+	entered chan struct{}
+}
+
+func (s *hungServer) GetSession(ctx context.Context, req *authPb.SessionReq) (*authPb.SessionRes, error) {
+	close(s.entered)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGracefulStopWithTimeoutForcesHungRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	hung := &hungServer{entered: make(chan struct{})}
+	authPb.RegisterAuthServiceServer(srv, hung)
+	go srv.Serve(listener)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := authPb.NewAuthServiceClient(conn).GetSession(context.Background(), &authPb.SessionReq{Id: "s1"})
+		callErr <- err
+	}()
+
+	select {
+	case <-hung.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RPC did not reach the handler")
+	}
+
+	const timeout = 100 * time.Millisecond
+	start := time.Now()
+	if GracefulStopWithTimeout(srv, timeout) {
+		t.Error("GracefulStopWithTimeout = true with a hung RPC, want a forced stop")
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 2*time.Second {
+		t.Errorf("stop took %s, want about the %s timeout", elapsed, timeout)
+	}
+
+	select {
+	case err := <-callErr:
+		if status.Code(err) != codes.Unavailable && status.Code(err) != codes.Canceled {
+			t.Errorf("hung RPC error = %v, want it cut off by the forced stop", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung RPC was not stopped")
+	}
+}
+
+func TestGracefulStopWithTimeoutIdle(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	go srv.Serve(listener)
+
+	if !GracefulStopWithTimeout(srv, time.Second) {
+		t.Error("GracefulStopWithTimeout = false for an idle server, want a graceful stop")
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/auth-service/internal/db"
+)
+
+// UserVerifyPath путь проверки учетных данных в сервисе пользователей
+const UserVerifyPath = "/users/verify"
+
+// defaultUserVerifyTimeout таймаут запроса к сервису пользователей, если у вызова нет дедлайна
+const defaultUserVerifyTimeout = 5 * time.Second
+
+// HTTPUserVerifier проверяет учетные данные через HTTP API сервиса пользователей:
+// POST {baseURL}/users/verify с {"email", "password"}. 200 возвращает пользователя,
+// 401 и 404 означают неверные данные
+type HTTPUserVerifier struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewHTTPUserVerifier создает клиент сервиса пользователей.
+// apiKey передается в X-Api-Key, пустой ключ не отправляется
+func NewHTTPUserVerifier(baseURL, apiKey string) *HTTPUserVerifier {
+	return &HTTPUserVerifier{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: defaultUserVerifyTimeout},
+	}
+}
+
+type verifyCredentialsReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// VerifyCredentials реализует UserVerifier
+func (v *HTTPUserVerifier) VerifyCredentials(ctx context.Context, email, password string) (*db.GetUserRes, error) {
+	body, err := json.Marshal(verifyCredentialsReq{Email: email, Password: password})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verify request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.baseURL+UserVerifyPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build verify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.apiKey != "" {
+		req.Header.Set("X-Api-Key", v.apiKey)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("users service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, ErrInvalidCredentials
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("users service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var user db.GetUserRes
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode users service response: %w", err)
+	}
+	if user.Email == "" {
+		user.Email = email
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authPb "github.com/rx3lixir/auth-service/auth-grpc/gen/go"
+	"google.golang.org/grpc/codes"
+)
+
+// newUsersService стаб сервиса пользователей с учетками stubVerifier
+func newUsersService(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+
+	stub := newStubVerifier()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != UserVerifyPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Api-Key") != apiKey {
+			http.Error(w, "bad api key", http.StatusForbidden)
+			return
+		}
+
+		var req verifyCredentialsReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := stub.VerifyCredentials(r.Context(), req.Email, req.Password)
+		if err != nil {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestHTTPUserVerifier(t *testing.T) {
+	ts := newUsersService(t, "users-key")
+	verifier := NewHTTPUserVerifier(ts.URL+"/", "users-key")
+	ctx := context.Background()
+
+	user, err := verifier.VerifyCredentials(ctx, "admin@example.com", "admin-password")
+	if err != nil {
+		t.Fatalf("VerifyCredentials: %v", err)
+	}
+	if user.Email != "admin@example.com" || !user.IsAdmin {
+		t.Errorf("user = %+v, want admin@example.com admin", user)
+	}
+
+	if _, err := verifier.VerifyCredentials(ctx, "user@example.com", "nope"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	// Ошибка сервиса пользователей не выдается за неверный пароль
+	badKey := NewHTTPUserVerifier(ts.URL, "wrong-key")
+	if _, err := badKey.VerifyCredentials(ctx, "user@example.com", "user-password"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("forbidden error = %v, want a service error", err)
+	}
+}
+
+func TestLoginUserWithHTTPUserVerifier(t *testing.T) {
+	ts := newUsersService(t, "")
+	e := newTestEnv(t, WithUserVerifier(NewHTTPUserVerifier(ts.URL, "")))
+
+	res, err := e.srv.LoginUser(context.Background(), &authPb.LoginUserReq{Email: "admin@example.com", Password: "admin-password"})
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+
+	payload, err := e.maker.VerifyToken(res.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if !payload.IsAdmin {
+		t.Error("access token is_admin = false, want true")
+	}
+
+	ts.Close()
+	_, err = e.srv.LoginUser(context.Background(), &authPb.LoginUserReq{Email: "admin@example.com", Password: "admin-password"})
+	wantCode(t, err, codes.Unavailable)
+}
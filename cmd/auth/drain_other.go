@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"context"
+
+	"github.com/rx3lixir/auth-service/auth-grpc/server"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// handleDrainSignal ничего не делает: на этой ОС нет SIGUSR1
+func handleDrainSignal(ctx context.Context, authServer *server.Server, log logger.Logger) {}
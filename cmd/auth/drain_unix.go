@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rx3lixir/auth-service/auth-grpc/server"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// handleDrainSignal переключает режим вывода из ротации по SIGUSR1
+// до отмены ctx
+func handleDrainSignal(ctx context.Context, authServer *server.Server, log logger.Logger) {
+	drainCh := make(chan os.Signal, 1)
+	signal.Notify(drainCh, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(drainCh)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-drainCh:
+				draining := !authServer.Draining()
+				authServer.SetDraining(draining)
+				log.Info("Draining mode toggled on SIGUSR1", "draining", draining)
+			}
+		}
+	}()
+}
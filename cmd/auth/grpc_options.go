@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/rx3lixir/auth-service/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// transportOptions собирает опции gRPC сервера для размера сообщений и keepalive.
+// Нулевые значения в конфигурации оставляют настройки gRPC по умолчанию
+func transportOptions(params config.ServerParams) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+
+	if params.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(params.MaxRecvMsgSize))
+	}
+
+	// Шлюзы держат простаивающие соединения и пингуют их без активных вызовов;
+	// без PermitWithoutStream сервер отвечал бы им GOAWAY too_many_pings
+	if params.KeepaliveMinTime > 0 {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             params.KeepaliveMinTime,
+			PermitWithoutStream: true,
+		}))
+	}
+
+	if params.MaxConnectionIdle > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: params.MaxConnectionIdle,
+		}))
+	}
+
+	return opts
+}
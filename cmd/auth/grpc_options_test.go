@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/rx3lixir/auth-service/internal/config"
+)
+
+// startGRPC запускает gRPC сервер со стандартным health сервисом и возвращает клиент к нему
+func startGRPC(t *testing.T, opts ...grpc.ServerOption) (*grpc.ClientConn, healthpb.HealthClient) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, healthpb.NewHealthClient(conn)
+}
+
+func TestTransportOptions(t *testing.T) {
+	if opts := transportOptions(config.ServerParams{}); len(opts) != 0 {
+		t.Errorf("transportOptions with zero config = %d options, want none", len(opts))
+	}
+
+	all := config.ServerParams{MaxRecvMsgSize: 1 << 20, KeepaliveMinTime: time.Minute, MaxConnectionIdle: time.Hour}
+	if opts := transportOptions(all); len(opts) != 3 {
+		t.Errorf("transportOptions with all fields set = %d options, want 3", len(opts))
+	}
+
+	t.Run("max recv message size", func(t *testing.T) {
+		_, client := startGRPC(t, transportOptions(config.ServerParams{MaxRecvMsgSize: 1024})...)
+		ctx := context.Background()
+
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("small request: %v", err)
+		}
+
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: strings.Repeat("x", 2048)})
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("request over the limit: code = %s, want %s (err: %v)", status.Code(err), codes.ResourceExhausted, err)
+		}
+	})
+
+	t.Run("max connection idle", func(t *testing.T) {
+		conn, client := startGRPC(t, transportOptions(config.ServerParams{MaxConnectionIdle: 100 * time.Millisecond})...)
+
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+
+		// Сервер закрывает простаивающее соединение, клиент переходит в IDLE
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for state := conn.GetState(); state != connectivity.Idle; state = conn.GetState() {
+			if !conn.WaitForStateChange(ctx, state) {
+				t.Fatalf("connection state = %s, want IDLE after the idle timeout", conn.GetState())
+			}
+		}
+	})
+}
@@ -13,9 +13,15 @@ import (
 	"github.com/rx3lixir/auth-service/auth-grpc/server"
 	"github.com/rx3lixir/auth-service/internal/config"
 	"github.com/rx3lixir/auth-service/internal/db"
+	"github.com/rx3lixir/auth-service/internal/token"
 	"github.com/rx3lixir/auth-service/pkg/health"
 	"github.com/rx3lixir/auth-service/pkg/logger"
+	"github.com/rx3lixir/auth-service/pkg/metrics"
+	"github.com/rx3lixir/auth-service/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -28,18 +34,49 @@ func main() {
 	}
 
 	// Инициализация логгера
-	logger.Init(c.Service.Env)
+	logger.Init(c.Service.Env, logger.WithFile(logger.FileConfig{
+		Path:       c.Service.LogFile,
+		MaxSizeMB:  c.Service.LogFileMaxSizeMB,
+		MaxBackups: c.Service.LogFileMaxBackups,
+		MaxAgeDays: c.Service.LogFileMaxAgeDays,
+	}))
 	defer logger.Close()
 
 	log := logger.NewLogger()
 
+	// Начальный уровень логирования из конфигурации; меняется на лету через /loglevel
+	if c.Service.LogLevel != "" {
+		if err := logger.SetLevel(c.Service.LogLevel); err != nil {
+			log.Error("Failed to set log level", "error", err)
+		}
+	}
+
 	// Создаем контекст, который можно отменить при получении сигнала остановки
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Настраиваем обработку сигналов для грациозного завершения
+	// Настраиваем обработку сигналов: SIGINT/SIGTERM завершают сервер,
+	// SIGHUP только переоткрывает логи (например, после внешней ротации файла)
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	stopCh := stopSignals(ctx, signalCh, func() {
+		if err := logger.Reopen(); err != nil {
+			log.Warn("Failed to reopen logs on SIGHUP", "error", err)
+			return
+		}
+		log.Info("Logs reopened on SIGHUP")
+	})
+
+	// Трассировка OpenTelemetry; без адреса коллектора остается no-op
+	shutdownTracing, err := tracing.Init(ctx, "auth-service", "1.0.0", c.Service.TracingEndpoint, c.Service.TracingInsecure)
+	if err != nil {
+		log.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	if c.Service.TracingEndpoint != "" {
+		log.Info("Tracing enabled", "endpoint", c.Service.TracingEndpoint)
+	}
 
 	// Логаем инфу для отладки
 	log.Info("Configuration loaded",
@@ -48,8 +85,27 @@ func main() {
 		"server_address", c.Server.Address,
 	)
 
+	// Имя кодека уже проверено при загрузке конфигурации
+	sessionCodec, err := db.SessionCodecByName(c.Redis.SessionCodec)
+	if err != nil {
+		log.Error("Invalid session codec", "error", err)
+		os.Exit(1)
+	}
+
 	// Создание Redis хранилища
-	redisStore, err := db.NewRedisStore(c.Redis.RedisURL(), ctx)
+	redisStore, err := db.NewRedisStore(c.Redis.RedisURL(), ctx,
+		db.WithMaxSessionsPerUser(c.Service.MaxSessionsPerUser),
+		db.WithSentinel(c.Redis.SentinelMasterName, c.Redis.SentinelAddrList()...),
+		db.WithCluster(c.Redis.ClusterAddrList()...),
+		db.WithPool(c.Redis.PoolSize, c.Redis.MinIdleConns, c.Redis.DialTimeout),
+		db.WithRevocationChannel(c.Redis.RevocationChannel),
+		db.WithOpTimeout(c.Redis.OpTimeout),
+		db.WithBlacklistRetention(c.Service.BlacklistRetention),
+		db.WithCodec(sessionCodec),
+		db.WithKeyNamespace(c.Redis.KeyNamespace),
+		db.WithConnectRetry(c.Redis.ConnectAttempts, c.Redis.ConnectRetryDelay),
+		db.WithLogger(log),
+	)
 	if err != nil {
 		log.Error("Failed to initialize Redis store", "error", err)
 		os.Exit(1)
@@ -58,13 +114,145 @@ func main() {
 
 	log.Info("Successfully connected to Redis")
 
+	// Фоновая очистка висячих ID в индексах сессий пользователей
+	if c.Service.ReapInterval > 0 {
+		db.StartReaper(ctx, redisStore, c.Service.ReapInterval, log)
+	}
+
+	// Хранилище для gRPC сервера; с кешем чтения сессий переживают короткие сбои Redis
+	var sessionStore db.SessionStorage = db.NewTracedStore(redisStore)
+	if c.Redis.SessionCacheSize > 0 {
+		sessionStore = db.NewCachedStore(sessionStore, c.Redis.SessionCacheSize, c.Redis.SessionCacheTTL)
+
+		log.Info("Session read cache enabled",
+			"size", c.Redis.SessionCacheSize,
+			"ttl", c.Redis.SessionCacheTTL,
+		)
+	}
+
+	// Создание JWT мейкера для выпуска access токенов
+	tokenMaker, err := token.NewJWTMaker(c.Server.SecretKey,
+		token.WithIssuer(c.Service.TokenIssuer),
+		token.WithAudience(c.Service.TokenAudienceList()...),
+	)
+	if err != nil {
+		log.Error("Failed to create token maker", "error", err)
+		os.Exit(1)
+	}
+	defer tokenMaker.Close()
+
+	// Метрики Prometheus, доступные на health сервере.
+	// Бакеты уже проверены при загрузке конфигурации
+	rpcBuckets, _ := c.Service.RPCLatencyBucketList()
+	serviceMetrics := metrics.New(metrics.WithRPCBuckets(rpcBuckets...))
+
+	// Лимитер запросов по IP клиента
+	rateLimiter := server.NewRateLimiter(c.Service.RateLimitRPS, c.Service.RateLimitBurst, 10*time.Minute)
+
+	// Цепочка интерсепторов: проверка API ключа включается, только если ключ задан
+	interceptors := []grpc.UnaryServerInterceptor{
+		server.RequestIDInterceptor(),
+		server.RecoveryInterceptor(log),
+		server.LoggingInterceptor(log),
+		server.MetricsInterceptor(serviceMetrics),
+		server.RateLimitInterceptor(rateLimiter),
+	}
+
+	// Вызовы без дедлайна клиента не должны выполняться бесконечно
+	if c.Server.DefaultDeadline > 0 {
+		interceptors = append(interceptors, server.DefaultDeadlineInterceptor(c.Server.DefaultDeadline, log))
+	}
+
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		server.MetricsStreamInterceptor(serviceMetrics),
+	}
+
+	if c.Server.APIKey != "" {
+		interceptors = append(interceptors, server.APIKeyInterceptor(c.Server.APIKey,
+			healthpb.Health_Check_FullMethodName,
+		))
+		streamInterceptors = append(streamInterceptors, server.APIKeyStreamInterceptor(c.Server.APIKey,
+			healthpb.Health_Watch_FullMethodName,
+		))
+	} else {
+		log.Warn("API key is not configured, gRPC calls are not authenticated")
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	serverOpts = append(serverOpts, transportOptions(c.Server)...)
+
+	// TLS/mTLS для gRPC; без сертификатов сервер работает в открытом виде (не в prod)
+	if c.Server.TLSEnabled() {
+		creds, err := server.LoadTLSCredentials(c.Server.TLSCertFile, c.Server.TLSKeyFile, c.Server.TLSClientCAFile)
+		if err != nil {
+			log.Error("Failed to load TLS credentials", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+
+		log.Info("TLS enabled for gRPC server", "mtls", c.Server.TLSClientCAFile != "")
+	} else {
+		log.Warn("TLS is not configured, gRPC server is running without encryption")
+	}
+
 	// Создание grpc сервера
-	grpcServer := grpc.NewServer()
-	authServer := server.NewServer(redisStore, log, c)
+	grpcServer := grpc.NewServer(serverOpts...)
+	authServerOpts := []server.Option{
+		server.WithMetrics(serviceMetrics),
+	}
+
+	// Без сервиса пользователей LoginUser не может проверить пароль, и admin токены не выпускаются
+	if c.Service.UsersServiceURL != "" {
+		authServerOpts = append(authServerOpts, server.WithUserVerifier(
+			server.NewHTTPUserVerifier(c.Service.UsersServiceURL, c.Service.UsersServiceAPIKey),
+		))
+		log.Info("LoginUser enabled", "users_service_url", c.Service.UsersServiceURL)
+	} else {
+		log.Warn("Users service is not configured, LoginUser is disabled")
+	}
+
+	authServer := server.NewServer(sessionStore, tokenMaker, log, c, authServerOpts...)
 	authPb.RegisterAuthServiceServer(grpcServer, authServer)
 
-	// Включение reflection для отладки
-	reflection.Register(grpcServer)
+	// SIGUSR1 выводит экземпляр из ротации при выкатке: новые сессии не создаются,
+	// а проверка существующих продолжается. Повторный SIGUSR1 возвращает в ротацию
+	handleDrainSignal(ctx, authServer, log)
+
+	// Перезагрузка конфигурации на лету: TTL сессий/токенов и уровень логирования.
+	// Адреса, Redis и TLS применяются только после перезапуска
+	// Текущий ключ подписи, меняется только из колбэка Watch
+	signingKey := c.Server.SecretKey
+
+	if err := config.Watch(func(nc *config.AppConfig) {
+		authServer.SetConfig(nc)
+
+		if nc.Server.SecretKey != signingKey {
+			rotateSigningKey(tokenMaker, signingKey, nc, log)
+			signingKey = nc.Server.SecretKey
+		}
+
+		if nc.Service.LogLevel != "" {
+			if err := logger.SetLevel(nc.Service.LogLevel); err != nil {
+				log.Error("Failed to set log level", "error", err)
+			}
+		}
+
+		log.Info("Configuration reloaded",
+			"session_ttl_days", nc.Service.SessionTTLDays,
+			"access_token_ttl_mins", nc.Service.AccessTokenTTLMins,
+			"log_level", logger.GetLevel(),
+		)
+	}); err != nil {
+		log.Warn("Config hot reload is disabled", "error", err)
+	}
+
+	// Reflection для отладки; в prod по умолчанию выключен
+	reflectionEnabled := registerReflection(grpcServer, c.Server.ReflectionEnabled(c.Service.Env))
+	log.Info("gRPC reflection configured", "enabled", reflectionEnabled)
 
 	// Запуск gRPC сервера
 	listener, err := net.Listen("tcp", c.Server.Address)
@@ -76,45 +264,150 @@ func main() {
 	log.Info("Server is listening", "address", c.Server.Address)
 
 	// Создаем HealthCheck сервер
-	healthServer := health.NewServer(redisStore.GetClient(), log,
+	healthOpts := []health.Option{
 		health.WithServiceName("auth-service"),
 		health.WithVersion("1.0.0"),
 		health.WithPort(":8082"),
-		health.WithTimeout(5*time.Second),
-	)
+		health.WithTimeout(5 * time.Second),
+		health.WithMetrics(serviceMetrics),
+		health.WithSessionStore(redisStore),
+		health.WithRedisWritable(),
+		health.WithDrainState(authServer.Draining),
+		health.WithAdminAPIKey(c.Server.APIKey),
+	}
 
-	// Запускаем серверы
-	errCh := make(chan error, 2)
+	if len(c.Redis.SentinelAddrList()) > 0 {
+		healthOpts = append(healthOpts, health.WithRedisSentinel(c.Redis.SentinelMasterName, c.Redis.SentinelAddrList()...))
+	}
 
-	// Health check сервер
-	go func() {
-		errCh <- healthServer.Start()
-	}()
+	// Redis вытесняет сессии молча, поэтому предупреждаем о заполнении памяти заранее
+	if c.Redis.MemoryMaxUsagePercent > 0 {
+		healthOpts = append(healthOpts, health.WithCheck("redis_memory",
+			health.RedisMemoryChecker(redisStore.GetClient(), c.Redis.MemoryMaxUsagePercent),
+		))
+	}
 
-	// gRPC сервер
-	go func() {
-		errCh <- grpcServer.Serve(listener)
-	}()
+	// Заполнение памяти процесса видно в /health, но не снимает экземпляр с трафика
+	if c.Server.MemoryMaxUsagePercent > 0 {
+		healthOpts = append(healthOpts, health.WithLocalCheck("memory",
+			health.MemoryChecker(c.Server.MemoryLimitBytes, c.Server.MemoryMaxUsagePercent),
+		))
+	}
 
-	// Ждем завершения
-	select {
-	case <-signalCh:
-		log.Info("Shutting down gracefully...")
+	if c.Server.DiskCheckPath != "" {
+		healthOpts = append(healthOpts, health.WithLocalCheck("disk",
+			health.DiskSpaceChecker(c.Server.DiskCheckPath, c.Server.DiskMinFreeMB<<20),
+		))
+	}
 
-		// Останавливаем серверы
-		grpcServer.GracefulStop()
-		if err := healthServer.Shutdown(context.Background()); err != nil {
-			log.Error("Health server shutdown error", "error", err)
+	// Выгрузка сессий для админки доступна только по API ключу
+	if c.Server.APIKey != "" {
+		healthOpts = append(healthOpts, health.WithHandler(server.SessionExportPath,
+			server.SessionExportHandler(sessionStore, c.Server.APIKey, log),
+		))
+	}
+
+	// Профилирование открывает внутреннее состояние процесса, без ключа не включаем
+	if c.Server.Pprof {
+		if c.Server.APIKey != "" {
+			healthOpts = append(healthOpts, health.WithPprof(c.Server.APIKey))
+			log.Info("pprof enabled on health server")
+		} else {
+			log.Warn("pprof requested but API key is not configured, pprof stays disabled")
+		}
+	}
+
+	healthServer := health.NewServer(redisStore.GetClient(), log, healthOpts...)
+
+	// Стандартный gRPC health протокол, статус которого следует за HTTP проверками
+	grpcHealthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, grpcHealthServer)
+
+	go healthServer.SyncGRPCHealth(ctx, grpcHealthServer, 10*time.Second, authPb.AuthService_ServiceDesc.ServiceName)
+
+	// Останавливает все серверы; gRPC сервер — с ограничением по времени
+	shutdown := func() {
+		cancel()
+		grpcHealthServer.Shutdown()
+
+		if server.GracefulStopWithTimeout(grpcServer, c.Server.ShutdownTimeout) {
+			log.Info("gRPC server stopped gracefully")
+		} else {
+			log.Warn("gRPC server graceful stop timed out, forced stop",
+				"timeout", c.Server.ShutdownTimeout,
+			)
 		}
 
-	case err := <-errCh:
-		log.Error("Server error", "error", err)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), c.Server.ShutdownTimeout)
+		defer shutdownCancel()
 
-		grpcServer.GracefulStop()
-		if err := healthServer.Shutdown(context.Background()); err != nil {
+		if err := healthServer.Shutdown(shutdownCtx); err != nil {
 			log.Error("Health server shutdown error", "error", err)
 		}
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error("Tracing shutdown error", "error", err)
+		}
+	}
+
+	// Запускаем серверы. Сбой health сервера (например, занятый порт) останавливает
+	// сервис, только если health_required не выключен
+	exitCh := make(chan serverExit, 2)
+	runServer(exitCh, "health", c.Server.HealthServerRequired(), healthServer.Start)
+
+	// Не принимаем gRPC трафик, пока проверки готовности (в первую очередь Redis) не прошли.
+	if c.Server.StartupTimeout > 0 {
+		log.Info("Waiting for readiness checks before serving gRPC", "timeout", c.Server.StartupTimeout)
+
+		if err := healthServer.WaitReady(ctx, c.Server.StartupTimeout); err != nil {
+			log.Error("Service did not become ready", "error", err)
+			shutdown()
+			os.Exit(1)
+		}
 	}
 
-	log.Info("Server stopped gracefully")
+	runServer(exitCh, "grpc", true, func() error {
+		return grpcServer.Serve(listener)
+	})
+
+	// Ждем завершения
+	waitForStop(stopCh, exitCh, log)
+	shutdown()
+
+	log.Info("Server stopped")
+}
+
+// rotateSigningKey переключает подпись токенов на новый secret_key. Прежний ключ
+// принимается при проверке, пока не истекут выпущенные им access токены
+func rotateSigningKey(maker token.Maker, oldKey string, nc *config.AppConfig, log logger.Logger) {
+	if err := maker.RotateKey([]byte(nc.Server.SecretKey)); err != nil {
+		log.Error("Failed to rotate signing key", "error", err)
+		return
+	}
+
+	oldKID := token.KeyID([]byte(oldKey))
+	retireAfter := nc.Service.GetAccessTokenTTL()
+
+	time.AfterFunc(retireAfter, func() {
+		// Ключ мог снова стать текущим после повторной ротации
+		if err := maker.RemoveKey(oldKID); err != nil {
+			log.Warn("Retired signing key was not removed", "kid", oldKID, "error", err)
+			return
+		}
+		log.Info("Retired signing key removed", "kid", oldKID)
+	})
+
+	log.Info("Signing key rotated",
+		"kid", token.KeyID([]byte(nc.Server.SecretKey)),
+		"retired_kid", oldKID,
+		"retire_after", retireAfter,
+	)
+}
+
+// registerReflection регистрирует gRPC reflection, если он включен. Возвращает enabled
+func registerReflection(grpcServer *grpc.Server, enabled bool) bool {
+	if enabled {
+		reflection.Register(grpcServer)
+	}
+	return enabled
 }
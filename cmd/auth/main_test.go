@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/rx3lixir/auth-service/internal/config"
+)
+
+func TestRegisterReflection(t *testing.T) {
+	on, off := true, false
+
+	tests := []struct {
+		name   string
+		env    string
+		toggle *bool
+		want   bool
+	}{
+		{"dev default", "dev", nil, true},
+		{"test default", "test", nil, true},
+		{"prod default", "prod", nil, false},
+		{"disabled in dev", "dev", &off, false},
+		{"enabled in prod", "prod", &on, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := config.ServerParams{Reflection: tt.toggle}
+			grpcServer := grpc.NewServer()
+			defer grpcServer.Stop()
+
+			if got := registerReflection(grpcServer, params.ReflectionEnabled(tt.env)); got != tt.want {
+				t.Errorf("registerReflection = %v, want %v", got, tt.want)
+			}
+
+			registered := false
+			for name := range grpcServer.GetServiceInfo() {
+				if strings.HasPrefix(name, "grpc.reflection.") {
+					registered = true
+				}
+			}
+			if registered != tt.want {
+				t.Errorf("reflection service registered = %v, want %v", registered, tt.want)
+			}
+		})
+	}
+}
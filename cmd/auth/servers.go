@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// serverExit сообщение о завершении одного из серверов процесса
+type serverExit struct {
+	name  string
+	err   error
+	fatal bool // Завершение сервера останавливает весь сервис
+}
+
+// runServer запускает serve в отдельной горутине и сообщает о его завершении в exitCh
+func runServer(exitCh chan<- serverExit, name string, fatal bool, serve func() error) {
+	go func() {
+		exitCh <- serverExit{name: name, err: serve(), fatal: fatal}
+	}()
+}
+
+// waitForStop блокируется до сигнала остановки или завершения обязательного сервера.
+// Сбой необязательного сервера только логируется, остальные серверы продолжают работать
+func waitForStop(stopCh <-chan os.Signal, exitCh <-chan serverExit, log logger.Logger) {
+	for {
+		select {
+		case sig := <-stopCh:
+			log.Info("Shutting down gracefully...", "signal", sig.String())
+			return
+
+		case exit := <-exitCh:
+			if exit.fatal {
+				log.Error("Server error", "server", exit.name, "error", exit.err)
+				return
+			}
+
+			log.Error("Optional server failed, service keeps running",
+				"server", exit.name,
+				"error", exit.err,
+			)
+		}
+	}
+}
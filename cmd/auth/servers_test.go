@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/rx3lixir/auth-service/internal/config"
+	"github.com/rx3lixir/auth-service/pkg/health"
+)
+
+// errorLogger пересылает сообщения Error в канал, остальное отбрасывает
+type errorLogger struct {
+	errors chan string
+}
+
+func (l errorLogger) Debug(string, ...interface{}) {}
+func (l errorLogger) Info(string, ...interface{})  {}
+func (l errorLogger) Warn(string, ...interface{})  {}
+func (l errorLogger) Error(msg string, _ ...interface{}) {
+	l.errors <- msg
+}
+func (l errorLogger) Fatal(string, ...interface{}) {}
+func (l errorLogger) Panic(string, ...interface{}) {}
+
+// busyHealthServer health сервер на уже занятом порту: Start сразу падает
+func busyHealthServer(t *testing.T) *health.Server {
+	t.Helper()
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { busy.Close() })
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	t.Cleanup(func() { client.Close() })
+
+	return health.NewServer(client, errorLogger{errors: make(chan string, 4)}, health.WithPort(busy.Addr().String()))
+}
+
+func TestWaitForStopHealthNotRequired(t *testing.T) {
+	on, off := true, false
+
+	tests := []struct {
+		name     string
+		required *bool
+		wantStop bool // Сбой health сервера останавливает сервис без сигнала
+	}{
+		{"required by default", nil, true},
+		{"required", &on, true},
+		{"not required", &off, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := config.ServerParams{HealthRequired: tt.required}
+			log := errorLogger{errors: make(chan string, 4)}
+			stopCh := make(chan os.Signal, 1)
+			exitCh := make(chan serverExit, 2)
+
+			// gRPC сервер работает, пока его не остановят
+			grpcStop := make(chan struct{})
+			defer close(grpcStop)
+			runServer(exitCh, "grpc", true, func() error {
+				<-grpcStop
+				return nil
+			})
+			runServer(exitCh, "health", params.HealthServerRequired(), busyHealthServer(t).Start)
+
+			stopped := make(chan struct{})
+			go func() {
+				waitForStop(stopCh, exitCh, log)
+				close(stopped)
+			}()
+
+			var msg string
+			select {
+			case msg = <-log.errors:
+			case <-time.After(time.Second):
+				t.Fatal("health server bind failure was not logged")
+			}
+
+			if tt.wantStop {
+				if msg != "Server error" {
+					t.Errorf("logged %q, want a fatal server error", msg)
+				}
+				select {
+				case <-stopped:
+				case <-time.After(time.Second):
+					t.Fatal("required health server failure did not stop the service")
+				}
+				return
+			}
+
+			if msg != "Optional server failed, service keeps running" {
+				t.Errorf("logged %q, want an optional server failure", msg)
+			}
+			select {
+			case <-stopped:
+				t.Fatal("optional health server failure stopped the service")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			stopCh <- syscall.SIGTERM
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Fatal("stop signal did not stop the service")
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+// stopSignals разбирает сигналы из signalCh: на SIGHUP вызывает onReload
+// и продолжает работу, остальные сигналы передает в возвращаемый канал.
+// Обработка прекращается с отменой ctx
+func stopSignals(ctx context.Context, signalCh <-chan os.Signal, onReload func()) <-chan os.Signal {
+	stopCh := make(chan os.Signal, 1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case sig := <-signalCh:
+				if sig == syscall.SIGHUP {
+					onReload()
+					continue
+				}
+
+				stopCh <- sig
+				return
+			}
+		}
+	}()
+
+	return stopCh
+}
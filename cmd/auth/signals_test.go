@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+func TestStopSignalsReloadsOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	logger.Init("prod", logger.WithFile(logger.FileConfig{Path: path, MaxSizeMB: 1}))
+	t.Cleanup(func() { logger.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signalCh := make(chan os.Signal)
+	reloaded := make(chan error)
+	stopCh := stopSignals(ctx, signalCh, func() { reloaded <- logger.Reopen() })
+
+	for i := 0; i < 2; i++ {
+		logger.Info("before reload")
+		signalCh <- syscall.SIGHUP
+
+		select {
+		case err := <-reloaded:
+			if err != nil {
+				t.Fatalf("Reopen: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SIGHUP did not trigger a reload")
+		}
+
+		select {
+		case sig := <-stopCh:
+			t.Fatalf("SIGHUP stopped the server with %v", sig)
+		default:
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := strings.Count(string(data), "before reload"); got != 2 {
+		t.Errorf("log file has %d flushed lines, want 2:\n%s", got, data)
+	}
+
+	signalCh <- syscall.SIGTERM
+	select {
+	case sig := <-stopCh:
+		if sig != syscall.SIGTERM {
+			t.Errorf("stop signal = %v, want SIGTERM", sig)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SIGTERM did not stop the server")
+	}
+}
@@ -1,26 +1,102 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/rx3lixir/auth-service/internal/token"
 	"github.com/spf13/viper"
 )
 
 // Константы для ключей конфигурации
 const (
 	envKey                = "service_params.env"
+	logLevelKey           = "service_params.log_level"
+	logFileKey            = "service_params.log_file"
+	logFileMaxSizeKey     = "service_params.log_file_max_size_mb"
+	logFileMaxBackupsKey  = "service_params.log_file_max_backups"
+	logFileMaxAgeKey      = "service_params.log_file_max_age_days"
 	secretKey             = "server_params.secret_key"
+	apiKey                = "server_params.api_key"
+	tlsCertFileKey        = "server_params.tls_cert_file"
+	tlsKeyFileKey         = "server_params.tls_key_file"
+	tlsClientCAFileKey    = "server_params.tls_client_ca_file"
+	shutdownTimeoutKey    = "server_params.shutdown_timeout"
+	startupTimeoutKey     = "server_params.startup_timeout"
+	reflectionKey         = "server_params.reflection"
+	healthRequiredKey     = "server_params.health_required"
+	maxRecvMsgSizeKey     = "server_params.max_recv_msg_size"
+	keepaliveMinTimeKey   = "server_params.keepalive_min_time"
+	defaultDeadlineKey    = "server_params.default_deadline"
+	maxConnIdleKey        = "server_params.max_connection_idle"
+	pprofKey              = "server_params.pprof"
+	memoryMaxUsageKey     = "server_params.memory_max_usage_percent"
+	memoryLimitBytesKey   = "server_params.memory_limit_bytes"
+	diskCheckPathKey      = "server_params.disk_check_path"
+	diskMinFreeMBKey      = "server_params.disk_min_free_mb"
 	redisURLKey           = "redis_params.url"
 	redisPasswordKey      = "redis_params.password"
+	sentinelMasterNameKey = "redis_params.sentinel_master_name"
+	sentinelAddrsKey      = "redis_params.sentinel_addrs"
+	clusterAddrsKey       = "redis_params.cluster_addrs"
+	redisPoolSizeKey      = "redis_params.pool_size"
+	redisMinIdleConnsKey  = "redis_params.min_idle_conns"
+	redisDialTimeoutKey   = "redis_params.dial_timeout"
+	revocationChannelKey  = "redis_params.revocation_channel"
+	redisOpTimeoutKey     = "redis_params.op_timeout"
+	connectAttemptsKey    = "redis_params.connect_attempts"
+	connectRetryDelayKey  = "redis_params.connect_retry_delay"
+	sessionCacheSizeKey   = "redis_params.session_cache_size"
+	sessionCacheTTLKey    = "redis_params.session_cache_ttl"
+	sessionCodecKey       = "redis_params.session_codec"
+	redisMemoryMaxKey     = "redis_params.memory_max_usage_percent"
+	keyNamespaceKey       = "redis_params.key_namespace"
 	serviceAddress        = "server_params.address"
 	sessionTTLDaysKey     = "service_params.session_ttl_days"
 	accessTokenTTLMinsKey = "service_params.access_token_ttl_mins"
+	maxSessionsPerUserKey = "service_params.max_sessions_per_user"
+	rateLimitRPSKey       = "service_params.rate_limit_rps"
+	rateLimitBurstKey     = "service_params.rate_limit_burst"
+	reapIntervalKey       = "service_params.reap_interval"
+	blacklistRetentionKey = "service_params.blacklist_retention"
+	sessionIDFormatKey    = "service_params.session_id_format"
+	minSessionTTLKey      = "service_params.min_session_ttl"
+	maxSessionTTLKey      = "service_params.max_session_ttl"
+	createRateLimitKey    = "service_params.create_rate_limit"
+	createRateWindowKey   = "service_params.create_rate_window"
+	tokenIssuerKey        = "service_params.token_issuer"
+	tokenAudienceKey      = "service_params.token_audience"
+	tracingEndpointKey    = "service_params.tracing_endpoint"
+	rpcBucketsKey         = "service_params.rpc_latency_buckets"
+	tracingInsecureKey    = "service_params.tracing_insecure"
+	usersServiceURLKey    = "service_params.users_service_url"
+	usersServiceAPIKey    = "service_params.users_service_api_key"
 )
 
+// Переменные окружения для явного указания расположения конфигурационного файла
+const (
+	configPathEnv = "CONFIG_PATH" // Директория с конфигом или путь к самому файлу
+	configNameEnv = "CONFIG_NAME" // Имя файла без расширения
+)
+
+// defaultConfigName имя конфигурационного файла по умолчанию
+const defaultConfigName = "config"
+
+// Переменные окружения, выбирающие профиль config.<env>.yaml поверх базового файла
+const (
+	profileEnv         = "SERVICE_KEY"
+	profileFallbackEnv = "ENV"
+)
+
+// secretKeyTag тег валидатора для ключей подписи токенов
+const secretKeyTag = "secret_key"
+
 // AppConfig представляет конфигурацию всего приложения
 type AppConfig struct {
 	Service ServiceParams `mapstructure:"service_params" validate:"required"`
@@ -31,18 +107,159 @@ type AppConfig struct {
 // ApplicationParams содержит общие параметры приложения
 type ServiceParams struct {
 	Env                string `mapstructure:"env" validate:"required,oneof=dev prod test"`
+	LogLevel           string `mapstructure:"log_level" validate:"omitempty,oneof=debug info warn error"` // Пусто = по окружению
 	SessionTTLDays     int    `mapstructure:"session_ttl_days" validate:"required,min=1,max=30"`
 	AccessTokenTTLMins int    `mapstructure:"access_token_ttl_mins" validate:"required,min=5,max=60"`
+	MaxSessionsPerUser int    `mapstructure:"max_sessions_per_user" validate:"required,min=1,max=100"`
+	RateLimitRPS       int    `mapstructure:"rate_limit_rps" validate:"required,min=1,max=10000"`
+	RateLimitBurst     int    `mapstructure:"rate_limit_burst" validate:"required,min=1,max=10000"`
+
+	// Дублирование логов в файл с ротацией, пустой путь = только stdout
+	LogFile           string `mapstructure:"log_file"`
+	LogFileMaxSizeMB  int    `mapstructure:"log_file_max_size_mb" validate:"required_with=LogFile,omitempty,min=1,max=10240"`
+	LogFileMaxBackups int    `mapstructure:"log_file_max_backups" validate:"min=0"`
+	LogFileMaxAgeDays int    `mapstructure:"log_file_max_age_days" validate:"min=0"`
+
+	// Формат ID сессий: uuid | ulid | any, пусто = any. Для uuid и ulid ID из запроса проверяется,
+	// а сгенерированные сервером ID выпускаются в этом формате
+	SessionIDFormat string `mapstructure:"session_id_format" validate:"omitempty,oneof=uuid ulid any"`
+
+	// Интервал фоновой очистки индексов сессий, 0 = очистка отключена
+	ReapInterval time.Duration `mapstructure:"reap_interval" validate:"omitempty,min=1m"`
+
+	// Минимальное время хранения отозванного refresh токена в черном списке,
+	// 0 = до истечения сессии. Не меньше времени жизни access токена
+	BlacklistRetention time.Duration `mapstructure:"blacklist_retention" validate:"min=0,max=2160h"`
+
+	// Границы для ttl_seconds в CreateSession. MaxSessionTTL = 0 запрещает переопределение TTL
+	MinSessionTTL time.Duration `mapstructure:"min_session_ttl" validate:"omitempty,min=1m"`
+	MaxSessionTTL time.Duration `mapstructure:"max_session_ttl" validate:"required_with=MinSessionTTL,omitempty,gtefield=MinSessionTTL,max=2160h"`
+
+	// Лимит новых сессий одного пользователя за окно, независимо от IP. 0 = без лимита
+	CreateRateLimit  int           `mapstructure:"create_rate_limit" validate:"min=0,max=10000"`
+	CreateRateWindow time.Duration `mapstructure:"create_rate_window" validate:"required_with=CreateRateLimit,omitempty,min=1s,max=24h"`
+
+	// Claim iss выпускаемых access токенов; токены с другим iss отклоняются. Пусто = не проверяется
+	TokenIssuer string `mapstructure:"token_issuer" validate:"max=256"`
+	// Claim aud через запятую: токен принимается, если его aud пересекается со списком.
+	// Пусто = не проверяется
+	TokenAudience string `mapstructure:"token_audience"`
+
+	// OTLP/gRPC коллектор для трассировки, пусто = трассировка отключена
+	TracingEndpoint string `mapstructure:"tracing_endpoint"`
+	TracingInsecure bool   `mapstructure:"tracing_insecure"` // Подключаться к коллектору без TLS
+
+	// Границы бакетов гистограммы длительности RPC в секундах через запятую,
+	// пусто = бакеты Prometheus по умолчанию
+	RPCLatencyBuckets string `mapstructure:"rpc_latency_buckets"`
+
+	// HTTP адрес сервиса пользователей для проверки паролей в LoginUser,
+	// пусто = LoginUser отвечает Unimplemented
+	UsersServiceURL    string `mapstructure:"users_service_url" validate:"omitempty,url"`
+	UsersServiceAPIKey string `mapstructure:"users_service_api_key"` // X-Api-Key для сервиса пользователей
 }
 
 type ServerParams struct {
 	Address   string `mapstructure:"address" validate:"required"`
-	SecretKey string `mapstructure:"secret_key" validate:"required"`
+	SecretKey string `mapstructure:"secret_key" validate:"required,secret_key"`
+	APIKey    string `mapstructure:"api_key"` // Пусто = проверка API ключа отключена
+
+	// TLS для gRPC. Если задан TLSClientCAFile, включается mTLS
+	TLSCertFile     string `mapstructure:"tls_cert_file" validate:"required_with=TLSKeyFile TLSClientCAFile"`
+	TLSKeyFile      string `mapstructure:"tls_key_file" validate:"required_with=TLSCertFile"`
+	TLSClientCAFile string `mapstructure:"tls_client_ca_file"`
+
+	// Время на мягкую остановку, после которого сервер останавливается принудительно
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" validate:"required,min=1s,max=5m"`
+
+	// Сколько ждать прохождения проверок готовности перед запуском gRPC; не дождались —
+	// сервис завершается. 0 = принимать трафик сразу
+	StartupTimeout time.Duration `mapstructure:"startup_timeout" validate:"omitempty,min=1s,max=5m"`
+
+	// gRPC reflection, nil = включен везде, кроме prod
+	Reflection *bool `mapstructure:"reflection"`
+
+	// Максимальный размер входящего сообщения в байтах, 0 = по умолчанию gRPC (4 МБ)
+	MaxRecvMsgSize int `mapstructure:"max_recv_msg_size" validate:"min=0,max=67108864"`
+
+	// Keepalive: как часто клиенту можно пинговать сервер и через сколько
+	// закрывать простаивающее соединение. 0 = значения gRPC по умолчанию
+	KeepaliveMinTime  time.Duration `mapstructure:"keepalive_min_time" validate:"omitempty,min=1s,max=1h"`
+	MaxConnectionIdle time.Duration `mapstructure:"max_connection_idle" validate:"omitempty,min=1m,max=24h"`
+
+	// Дедлайн для unary вызовов, пришедших без дедлайна клиента, 0 = не ограничивать
+	DefaultDeadline time.Duration `mapstructure:"default_deadline" validate:"omitempty,min=100ms,max=5m"`
+
+	// /debug/pprof/ на health сервере, доступен только с APIKey
+	Pprof bool `mapstructure:"pprof"`
+
+	// Останавливать сервис, если health сервер не запустился, nil = да
+	HealthRequired *bool `mapstructure:"health_required"`
+
+	// Порог заполнения кучи процесса в процентах для /health, 0 = проверка отключена.
+	// Потолок MemoryLimitBytes, 0 = GOMEMLIMIT, а без него память, полученная от ОС
+	MemoryMaxUsagePercent float64 `mapstructure:"memory_max_usage_percent" validate:"min=0,max=100"`
+	MemoryLimitBytes      uint64  `mapstructure:"memory_limit_bytes"`
+
+	// Каталог, свободное место в котором проверяет /health, пусто = проверка отключена
+	DiskCheckPath string `mapstructure:"disk_check_path"`
+	DiskMinFreeMB uint64 `mapstructure:"disk_min_free_mb" validate:"required_with=DiskCheckPath"`
+}
+
+// TLSEnabled сообщает, настроен ли TLS для gRPC сервера
+func (s *ServerParams) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// ReflectionEnabled сообщает, нужно ли регистрировать gRPC reflection в окружении env
+func (s *ServerParams) ReflectionEnabled(env string) bool {
+	if s.Reflection != nil {
+		return *s.Reflection
+	}
+	return env != "prod"
+}
+
+// HealthServerRequired сообщает, должен ли сбой health сервера останавливать сервис
+func (s *ServerParams) HealthServerRequired() bool {
+	return s.HealthRequired == nil || *s.HealthRequired
 }
 
 type RedisParams struct {
-	URL      string `mapstructure:"url" validate:"required"`
-	Password string `mapstructure:"password"`
+	URL                string `mapstructure:"url" validate:"required"`
+	Password           string `mapstructure:"password"`
+	SentinelMasterName string `mapstructure:"sentinel_master_name" validate:"required_with=SentinelAddrs"`
+	SentinelAddrs      string `mapstructure:"sentinel_addrs"` // Адреса Sentinel через запятую
+
+	// Узлы Redis Cluster через запятую, пусто = не кластер
+	ClusterAddrs string `mapstructure:"cluster_addrs" validate:"excluded_with=SentinelAddrs"`
+
+	// Настройки пула соединений, 0 = значение go-redis по умолчанию
+	PoolSize     int           `mapstructure:"pool_size" validate:"min=0,max=1000"`
+	MinIdleConns int           `mapstructure:"min_idle_conns" validate:"min=0"`
+	DialTimeout  time.Duration `mapstructure:"dial_timeout" validate:"min=0,max=1m"`
+
+	RevocationChannel string `mapstructure:"revocation_channel"` // Канал Pub/Sub для событий отзыва
+
+	// Таймаут одной операции с Redis, 0 = без таймаута
+	OpTimeout time.Duration `mapstructure:"op_timeout" validate:"min=0,max=1m"`
+
+	// Повторы подключения при старте, 0 = значения по умолчанию (одна попытка)
+	ConnectAttempts   int           `mapstructure:"connect_attempts" validate:"min=0,max=100"`
+	ConnectRetryDelay time.Duration `mapstructure:"connect_retry_delay" validate:"min=0,max=1m"`
+
+	// Кеш сессий на случай недоступности Redis, размер 0 = кеш отключен
+	SessionCacheSize int           `mapstructure:"session_cache_size" validate:"min=0,max=1000000"`
+	SessionCacheTTL  time.Duration `mapstructure:"session_cache_ttl" validate:"required_with=SessionCacheSize,max=1h"`
+
+	// Формат записи сессий: json | gzip, пусто = json. Чтение понимает оба
+	SessionCodec string `mapstructure:"session_codec" validate:"omitempty,oneof=json gzip"`
+
+	// Порог заполнения maxmemory в процентах для health проверки, 0 = проверка отключена
+	MemoryMaxUsagePercent float64 `mapstructure:"memory_max_usage_percent" validate:"min=0,max=100"`
+
+	// Префикс всех ключей, чтобы несколько экземпляров делили один Redis; пусто = без префикса.
+	// Символы шаблонов SCAN запрещены: по префиксу ищутся индексы пользователей
+	KeyNamespace string `mapstructure:"key_namespace" validate:"omitempty,max=64,printascii,excludesall=*?[]"`
 }
 
 // RedisURL формирует полный URL для подключения к Redis
@@ -63,11 +280,65 @@ func (r *RedisParams) RedisURL() string {
 	return fmt.Sprintf("redis://%s", r.URL)
 }
 
+// SentinelAddrList возвращает список адресов Sentinel
+func (r *RedisParams) SentinelAddrList() []string {
+	return splitAddrs(r.SentinelAddrs)
+}
+
+// ClusterAddrList возвращает список начальных узлов Redis Cluster
+func (r *RedisParams) ClusterAddrList() []string {
+	return splitAddrs(r.ClusterAddrs)
+}
+
+// splitAddrs разбирает список значений через запятую, пропуская пустые
+func splitAddrs(list string) []string {
+	addrs := make([]string, 0)
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// TokenAudienceList возвращает список audience для access токенов
+func (s *ServiceParams) TokenAudienceList() []string {
+	return splitAddrs(s.TokenAudience)
+}
+
+// RPCLatencyBucketList разбирает границы бакетов гистограммы RPC.
+// Границы должны быть положительными и строго возрастать
+func (s *ServiceParams) RPCLatencyBucketList() ([]float64, error) {
+	buckets := make([]float64, 0)
+	for _, part := range strings.Split(s.RPCLatencyBuckets, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bucket, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная граница бакета %q: %w", part, err)
+		}
+
+		if bucket <= 0 || (len(buckets) > 0 && bucket <= buckets[len(buckets)-1]) {
+			return nil, fmt.Errorf("границы бакетов должны быть положительными и возрастать: %s", s.RPCLatencyBuckets)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
 // GetSessionTTL возвращает время жизни сессии в виде Duration
 func (s *ServiceParams) GetSessionTTL() time.Duration {
 	return time.Hour * 24 * time.Duration(s.SessionTTLDays)
 }
 
+// SessionTTLOverrideAllowed сообщает, можно ли задать TTL сессии в запросе
+func (s *ServiceParams) SessionTTLOverrideAllowed() bool {
+	return s.MaxSessionTTL > 0
+}
+
 // GetAccessTokenTTL возвращает время жизни access токена в виде Duration
 func (s *ServiceParams) GetAccessTokenTTL() time.Duration {
 	return time.Minute * time.Duration(s.AccessTokenTTLMins)
@@ -77,27 +348,84 @@ func (s *ServiceParams) GetAccessTokenTTL() time.Duration {
 func envBindings() map[string]string {
 	return map[string]string{
 		envKey:                "SERVICE_KEY",
+		logLevelKey:           "LOG_LEVEL",
+		logFileKey:            "LOG_FILE",
+		logFileMaxSizeKey:     "LOG_FILE_MAX_SIZE_MB",
+		logFileMaxBackupsKey:  "LOG_FILE_MAX_BACKUPS",
+		logFileMaxAgeKey:      "LOG_FILE_MAX_AGE_DAYS",
 		serviceAddress:        "SERVICE_ADDRESS",
 		secretKey:             "SECRET_KEY",
+		apiKey:                "API_KEY",
+		tlsCertFileKey:        "TLS_CERT_FILE",
+		tlsKeyFileKey:         "TLS_KEY_FILE",
+		tlsClientCAFileKey:    "TLS_CLIENT_CA_FILE",
+		shutdownTimeoutKey:    "SHUTDOWN_TIMEOUT",
+		startupTimeoutKey:     "STARTUP_TIMEOUT",
+		reflectionKey:         "GRPC_REFLECTION",
+		healthRequiredKey:     "HEALTH_REQUIRED",
+		maxRecvMsgSizeKey:     "GRPC_MAX_RECV_MSG_SIZE",
+		keepaliveMinTimeKey:   "GRPC_KEEPALIVE_MIN_TIME",
+		defaultDeadlineKey:    "GRPC_DEFAULT_DEADLINE",
+		maxConnIdleKey:        "GRPC_MAX_CONNECTION_IDLE",
+		pprofKey:              "PPROF_ENABLED",
+		memoryMaxUsageKey:     "MEMORY_MAX_USAGE_PERCENT",
+		memoryLimitBytesKey:   "MEMORY_LIMIT_BYTES",
+		diskCheckPathKey:      "DISK_CHECK_PATH",
+		diskMinFreeMBKey:      "DISK_MIN_FREE_MB",
 		redisURLKey:           "REDIS_URL",
 		redisPasswordKey:      "REDIS_PASSWORD",
+		sentinelMasterNameKey: "REDIS_SENTINEL_MASTER_NAME",
+		sentinelAddrsKey:      "REDIS_SENTINEL_ADDRS",
+		clusterAddrsKey:       "REDIS_CLUSTER_ADDRS",
+		redisPoolSizeKey:      "REDIS_POOL_SIZE",
+		redisMinIdleConnsKey:  "REDIS_MIN_IDLE_CONNS",
+		redisDialTimeoutKey:   "REDIS_DIAL_TIMEOUT",
+		revocationChannelKey:  "REDIS_REVOCATION_CHANNEL",
+		redisOpTimeoutKey:     "REDIS_OP_TIMEOUT",
+		connectAttemptsKey:    "REDIS_CONNECT_ATTEMPTS",
+		connectRetryDelayKey:  "REDIS_CONNECT_RETRY_DELAY",
+		sessionCacheSizeKey:   "REDIS_SESSION_CACHE_SIZE",
+		sessionCacheTTLKey:    "REDIS_SESSION_CACHE_TTL",
+		sessionCodecKey:       "REDIS_SESSION_CODEC",
+		redisMemoryMaxKey:     "REDIS_MEMORY_MAX_USAGE_PERCENT",
+		keyNamespaceKey:       "REDIS_KEY_NAMESPACE",
 		sessionTTLDaysKey:     "SESSION_TTL_DAYS",
 		accessTokenTTLMinsKey: "ACCESS_TOKEN_TTL_MINS",
+		maxSessionsPerUserKey: "MAX_SESSIONS_PER_USER",
+		rateLimitRPSKey:       "RATE_LIMIT_RPS",
+		rateLimitBurstKey:     "RATE_LIMIT_BURST",
+		reapIntervalKey:       "REAP_INTERVAL",
+		blacklistRetentionKey: "BLACKLIST_RETENTION",
+		sessionIDFormatKey:    "SESSION_ID_FORMAT",
+		minSessionTTLKey:      "MIN_SESSION_TTL",
+		maxSessionTTLKey:      "MAX_SESSION_TTL",
+		createRateLimitKey:    "CREATE_RATE_LIMIT",
+		createRateWindowKey:   "CREATE_RATE_WINDOW",
+		tokenIssuerKey:        "TOKEN_ISSUER",
+		tokenAudienceKey:      "TOKEN_AUDIENCE",
+		tracingEndpointKey:    "OTEL_EXPORTER_OTLP_ENDPOINT",
+		rpcBucketsKey:         "RPC_LATENCY_BUCKETS",
+		tracingInsecureKey:    "OTEL_EXPORTER_OTLP_INSECURE",
+		usersServiceURLKey:    "USERS_SERVICE_URL",
+		usersServiceAPIKey:    "USERS_SERVICE_API_KEY",
 	}
 }
 
-// New загружает конфигурацию из файла и переменных окружения
+// New загружает конфигурацию из файла и переменных окружения.
+// Переменные окружения имеют приоритет над файлом
 func New() (*AppConfig, error) {
+	// .env загружается первым: в нем может быть и CONFIG_PATH
+	if err := loadDotenv(); err != nil {
+		return nil, err
+	}
+
 	v := viper.New()
 
-	// Получаем рабочую директорию
-	cwd, err := os.Getwd()
+	explicitPath, err := setConfigLocation(v)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось получить рабочую директорию: %w", err)
+		return nil, err
 	}
 
-	v.AddConfigPath(filepath.Join(cwd, "internal", "config"))
-	v.SetConfigName("config")
 	v.SetConfigType("yaml")
 	v.AutomaticEnv()
 
@@ -108,11 +436,37 @@ func New() (*AppConfig, error) {
 		}
 	}
 
-	// Чтение конфигурации
+	// Чтение конфигурации. Без явного CONFIG_PATH файл необязателен:
+	// все параметры можно передать через переменные окружения
 	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("ошибка чтения конфигурационного файла: %w", err)
+		var notFound viper.ConfigFileNotFoundError
+		switch {
+		case !errors.As(err, &notFound):
+			return nil, fmt.Errorf("ошибка чтения конфигурационного файла: %w", err)
+		case explicitPath != "":
+			return nil, fmt.Errorf("конфигурационный файл %s не найден в %s=%s", configName(), configPathEnv, explicitPath)
+		}
+	}
+
+	if err := mergeProfile(v); err != nil {
+		return nil, err
+	}
+
+	config, err := decode(v)
+	if err != nil {
+		return nil, err
 	}
 
+	// Запоминаем источник конфигурации для Watch
+	watchMu.Lock()
+	loaded = v
+	watchMu.Unlock()
+
+	return config, nil
+}
+
+// decode декодирует и валидирует конфигурацию из viper
+func decode(v *viper.Viper) (*AppConfig, error) {
 	var config AppConfig
 
 	if err := v.Unmarshal(&config); err != nil {
@@ -122,9 +476,136 @@ func New() (*AppConfig, error) {
 	// Валидация конфигурации
 	validate := validator.New()
 
+	if err := validate.RegisterValidation(secretKeyTag, validateSecretKey); err != nil {
+		return nil, fmt.Errorf("ошибка регистрации валидатора %s: %w", secretKeyTag, err)
+	}
+
 	if err := validate.Struct(config); err != nil {
-		return nil, fmt.Errorf("ошибка валидации конфигурации: %w", err)
+		return nil, fmt.Errorf("ошибка валидации конфигурации: %w", describeValidationError(err))
+	}
+
+	if _, err := config.Service.RPCLatencyBucketList(); err != nil {
+		return nil, fmt.Errorf("ошибка валидации конфигурации: %s: %w", rpcBucketsKey, err)
+	}
+
+	if retention := config.Service.BlacklistRetention; retention > 0 && retention < config.Service.GetAccessTokenTTL() {
+		return nil, fmt.Errorf("ошибка валидации конфигурации: %s (%s) меньше времени жизни access токена (%s)",
+			blacklistRetentionKey, retention, config.Service.GetAccessTokenTTL())
+	}
+
+	// В продакшене gRPC не должен работать без шифрования
+	if config.Service.Env == "prod" && !config.Server.TLSEnabled() {
+		return nil, fmt.Errorf("ошибка валидации конфигурации: в prod окружении обязательны %s и %s", tlsCertFileKey, tlsKeyFileKey)
 	}
 
 	return &config, nil
 }
+
+// setConfigLocation настраивает, где viper ищет конфигурационный файл.
+// Возвращает путь из CONFIG_PATH, если он задан
+func setConfigLocation(v *viper.Viper) (string, error) {
+	path := os.Getenv(configPathEnv)
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("не удалось получить рабочую директорию: %w", err)
+		}
+
+		v.AddConfigPath(filepath.Join(cwd, "internal", "config"))
+		v.SetConfigName(configName())
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("путь %s=%s не существует", configPathEnv, path)
+		}
+		return "", fmt.Errorf("не удалось прочитать %s=%s: %w", configPathEnv, path, err)
+	}
+
+	// CONFIG_PATH может указывать прямо на файл
+	if !info.IsDir() {
+		v.SetConfigFile(path)
+		return path, nil
+	}
+
+	v.AddConfigPath(path)
+	v.SetConfigName(configName())
+	return path, nil
+}
+
+// mergeProfile накладывает на базовый файл профиль окружения: рядом с config.yaml
+// ищется config.<env>.yaml. Профиль необязателен, переменные окружения
+// по-прежнему имеют приоритет над обоими файлами
+func mergeProfile(v *viper.Viper) error {
+	path := profileFile(v)
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ошибка чтения профиля конфигурации %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := v.MergeConfig(file); err != nil {
+		return fmt.Errorf("ошибка чтения профиля конфигурации %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// profileFile возвращает путь к файлу профиля для текущего окружения.
+// Пусто, если окружение не задано или базовый файл не был прочитан
+func profileFile(v *viper.Viper) string {
+	base := v.ConfigFileUsed()
+	if base == "" {
+		return ""
+	}
+
+	env := os.Getenv(profileEnv)
+	if env == "" {
+		env = os.Getenv(profileFallbackEnv)
+	}
+	if env == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+// configName возвращает имя конфигурационного файла с учетом CONFIG_NAME
+func configName() string {
+	if name := os.Getenv(configNameEnv); name != "" {
+		return name
+	}
+	return defaultConfigName
+}
+
+// validateSecretKey проверяет, что ключ подписи достаточно длинный для HMAC
+func validateSecretKey(fl validator.FieldLevel) bool {
+	return len(fl.Field().String()) >= token.MinSecretKeySize
+}
+
+// describeValidationError заменяет малопонятные ошибки кастомных валидаторов на описательные
+func describeValidationError(err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	for _, fieldErr := range validationErrs {
+		if fieldErr.Tag() == secretKeyTag {
+			return fmt.Errorf("%s слишком короткий: нужно не менее %d байт, получено %d",
+				fieldErr.Namespace(), token.MinSecretKeySize, len(fieldErr.Value().(string)))
+		}
+	}
+
+	return err
+}
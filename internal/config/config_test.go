@@ -0,0 +1,388 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rx3lixir/auth-service/internal/token"
+)
+
+// testYAML минимальная корректная конфигурация dev окружения
+const testYAML = `
+service_params:
+  env: dev
+  session_ttl_days: 7
+  access_token_ttl_mins: 15
+  max_sessions_per_user: 10
+  rate_limit_rps: 50
+  rate_limit_burst: 100
+redis_params:
+  url: localhost:6379
+server_params:
+  address: 0.0.0.0:9092
+  secret_key: "36080001349340267925113477454910"
+  shutdown_timeout: 15s
+`
+
+// clearEnv сбрасывает переменные окружения, которые читает конфигурация,
+// чтобы окружение машины не влияло на тест
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	names := []string{configPathEnv, configNameEnv, profileEnv, profileFallbackEnv, loadDotenvEnv, dotenvPathEnv}
+	for _, env := range envBindings() {
+		names = append(names, env)
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// writeFile записывает файл в dir и возвращает путь к нему
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// loadYAML загружает конфигурацию из config.yaml с содержимым content,
+// дописанным поверх testYAML. Повторный ключ верхнего уровня заменяет секцию целиком,
+// поэтому переопределения передаются через env
+func loadYAML(t *testing.T, content string, env map[string]string) (*AppConfig, error) {
+	t.Helper()
+
+	clearEnv(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", testYAML+content)
+	t.Setenv(configPathEnv, dir)
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	return New()
+}
+
+// wantConfigError проверяет, что загрузка упала с ошибкой, упоминающей want
+func wantConfigError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("New succeeded, want an error mentioning %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("New error = %v, want it to mention %q", err, want)
+	}
+}
+
+func TestProdRequiresTLS(t *testing.T) {
+	_, err := loadYAML(t, "", map[string]string{"SERVICE_KEY": "prod"})
+	wantConfigError(t, err, tlsCertFileKey)
+
+	c, err := loadYAML(t, "", map[string]string{
+		"SERVICE_KEY":   "prod",
+		"TLS_CERT_FILE": "/etc/tls/server.crt",
+		"TLS_KEY_FILE":  "/etc/tls/server.key",
+	})
+	if err != nil {
+		t.Fatalf("New with TLS in prod: %v", err)
+	}
+	if !c.Server.TLSEnabled() {
+		t.Error("TLSEnabled = false with cert and key set")
+	}
+
+	// Без сертификата ключ бессмыслен
+	_, err = loadYAML(t, "", map[string]string{"TLS_KEY_FILE": "/etc/tls/server.key"})
+	wantConfigError(t, err, "TLSCertFile")
+}
+
+func TestShortSecretKeyFails(t *testing.T) {
+	_, err := loadYAML(t, "", map[string]string{"SECRET_KEY": "too-short"})
+	wantConfigError(t, err, "SecretKey")
+	wantConfigError(t, err, fmt.Sprintf("не менее %d байт", token.MinSecretKeySize))
+
+	if _, err := loadYAML(t, "", map[string]string{"SECRET_KEY": strings.Repeat("k", token.MinSecretKeySize)}); err != nil {
+		t.Fatalf("New with a %d byte key: %v", token.MinSecretKeySize, err)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Run("default path", func(t *testing.T) {
+		clearEnv(t)
+		cwd := t.TempDir()
+		dir := filepath.Join(cwd, "internal", "config")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		writeFile(t, dir, "config.yaml", testYAML)
+		t.Chdir(cwd)
+
+		c, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if c.Server.Address != "0.0.0.0:9092" {
+			t.Errorf("server address = %q, want the one from %s", c.Server.Address, dir)
+		}
+	})
+
+	t.Run("directory with CONFIG_NAME", func(t *testing.T) {
+		clearEnv(t)
+		dir := t.TempDir()
+		writeFile(t, dir, "auth.yaml", strings.Replace(testYAML, "0.0.0.0:9092", "0.0.0.0:9100", 1))
+		t.Setenv(configPathEnv, dir)
+		t.Setenv(configNameEnv, "auth")
+
+		c, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if c.Server.Address != "0.0.0.0:9100" {
+			t.Errorf("server address = %q, want 0.0.0.0:9100 from auth.yaml", c.Server.Address)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		clearEnv(t)
+		path := writeFile(t, t.TempDir(), "service.yaml", strings.Replace(testYAML, "0.0.0.0:9092", "0.0.0.0:9200", 1))
+		t.Setenv(configPathEnv, path)
+
+		c, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if c.Server.Address != "0.0.0.0:9200" {
+			t.Errorf("server address = %q, want 0.0.0.0:9200 from %s", c.Server.Address, path)
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		clearEnv(t)
+		missing := filepath.Join(t.TempDir(), "nope")
+		t.Setenv(configPathEnv, missing)
+
+		_, err := New()
+		wantConfigError(t, err, missing)
+	})
+
+	t.Run("missing file in directory", func(t *testing.T) {
+		clearEnv(t)
+		dir := t.TempDir()
+		t.Setenv(configPathEnv, dir)
+
+		_, err := New()
+		wantConfigError(t, err, configPathEnv+"="+dir)
+	})
+}
+
+func TestLoadFromEnvWithoutFile(t *testing.T) {
+	clearEnv(t)
+	t.Chdir(t.TempDir())
+
+	env := map[string]string{
+		"SERVICE_KEY":           "dev",
+		"SESSION_TTL_DAYS":      "7",
+		"ACCESS_TOKEN_TTL_MINS": "15",
+		"MAX_SESSIONS_PER_USER": "10",
+		"RATE_LIMIT_RPS":        "50",
+		"RATE_LIMIT_BURST":      "100",
+		"REDIS_URL":             "redis.internal:6379",
+		"SERVICE_ADDRESS":       "0.0.0.0:9092",
+		"SECRET_KEY":            "36080001349340267925113477454910",
+		"SHUTDOWN_TIMEOUT":      "15s",
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New without a config file: %v", err)
+	}
+	if c.Redis.URL != "redis.internal:6379" || c.Service.SessionTTLDays != 7 || c.Server.ShutdownTimeout != 15*time.Second {
+		t.Errorf("config = %+v, want values from the environment", c)
+	}
+
+	// Валидация по-прежнему выполняется
+	t.Setenv("REDIS_URL", "")
+	_, err = New()
+	wantConfigError(t, err, "Redis.URL")
+}
+
+func TestProfileOverlay(t *testing.T) {
+	const overlay = `
+service_params:
+  session_ttl_days: 3
+`
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantTTL int
+	}{
+		{"SERVICE_KEY", map[string]string{profileEnv: "test"}, 3},
+		{"ENV fallback", map[string]string{profileFallbackEnv: "test"}, 3},
+		{"env var wins over overlay", map[string]string{profileEnv: "test", "SESSION_TTL_DAYS": "5"}, 5},
+		{"no profile", nil, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			dir := t.TempDir()
+			writeFile(t, dir, "config.yaml", testYAML)
+			writeFile(t, dir, "config.test.yaml", overlay)
+			t.Setenv(configPathEnv, dir)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			c, err := New()
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if c.Service.SessionTTLDays != tt.wantTTL {
+				t.Errorf("session_ttl_days = %d, want %d", c.Service.SessionTTLDays, tt.wantTTL)
+			}
+			// Остальные значения секции остаются из базового файла
+			if c.Server.Address != "0.0.0.0:9092" || c.Service.AccessTokenTTLMins != 15 {
+				t.Errorf("address = %q, access_token_ttl_mins = %d, want base values", c.Server.Address, c.Service.AccessTokenTTLMins)
+			}
+		})
+	}
+
+	// Невалидный результат слияния отклоняется
+	clearEnv(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", testYAML)
+	writeFile(t, dir, "config.test.yaml", "service_params:\n  session_ttl_days: 0\n")
+	t.Setenv(configPathEnv, dir)
+	t.Setenv(profileEnv, "test")
+	_, err := New()
+	wantConfigError(t, err, "SessionTTLDays")
+}
+
+func TestRPCLatencyBucketList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "[]", false},
+		{"0.005, 0.05,0.5 ,5", "[0.005 0.05 0.5 5]", false},
+		{"0.1,,1", "[0.1 1]", false},
+		{"0.1,abc", "", true},
+		{"0,1", "", true},
+		{"-1", "", true},
+		{"1,0.5", "", true},
+		{"1,1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			params := ServiceParams{RPCLatencyBuckets: tt.value}
+			got, err := params.RPCLatencyBucketList()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("RPCLatencyBucketList(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RPCLatencyBucketList(%q): %v", tt.value, err)
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("RPCLatencyBucketList(%q) = %v, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	_, err := loadYAML(t, "", map[string]string{"RPC_LATENCY_BUCKETS": "0.5,0.1"})
+	wantConfigError(t, err, rpcBucketsKey)
+}
+
+func TestBlacklistRetentionValidation(t *testing.T) {
+	// access_token_ttl_mins в testYAML — 15 минут
+	_, err := loadYAML(t, "", map[string]string{"BLACKLIST_RETENTION": "10m"})
+	wantConfigError(t, err, blacklistRetentionKey)
+
+	for _, retention := range []string{"15m", "24h"} {
+		c, err := loadYAML(t, "", map[string]string{"BLACKLIST_RETENTION": retention})
+		if err != nil {
+			t.Fatalf("New with blacklist_retention %s: %v", retention, err)
+		}
+		if want, _ := time.ParseDuration(retention); c.Service.BlacklistRetention != want {
+			t.Errorf("blacklist_retention = %s, want %s", c.Service.BlacklistRetention, want)
+		}
+	}
+
+	// Без явного значения нижняя граница не задана
+	if _, err := loadYAML(t, "", nil); err != nil {
+		t.Fatalf("New without blacklist_retention: %v", err)
+	}
+}
+
+func TestDotenv(t *testing.T) {
+	const dotenv = "SESSION_TTL_DAYS=3\nSERVICE_ADDRESS=127.0.0.1:7000\n"
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		chdir       bool // .env лежит в рабочей директории, DOTENV_PATH не задан
+		wantTTL     int
+		wantAddress string
+	}{
+		{"DOTENV_PATH", map[string]string{loadDotenvEnv: "true"}, false, 3, "127.0.0.1:7000"},
+		{"working directory", map[string]string{loadDotenvEnv: "true"}, true, 3, "127.0.0.1:7000"},
+		{"env var wins over .env", map[string]string{loadDotenvEnv: "true", "SERVICE_ADDRESS": "0.0.0.0:9999"}, false, 3, "0.0.0.0:9999"},
+		{"disabled", map[string]string{loadDotenvEnv: "false"}, false, 7, "0.0.0.0:9092"},
+		{"not set", nil, false, 7, "0.0.0.0:9092"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// clearEnv восстанавливает и переменные, выставленные из .env
+			clearEnv(t)
+			dir := t.TempDir()
+			writeFile(t, dir, "config.yaml", testYAML)
+			path := writeFile(t, dir, ".env", dotenv)
+			t.Setenv(configPathEnv, dir)
+			if tt.chdir {
+				t.Chdir(dir)
+			} else {
+				t.Setenv(dotenvPathEnv, path)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			c, err := New()
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if c.Service.SessionTTLDays != tt.wantTTL || c.Server.Address != tt.wantAddress {
+				t.Errorf("session_ttl_days = %d, address = %s, want %d, %s", c.Service.SessionTTLDays, c.Server.Address, tt.wantTTL, tt.wantAddress)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := loadYAML(t, "", map[string]string{loadDotenvEnv: "true", dotenvPathEnv: filepath.Join(t.TempDir(), ".env")})
+		if err != nil {
+			t.Errorf("New with a missing .env: %v", err)
+		}
+	})
+
+	t.Run("invalid LOAD_DOTENV", func(t *testing.T) {
+		_, err := loadYAML(t, "", map[string]string{loadDotenvEnv: "maybe"})
+		wantConfigError(t, err, loadDotenvEnv)
+	})
+}
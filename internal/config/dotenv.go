@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+// Переменные окружения, включающие загрузку .env файла для локальной разработки
+const (
+	loadDotenvEnv = "LOAD_DOTENV" // true = загрузить .env перед чтением конфигурации
+	dotenvPathEnv = "DOTENV_PATH" // Путь к файлу, по умолчанию .env в рабочей директории
+)
+
+// defaultDotenvPath файл переменных окружения по умолчанию
+const defaultDotenvPath = ".env"
+
+// loadDotenv загружает переменные из .env, если LOAD_DOTENV включен.
+// Уже заданные переменные окружения не перезаписываются, поэтому имеют приоритет
+// над файлом. Отсутствие файла не ошибка: .env нужен только при локальном запуске
+func loadDotenv() error {
+	value := os.Getenv(loadDotenvEnv)
+	if value == "" {
+		return nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("некорректное значение %s=%q: %w", loadDotenvEnv, value, err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	path := os.Getenv(dotenvPathEnv)
+	if path == "" {
+		path = defaultDotenvPath
+	}
+
+	if err := godotenv.Load(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+var (
+	watchMu sync.Mutex
+	// loaded viper, из которого была загружена последняя конфигурация
+	loaded *viper.Viper
+	// watching запущено ли отслеживание файла
+	watching bool
+)
+
+// Watch отслеживает изменения конфигурационного файла и вызывает onChange
+// с новой конфигурацией, если она прошла валидацию. Некорректные правки
+// игнорируются с предупреждением в лог. Отслеживается только базовый файл,
+// профиль окружения перечитывается вместе с ним. Вызывается после New
+func Watch(onChange func(*AppConfig)) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	if loaded == nil {
+		return fmt.Errorf("конфигурация еще не загружена")
+	}
+
+	if loaded.ConfigFileUsed() == "" {
+		return fmt.Errorf("конфигурация загружена без файла, отслеживать нечего")
+	}
+
+	if watching {
+		return fmt.Errorf("отслеживание конфигурации уже запущено")
+	}
+
+	v := loaded
+	v.OnConfigChange(func(e fsnotify.Event) {
+		// ReadInConfig при изменении файла сбрасывает наложенный профиль
+		if err := mergeProfile(v); err != nil {
+			logger.Warn("Ignoring invalid config change", "file", e.Name, "error", err)
+			return
+		}
+
+		config, err := decode(v)
+		if err != nil {
+			logger.Warn("Ignoring invalid config change", "file", e.Name, "error", err)
+			return
+		}
+
+		onChange(config)
+	})
+	v.WatchConfig()
+	watching = true
+
+	return nil
+}
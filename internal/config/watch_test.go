@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	// Watch запускается один раз за процесс; сбрасываем флаг для повторных прогонов
+	t.Cleanup(func() {
+		watchMu.Lock()
+		watching = false
+		watchMu.Unlock()
+	})
+
+	if _, err := loadYAML(t, "", nil); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	path := loaded.ConfigFileUsed()
+
+	changes := make(chan *AppConfig, 1)
+	if err := Watch(func(c *AppConfig) {
+		select {
+		case changes <- c:
+		default:
+		}
+	}); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// Файл заменяется атомарно: наполовину записанный конфиг не проходит валидацию,
+	// а предупреждение о нем ушло бы в неинициализированный глобальный логгер
+	updated := strings.Replace(testYAML, "session_ttl_days: 7", "session_ttl_days: 3", 1)
+	tmp := writeFile(t, filepath.Dir(path), "config.yaml.tmp", updated)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	select {
+	case c := <-changes:
+		if c.Service.SessionTTLDays != 3 {
+			t.Errorf("reloaded session_ttl_days = %d, want 3", c.Service.SessionTTLDays)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch callback did not fire after the config file changed")
+	}
+
+	if err := Watch(func(*AppConfig) {}); err == nil {
+		t.Error("second Watch succeeded, want an error")
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// CachedStore оборачивает SessionStorage LRU кешем недавно прочитанных сессий.
+// Чтение всегда идет сначала в основное хранилище; кеш используется только
+// когда хранилище недоступно, чтобы короткий сбой Redis не ломал проверку
+// уже известных сессий. Запись по-прежнему требует доступного хранилища.
+//
+// Методы записи удаляют сессию из кеша до и после вызова хранилища: параллельный
+// GetSession может успеть положить в кеш версию, прочитанную до записи
+type CachedStore struct {
+	SessionStorage
+	cache *expirable.LRU[string, Session]
+	clock Clock
+}
+
+var _ SessionStorage = (*CachedStore)(nil)
+
+// NewCachedStore создает кеширующую обертку над хранилищем.
+// size — максимальное число сессий в кеше, ttl — время жизни записи.
+// Из opts используется только WithClock
+func NewCachedStore(backend SessionStorage, size int, ttl time.Duration, opts ...Option) *CachedStore {
+	config := defaultConfig()
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return &CachedStore{
+		SessionStorage: backend,
+		cache:          expirable.NewLRU[string, Session](size, nil, ttl),
+		clock:          config.Clock,
+	}
+}
+
+// GetSession читает сессию из хранилища и запоминает ее.
+// При недоступности хранилища возвращает сессию из кеша, если она там есть
+func (s *CachedStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	session, err := s.SessionStorage.GetSession(ctx, id)
+	if err == nil {
+		s.cache.Add(id, *session)
+		return session, nil
+	}
+
+	// Сессии нет в хранилище: кеш больше не актуален
+	if errors.Is(err, ErrSessionNotFound) {
+		s.cache.Remove(id)
+		return nil, err
+	}
+
+	cached, ok := s.cache.Get(id)
+	if !ok || !s.clock.Now().Before(cached.ExpiresAt) {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+// IsSessionValid проверяет сессию в хранилище. Действительная сессия, которой еще нет
+// в кеше, дочитывается туда, чтобы проверки токенов переживали сбой хранилища.
+// При недоступности хранилища ответ строится по кешу: отозванная, истекшая или
+// отсутствующая в кеше сессия недействительна
+func (s *CachedStore) IsSessionValid(ctx context.Context, id string) (bool, string, error) {
+	valid, reason, err := s.SessionStorage.IsSessionValid(ctx, id)
+	if err == nil {
+		if !valid {
+			s.cache.Remove(id)
+		} else if !s.cache.Contains(id) {
+			// Ошибка чтения не отменяет уже полученный ответ
+			s.GetSession(ctx, id)
+		}
+		return valid, reason, nil
+	}
+
+	if id == "" {
+		return false, "", err
+	}
+
+	cached, ok := s.cache.Get(id)
+	if !ok {
+		return false, SessionReasonNotFound, nil
+	}
+
+	reason = sessionValidity(&cached, false, s.clock.Now())
+	return reason == SessionReasonValid, reason, nil
+}
+
+// RevokeSession отзывает сессию и удаляет ее из кеша
+func (s *CachedStore) RevokeSession(ctx context.Context, id string, reason RevokeReason) error {
+	s.cache.Remove(id)
+	defer s.cache.Remove(id)
+
+	return s.SessionStorage.RevokeSession(ctx, id, reason)
+}
+
+// RevokeAllUserSessions отзывает все сессии пользователя и удаляет их из кеша
+func (s *CachedStore) RevokeAllUserSessions(ctx context.Context, email string, reason RevokeReason) (int, error) {
+	s.removeUser(email)
+	defer s.removeUser(email)
+
+	return s.SessionStorage.RevokeAllUserSessions(ctx, email, reason)
+}
+
+// RevokeUserSessions отзывает сессии пользователя и удаляет их из кеша.
+// Пробный запуск кеш не трогает
+func (s *CachedStore) RevokeUserSessions(ctx context.Context, email string, reason RevokeReason, dryRun bool) ([]string, error) {
+	if !dryRun {
+		s.removeUser(email)
+		defer s.removeUser(email)
+	}
+	return s.SessionStorage.RevokeUserSessions(ctx, email, reason, dryRun)
+}
+
+// removeUser удаляет из кеша все сессии пользователя
+func (s *CachedStore) removeUser(email string) {
+	for _, session := range s.cache.Values() {
+		if session.UserEmail == email {
+			s.cache.Remove(session.Id)
+		}
+	}
+}
+
+// RotateRefreshToken меняет refresh токен и удаляет сессию из кеша
+func (s *CachedStore) RotateRefreshToken(ctx context.Context, sessionID, newRefreshToken string) error {
+	s.cache.Remove(sessionID)
+	defer s.cache.Remove(sessionID)
+
+	return s.SessionStorage.RotateRefreshToken(ctx, sessionID, newRefreshToken)
+}
+
+// RehashRefreshToken переводит refresh токен сессии на хеш и удаляет сессию из кеша
+func (s *CachedStore) RehashRefreshToken(ctx context.Context, sessionID, token string) error {
+	s.cache.Remove(sessionID)
+	defer s.cache.Remove(sessionID)
+
+	return s.SessionStorage.RehashRefreshToken(ctx, sessionID, token)
+}
+
+// ExtendSession продлевает сессию и удаляет ее из кеша
+func (s *CachedStore) ExtendSession(ctx context.Context, id string, ttl time.Duration) error {
+	s.cache.Remove(id)
+	defer s.cache.Remove(id)
+
+	return s.SessionStorage.ExtendSession(ctx, id, ttl)
+}
+
+// UpdateSessionLabel меняет название сессии и удаляет ее из кеша
+func (s *CachedStore) UpdateSessionLabel(ctx context.Context, id, label string) error {
+	s.cache.Remove(id)
+	defer s.cache.Remove(id)
+
+	return s.SessionStorage.UpdateSessionLabel(ctx, id, label)
+}
+
+// DeleteSession удаляет сессию из хранилища и кеша
+func (s *CachedStore) DeleteSession(ctx context.Context, id string) error {
+	s.cache.Remove(id)
+	defer s.cache.Remove(id)
+
+	return s.SessionStorage.DeleteSession(ctx, id)
+}
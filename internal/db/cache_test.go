@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errOutage = errors.New("redis: connection refused")
+
+// outageStore хранилище, чтение из которого можно "отключить"
+type outageStore struct {
+	SessionStorage
+	down bool
+
+	// duringRevoke вызывается внутри RevokeSession до записи в хранилище
+	duringRevoke func()
+}
+
+func (s *outageStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	if s.down {
+		return nil, errOutage
+	}
+	return s.SessionStorage.GetSession(ctx, id)
+}
+
+func (s *outageStore) IsSessionValid(ctx context.Context, id string) (bool, string, error) {
+	if s.down {
+		return false, "", errOutage
+	}
+	return s.SessionStorage.IsSessionValid(ctx, id)
+}
+
+func (s *outageStore) RevokeSession(ctx context.Context, id string, reason RevokeReason) error {
+	if s.duringRevoke != nil {
+		s.duringRevoke()
+	}
+	return s.SessionStorage.RevokeSession(ctx, id, reason)
+}
+
+func newTestCachedStore(t *testing.T) (*CachedStore, *outageStore, *fakeClock) {
+	t.Helper()
+
+	clock := newFakeClock()
+	backend := &outageStore{SessionStorage: NewMemoryStore(WithClock(clock))}
+	store := NewCachedStore(backend, 16, time.Hour, WithClock(clock))
+
+	if _, err := store.CreateSession(context.Background(), newTestSession("s1", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	// Прогреваем кеш
+	if _, err := store.GetSession(context.Background(), "s1"); err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+
+	return store, backend, clock
+}
+
+func TestCachedStoreServesCacheDuringOutage(t *testing.T) {
+	store, backend, clock := newTestCachedStore(t)
+	ctx := context.Background()
+
+	backend.down = true
+	got, err := store.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession during outage: %v", err)
+	}
+	if got.Id != "s1" {
+		t.Errorf("GetSession = %s, want s1", got.Id)
+	}
+
+	if _, err := store.GetSession(ctx, "unknown"); !errors.Is(err, errOutage) {
+		t.Errorf("GetSession(unknown) error = %v, want %v", err, errOutage)
+	}
+
+	// Истекшую по часам хранилища сессию кеш не отдает
+	clock.Advance(25 * time.Hour)
+	if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, errOutage) {
+		t.Errorf("GetSession of expired session error = %v, want %v", err, errOutage)
+	}
+}
+
+func TestCachedStoreInvalidatesOnWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(ctx context.Context, s *CachedStore) error
+	}{
+		{"RevokeSession", func(ctx context.Context, s *CachedStore) error {
+			return s.RevokeSession(ctx, "s1", RevokeReasonLogout)
+		}},
+		{"RevokeAllUserSessions", func(ctx context.Context, s *CachedStore) error {
+			_, err := s.RevokeAllUserSessions(ctx, "user@example.com", RevokeReasonAdmin)
+			return err
+		}},
+		{"RevokeUserSessions", func(ctx context.Context, s *CachedStore) error {
+			_, err := s.RevokeUserSessions(ctx, "user@example.com", RevokeReasonAdmin, false)
+			return err
+		}},
+		{"RotateRefreshToken", func(ctx context.Context, s *CachedStore) error {
+			return s.RotateRefreshToken(ctx, "s1", "refresh-new")
+		}},
+		{"ExtendSession", func(ctx context.Context, s *CachedStore) error {
+			return s.ExtendSession(ctx, "s1", time.Hour)
+		}},
+		{"UpdateSessionLabel", func(ctx context.Context, s *CachedStore) error {
+			return s.UpdateSessionLabel(ctx, "s1", "laptop")
+		}},
+		{"DeleteSession", func(ctx context.Context, s *CachedStore) error {
+			return s.DeleteSession(ctx, "s1")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, backend, _ := newTestCachedStore(t)
+			ctx := context.Background()
+
+			if err := tt.write(ctx, store); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			backend.down = true
+			if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, errOutage) {
+				t.Errorf("GetSession after %s error = %v, want %v: stale session served from cache", tt.name, err, errOutage)
+			}
+		})
+	}
+}
+
+func TestCachedStoreDropsSessionReadDuringWrite(t *testing.T) {
+	store, backend, _ := newTestCachedStore(t)
+	ctx := context.Background()
+
+	// Чтение, попавшее между удалением из кеша и записью, кладет в кеш старую версию
+	backend.duringRevoke = func() {
+		if _, err := store.GetSession(ctx, "s1"); err != nil {
+			t.Errorf("GetSession during revoke: %v", err)
+		}
+	}
+
+	if err := store.RevokeSession(ctx, "s1", RevokeReasonLogout); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	backend.down = true
+	if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, errOutage) {
+		t.Errorf("GetSession after revoke error = %v, want %v: pre-revoke version left in cache", err, errOutage)
+	}
+}
+
+func TestCachedStoreForgetsDeletedSession(t *testing.T) {
+	store, backend, _ := newTestCachedStore(t)
+	ctx := context.Background()
+
+	// Сессия удалена в обход кеша, например другим экземпляром сервиса
+	if err := backend.SessionStorage.DeleteSession(ctx, "s1"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetSession error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	backend.down = true
+	if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, errOutage) {
+		t.Errorf("GetSession during outage error = %v, want %v", err, errOutage)
+	}
+}
+
+func TestCachedStoreIsSessionValidDuringOutage(t *testing.T) {
+	store, backend, clock := newTestCachedStore(t)
+	ctx := context.Background()
+
+	// Сессия, которую проверяли, но не читали: IsSessionValid сам кладет ее в кеш
+	if _, err := store.CreateSession(ctx, newTestSession("s2", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if valid, _, err := store.IsSessionValid(ctx, "s2"); err != nil || !valid {
+		t.Fatalf("IsSessionValid(s2) = %v, %v, want valid", valid, err)
+	}
+
+	// Отозванная до сбоя сессия не должна стать действительной по кешу
+	if _, err := store.CreateSession(ctx, newTestSession("s3", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := store.GetSession(ctx, "s3"); err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if err := backend.SessionStorage.RevokeSession(ctx, "s3", RevokeReasonLogout); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if valid, reason, err := store.IsSessionValid(ctx, "s3"); err != nil || valid || reason != SessionReasonRevoked {
+		t.Fatalf("IsSessionValid(s3) = %v, %q, %v, want revoked", valid, reason, err)
+	}
+
+	backend.down = true
+
+	tests := []struct {
+		id         string
+		wantValid  bool
+		wantReason string
+	}{
+		{"s1", true, SessionReasonValid},
+		{"s2", true, SessionReasonValid},
+		{"s3", false, SessionReasonNotFound},
+		{"unknown", false, SessionReasonNotFound},
+	}
+	for _, tt := range tests {
+		valid, reason, err := store.IsSessionValid(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("IsSessionValid(%s) during outage: %v", tt.id, err)
+		}
+		if valid != tt.wantValid || reason != tt.wantReason {
+			t.Errorf("IsSessionValid(%s) = %v, %q, want %v, %q", tt.id, valid, reason, tt.wantValid, tt.wantReason)
+		}
+	}
+
+	clock.Advance(25 * time.Hour)
+	if valid, reason, err := store.IsSessionValid(ctx, "s1"); err != nil || valid || reason != SessionReasonExpired {
+		t.Errorf("IsSessionValid of expired cached session = %v, %q, %v, want expired", valid, reason, err)
+	}
+
+	if _, _, err := store.IsSessionValid(ctx, ""); err == nil {
+		t.Error("IsSessionValid accepted an empty ID")
+	}
+}
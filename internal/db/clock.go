@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+// Clock источник текущего времени для хранилищ. Подменяется в тестах,
+// чтобы проверять истечение сессий без ожидания
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock системные часы (по умолчанию)
+type SystemClock struct{}
+
+// Now возвращает текущее системное время
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
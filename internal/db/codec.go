@@ -0,0 +1,102 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Имена кодеков сессий для конфигурации
+const (
+	CodecJSON = "json"
+	CodecGzip = "gzip"
+)
+
+// gzipMagic первые байты любого gzip потока; по ним чтение отличает сжатые сессии от JSON
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// SessionCodec сериализует сессии для хранения в Redis. Кодек выбирает только
+// формат записи: Unmarshal обязан читать и сессии, записанные другими кодеками,
+// чтобы смена кодека не ломала уже сохраненные сессии
+type SessionCodec interface {
+	Marshal(session *Session) ([]byte, error)
+	Unmarshal(data []byte, session *Session) error
+}
+
+// JSONCodec хранит сессии обычным JSON (по умолчанию)
+type JSONCodec struct{}
+
+// Marshal сериализует сессию в JSON
+func (JSONCodec) Marshal(session *Session) ([]byte, error) {
+	return json.Marshal(session)
+}
+
+// Unmarshal читает сессию в любом поддерживаемом формате
+func (JSONCodec) Unmarshal(data []byte, session *Session) error {
+	return decodeSession(data, session)
+}
+
+// GzipCodec хранит сессии JSON, сжатым gzip. Выгоден для сессий с метаданными;
+// короткие сессии почти не сжимаются
+type GzipCodec struct{}
+
+// Marshal сериализует сессию в JSON и сжимает его
+func (GzipCodec) Marshal(session *Session) ([]byte, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress session: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress session: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal читает сессию в любом поддерживаемом формате
+func (GzipCodec) Unmarshal(data []byte, session *Session) error {
+	return decodeSession(data, session)
+}
+
+// SessionCodecByName возвращает кодек по имени из конфигурации, пустое имя = JSON
+func SessionCodecByName(name string) (SessionCodec, error) {
+	switch name {
+	case "", CodecJSON:
+		return JSONCodec{}, nil
+	case CodecGzip:
+		return GzipCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown session codec %q", name)
+	}
+}
+
+// decodeSession определяет формат по первым байтам: gzip или JSON.
+// Время приводится к UTC и для сессий, записанных до перехода на UTC
+func decodeSession(data []byte, session *Session) error {
+	if bytes.HasPrefix(data, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress session: %w", err)
+		}
+		defer zr.Close()
+
+		if data, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("failed to decompress session: %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(data, session); err != nil {
+		return err
+	}
+
+	session.normalizeTimes()
+	return nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCodecTestSession сессия с метаданными, на которой заметна разница кодеков
+func newCodecTestSession() *Session {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := newTestSession("s1", "user@example.com", now)
+	session.Metadata = map[string]string{}
+	for i := 0; i < MaxSessionMetadataKeys; i++ {
+		session.Metadata[fmt.Sprintf("key-%d", i)] = strings.Repeat("value ", 20)
+	}
+	return session
+}
+
+func TestSessionCodecRoundTrip(t *testing.T) {
+	session := newCodecTestSession()
+
+	for _, codec := range []SessionCodec{JSONCodec{}, GzipCodec{}} {
+		t.Run(fmt.Sprintf("%T", codec), func(t *testing.T) {
+			data, err := codec.Marshal(session)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			var got Session
+			if err := codec.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(&got, session) {
+				t.Errorf("round trip = %+v, want %+v", got, *session)
+			}
+		})
+	}
+}
+
+func TestRedisStoreGzipReadsJSONSessions(t *testing.T) {
+	clock := newFakeClock()
+	jsonStore, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	if _, err := jsonStore.CreateSession(ctx, newTestSession("s1", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// Переключение кодека не должно ломать сессии, записанные до него
+	gzipStore, err := NewRedisStore("redis://"+mr.Addr(), ctx, WithClock(clock), WithCodec(GzipCodec{}))
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { gzipStore.Close() })
+
+	got, err := gzipStore.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession of a JSON session under gzip: %v", err)
+	}
+	if got.UserEmail != "user@example.com" || !got.RefreshTokenMatches("refresh-s1") {
+		t.Errorf("GetSession = %+v, want the JSON session", got)
+	}
+
+	if valid, reason, err := gzipStore.IsSessionValid(ctx, "s1"); err != nil || !valid {
+		t.Errorf("IsSessionValid = %v, %q, %v, want valid", valid, reason, err)
+	}
+
+	// Новые записи сжимаются, и JSON хранилище их тоже читает
+	if err := gzipStore.UpdateSessionLabel(ctx, "s1", "laptop"); err != nil {
+		t.Fatalf("UpdateSessionLabel: %v", err)
+	}
+	raw, err := mr.Get(gzipStore.keys.session + "s1")
+	if err != nil {
+		t.Fatalf("raw session: %v", err)
+	}
+	if !strings.HasPrefix(raw, string(gzipMagic)) {
+		t.Error("session rewritten under gzip is not compressed")
+	}
+	if got, err := jsonStore.GetSession(ctx, "s1"); err != nil || got.Label != "laptop" {
+		t.Errorf("JSON store GetSession = %+v, %v, want label laptop", got, err)
+	}
+}
+
+func BenchmarkSessionCodecSize(b *testing.B) {
+	session := newCodecTestSession()
+
+	for _, codec := range []SessionCodec{JSONCodec{}, GzipCodec{}} {
+		b.Run(fmt.Sprintf("%T", codec), func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := codec.Marshal(session)
+				if err != nil {
+					b.Fatalf("Marshal: %v", err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/session")
+		})
+	}
+}
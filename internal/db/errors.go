@@ -0,0 +1,18 @@
+package db
+
+import "errors"
+
+var (
+	// ErrSessionNotFound сессия не найдена или уже истекла
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionRevoked операция недопустима для отозванной сессии
+	ErrSessionRevoked = errors.New("session is revoked")
+	// ErrLabelTooLong название сессии длиннее MaxSessionLabelLength
+	ErrLabelTooLong = errors.New("session label is too long")
+	// ErrInvalidMetadata метаданные сессии с пустым ключом или больше допустимых размеров
+	ErrInvalidMetadata = errors.New("invalid session metadata")
+	// ErrInvalidExpiry время истечения сессии не задано, уже прошло или дальше MaxSessionLifetime
+	ErrInvalidExpiry = errors.New("invalid session expiration time")
+	// ErrInvalidCursor курсор страницы поврежден или получен не от хранилища
+	ErrInvalidCursor = errors.New("invalid page cursor")
+)
@@ -0,0 +1,792 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryEntry сессия и время истечения ее ключа (аналог TTL в Redis)
+type memoryEntry struct {
+	session   Session
+	expiresAt time.Time
+}
+
+// MemoryStore реализует SessionStorage в памяти процесса.
+// Повторяет поведение RedisStore, включая TTL ключей и индекс сессий пользователя,
+// и предназначен для тестов, которым не нужен настоящий Redis
+type MemoryStore struct {
+	mu                 sync.RWMutex
+	sessions           map[string]*memoryEntry
+	userSessions       map[string]map[string]struct{}
+	blacklist          map[string]time.Time
+	createMarks        map[string][]time.Time // Отметки создания сессий для AllowSessionCreate
+	subscribers        map[chan RevocationEvent]struct{}
+	maxSessionsPerUser int
+	blacklistRetention time.Duration
+	clock              Clock
+	closed             bool
+}
+
+var _ SessionStorage = (*MemoryStore)(nil)
+
+// NewMemoryStore создает новое хранилище в памяти
+func NewMemoryStore(opts ...Option) *MemoryStore {
+	config := defaultConfig()
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return &MemoryStore{
+		sessions:           make(map[string]*memoryEntry),
+		userSessions:       make(map[string]map[string]struct{}),
+		blacklist:          make(map[string]time.Time),
+		createMarks:        make(map[string][]time.Time),
+		subscribers:        make(map[chan RevocationEvent]struct{}),
+		maxSessionsPerUser: config.MaxSessionsPerUser,
+		blacklistRetention: config.BlacklistRetention,
+		clock:              config.Clock,
+	}
+}
+
+// Close закрывает хранилище и все подписки на события отзыва
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+	s.closed = true
+
+	return nil
+}
+
+// CreateSession создает новую сессию
+func (s *MemoryStore) CreateSession(ctx context.Context, session *Session) (*Session, error) {
+	if session.Id == "" {
+		return nil, fmt.Errorf("session ID is required")
+	}
+
+	if session.UserEmail == "" {
+		return nil, fmt.Errorf("user email is required")
+	}
+
+	if session.RefreshToken == "" {
+		return nil, fmt.Errorf("refresh token is required")
+	}
+
+	if err := validateLabel(session.Label); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateMetadata(session.Metadata); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+
+	if err := session.ValidateExpiry(now); err != nil {
+		return nil, err
+	}
+
+	session.normalizeTimes()
+	ttl := session.ExpiresAt.Sub(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *session
+	stored.RefreshToken = refreshTokenHash(session.RefreshToken)
+	s.setLocked(stored, ttl)
+
+	index, ok := s.userSessions[session.UserEmail]
+	if !ok {
+		index = make(map[string]struct{})
+		s.userSessions[session.UserEmail] = index
+	}
+	index[session.Id] = struct{}{}
+
+	s.evictExcessLocked(session)
+
+	return session, nil
+}
+
+// evictExcessLocked удаляет самые старые сессии пользователя сверх лимита.
+// Вызывается под мьютексом на запись
+func (s *MemoryStore) evictExcessLocked(created *Session) {
+	if s.maxSessionsPerUser <= 0 {
+		return
+	}
+
+	index := s.userSessions[created.UserEmail]
+	if len(index) <= s.maxSessionsPerUser {
+		return
+	}
+
+	candidates := make([]Session, 0, len(index))
+	for id := range index {
+		if id == created.Id {
+			continue
+		}
+
+		entry, ok := s.getLocked(id)
+		if !ok {
+			delete(index, id)
+			continue
+		}
+		candidates = append(candidates, entry.session)
+	}
+
+	excess := len(candidates) - (s.maxSessionsPerUser - 1)
+	if excess <= 0 {
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+
+	for _, session := range candidates[:excess] {
+		s.deleteLocked(&session)
+	}
+}
+
+// BatchCreateSessions создает сессии по одной, собирая ошибки по каждой
+func (s *MemoryStore) BatchCreateSessions(ctx context.Context, sessions []*Session) ([]error, error) {
+	itemErrs := make([]error, len(sessions))
+	for i, session := range sessions {
+		_, itemErrs[i] = s.CreateSession(ctx, session)
+	}
+	return itemErrs, nil
+}
+
+// GetSession получает сессию по ID
+func (s *MemoryStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	if id == "" {
+		return nil, fmt.Errorf("session ID is required")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	session := entry.session
+	return &session, nil
+}
+
+// GetSessionByRefreshToken находит сессию по сырому refresh токену
+func (s *MemoryStore) GetSessionByRefreshToken(ctx context.Context, token string) (*Session, error) {
+	if token == "" {
+		return nil, fmt.Errorf("refresh token is required")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := refreshTokenHash(token)
+	for id := range s.sessions {
+		entry, ok := s.getLocked(id)
+		if ok && entry.session.RefreshToken == hash {
+			session := entry.session
+			return &session, nil
+		}
+	}
+
+	return nil, ErrSessionNotFound
+}
+
+// BatchGetSessions получает несколько сессий; отсутствующие пропускаются
+func (s *MemoryStore) BatchGetSessions(ctx context.Context, ids []string) (map[string]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make(map[string]*Session, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		if entry, ok := s.getLocked(id); ok {
+			session := entry.session
+			sessions[id] = &session
+		}
+	}
+
+	return sessions, nil
+}
+
+// GetSessionsByEmail получает все активные сессии пользователя
+func (s *MemoryStore) GetSessionsByEmail(ctx context.Context, email string) ([]*Session, error) {
+	if email == "" {
+		return nil, fmt.Errorf("user email is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]*Session, 0)
+	for id := range s.userSessions[email] {
+		entry, ok := s.getLocked(id)
+		if !ok {
+			// Как и RedisStore, чиним индекс при чтении
+			delete(s.userSessions[email], id)
+			continue
+		}
+
+		if entry.session.UserEmail == email && !entry.session.IsRevoked {
+			session := entry.session
+			sessions = append(sessions, &session)
+		}
+	}
+
+	return sessions, nil
+}
+
+// GetSessionsByEmailPaged возвращает страницу активных сессий пользователя и курсор следующей
+func (s *MemoryStore) GetSessionsByEmailPaged(ctx context.Context, email, cursor string, limit int) ([]*Session, string, error) {
+	sessions, err := s.GetSessionsByEmail(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return pageSessions(sessions, cursor, limit)
+}
+
+// CountActiveSessions возвращает количество сессий пользователя, удаляя из индекса истекшие
+func (s *MemoryStore) CountActiveSessions(ctx context.Context, email string) (int64, error) {
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(email)
+
+	return int64(len(s.userSessions[email])), nil
+}
+
+// PruneUserIndex удаляет из индекса пользователя ID истекших сессий
+func (s *MemoryStore) PruneUserIndex(ctx context.Context, email string) (int, error) {
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pruneLocked(email), nil
+}
+
+// ReconcileUser удаляет из индекса ID истекших сессий и сессий другого пользователя
+func (s *MemoryStore) ReconcileUser(ctx context.Context, email string) (int, error) {
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reconcileLocked(email), nil
+}
+
+// ReapUserIndexes удаляет висячие ID из индексов всех пользователей
+func (s *MemoryStore) ReapUserIndexes(ctx context.Context) (*ReapResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &ReapResult{}
+	for email := range s.userSessions {
+		result.UsersScanned++
+		result.PrunedIDs += s.reconcileLocked(email)
+	}
+
+	return result, nil
+}
+
+// SessionStats считает действующие сессии и пользователей, у которых они есть
+func (s *MemoryStore) SessionStats(ctx context.Context) (*SessionStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &SessionStats{SnapshotTime: s.clock.Now().UTC()}
+	for _, index := range s.userSessions {
+		var active int64
+		for id := range index {
+			if _, ok := s.getLocked(id); ok {
+				active++
+			}
+		}
+
+		if active > 0 {
+			stats.UniqueUsers++
+			stats.ActiveSessions += active
+		}
+	}
+
+	return stats, nil
+}
+
+// reconcileLocked чистит индекс пользователя. Вызывается под мьютексом на запись
+func (s *MemoryStore) reconcileLocked(email string) int {
+	removed := s.pruneLocked(email)
+
+	for id := range s.userSessions[email] {
+		if entry, ok := s.getLocked(id); ok && entry.session.UserEmail != email {
+			delete(s.userSessions[email], id)
+			removed++
+		}
+	}
+
+	if len(s.userSessions[email]) == 0 {
+		delete(s.userSessions, email)
+	}
+
+	return removed
+}
+
+// pruneLocked удаляет из индекса ID истекших сессий. Вызывается под мьютексом на запись
+func (s *MemoryStore) pruneLocked(email string) int {
+	removed := 0
+	for id := range s.userSessions[email] {
+		if _, ok := s.getLocked(id); !ok {
+			delete(s.userSessions[email], id)
+			removed++
+		}
+	}
+
+	if len(s.userSessions[email]) == 0 {
+		delete(s.userSessions, email)
+	}
+
+	return removed
+}
+
+// RevokeSession отзывает сессию; отзыв уже отозванной сессии не является ошибкой
+func (s *MemoryStore) RevokeSession(ctx context.Context, id string, reason RevokeReason) error {
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if entry.session.IsRevoked {
+		return nil
+	}
+
+	s.revokeLocked(entry.session, reason)
+
+	return nil
+}
+
+// revokeLocked помечает сессию отозванной и добавляет токен в черный список.
+// Вызывается под мьютексом на запись
+func (s *MemoryStore) revokeLocked(session Session, reason RevokeReason) {
+	now := s.clock.Now()
+	ttl := session.ExpiresAt.Sub(now)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	s.blacklist[session.RefreshToken] = now.Add(blacklistTTL(now, session.ExpiresAt, s.blacklistRetention))
+
+	session.IsRevoked = true
+	session.RevokedReason = reason.orUnspecified()
+	s.setLocked(session, ttl)
+}
+
+// RevokeAllUserSessions отзывает все сессии пользователя и очищает его индекс
+func (s *MemoryStore) RevokeAllUserSessions(ctx context.Context, email string, reason RevokeReason) (int, error) {
+	ids, err := s.RevokeUserSessions(ctx, email, reason, false)
+	return len(ids), err
+}
+
+// RevokeUserSessions отзывает действующие сессии пользователя и возвращает их ID.
+// При dryRun только возвращает список
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, email string, reason RevokeReason, dryRun bool) ([]string, error) {
+	if email == "" {
+		return nil, fmt.Errorf("user email is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revokedIDs := make([]string, 0, len(s.userSessions[email]))
+	for id := range s.userSessions[email] {
+		entry, ok := s.getLocked(id)
+		if !ok || entry.session.UserEmail != email || entry.session.IsRevoked {
+			continue
+		}
+
+		if !dryRun {
+			s.revokeLocked(entry.session, reason)
+		}
+		revokedIDs = append(revokedIDs, id)
+	}
+	sort.Strings(revokedIDs)
+
+	if !dryRun {
+		delete(s.userSessions, email)
+	}
+
+	return revokedIDs, nil
+}
+
+// RotateRefreshToken заменяет refresh токен сессии, добавляя старый в черный список
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, sessionID, newRefreshToken string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if newRefreshToken == "" {
+		return fmt.Errorf("new refresh token is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(sessionID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	if entry.session.IsRevoked {
+		return fmt.Errorf("cannot rotate refresh token: %w", ErrSessionRevoked)
+	}
+
+	now := s.clock.Now()
+	ttl := entry.session.ExpiresAt.Sub(now)
+	if ttl <= 0 {
+		return fmt.Errorf("session is expired")
+	}
+
+	if expiry := now.Add(blacklistTTL(now, entry.session.ExpiresAt, s.blacklistRetention)); expiry.After(s.blacklist[entry.session.RefreshToken]) {
+		s.blacklist[entry.session.RefreshToken] = expiry
+	}
+
+	session := entry.session
+	session.RefreshToken = refreshTokenHash(newRefreshToken)
+	s.setLocked(session, ttl)
+
+	return nil
+}
+
+// RehashRefreshToken заменяет сырой refresh токен сессии его хешем
+func (s *MemoryStore) RehashRefreshToken(ctx context.Context, sessionID, token string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(sessionID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	if !entry.session.HasLegacyRefreshToken() {
+		return nil
+	}
+
+	if !entry.session.RefreshTokenMatches(token) {
+		return fmt.Errorf("refresh token does not match session")
+	}
+
+	ttl := entry.session.ExpiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return fmt.Errorf("session is expired")
+	}
+
+	session := entry.session
+	session.RefreshToken = refreshTokenHash(token)
+	s.setLocked(session, ttl)
+
+	return nil
+}
+
+// ExtendSession продлевает жизнь сессии на ttl от текущего момента
+func (s *MemoryStore) ExtendSession(ctx context.Context, id string, ttl time.Duration) error {
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if entry.session.IsRevoked {
+		return fmt.Errorf("cannot extend session: %w", ErrSessionRevoked)
+	}
+
+	now := s.clock.Now().UTC()
+	session := entry.session
+	session.LastAccessedAt = now
+	session.ExpiresAt = now.Add(ttl)
+	s.setLocked(session, ttl)
+
+	return nil
+}
+
+// UpdateSessionLabel меняет пользовательское название сессии
+func (s *MemoryStore) UpdateSessionLabel(ctx context.Context, id, label string) error {
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if err := validateLabel(label); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if entry.session.IsRevoked {
+		return fmt.Errorf("cannot update session label: %w", ErrSessionRevoked)
+	}
+
+	entry.session.Label = label
+
+	return nil
+}
+
+// DeleteSession удаляет сессию, добавляя ее токен в черный список.
+// Отсутствующая сессия считается уже удаленной
+func (s *MemoryStore) DeleteSession(ctx context.Context, id string) error {
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return nil
+	}
+
+	session := entry.session
+	s.deleteLocked(&session)
+
+	return nil
+}
+
+// deleteLocked удаляет сессию и ее запись в индексе. Вызывается под мьютексом на запись
+func (s *MemoryStore) deleteLocked(session *Session) {
+	now := s.clock.Now()
+	s.blacklist[session.RefreshToken] = now.Add(blacklistTTL(now, session.ExpiresAt, s.blacklistRetention))
+
+	if index, ok := s.userSessions[session.UserEmail]; ok {
+		delete(index, session.Id)
+	}
+	delete(s.sessions, session.Id)
+}
+
+// IsTokenBlacklisted проверяет, находится ли сырой refresh токен в черном списке
+func (s *MemoryStore) IsTokenBlacklisted(ctx context.Context, token string) (bool, error) {
+	if token == "" {
+		return false, fmt.Errorf("token is required")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.blacklist[refreshTokenHash(token)]
+	return ok && s.clock.Now().Before(expiresAt), nil
+}
+
+// BlacklistToken вносит сырой refresh токен в черный список на ttl, как RedisStore
+func (s *MemoryStore) BlacklistToken(ctx context.Context, token string, ttl time.Duration) error {
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("blacklist TTL must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := refreshTokenHash(token)
+	if expiresAt := s.clock.Now().Add(ttl); expiresAt.After(s.blacklist[key]) {
+		s.blacklist[key] = expiresAt
+	}
+
+	return nil
+}
+
+// AllowSessionCreate учитывает создание сессии в скользящем окне, как RedisStore
+func (s *MemoryStore) AllowSessionCreate(ctx context.Context, email string, limit int, window time.Duration) (bool, error) {
+	if email == "" {
+		return false, fmt.Errorf("user email is required")
+	}
+
+	if limit <= 0 || window <= 0 {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	marks := s.createMarks[email]
+
+	// Отметки упорядочены по времени: отбрасываем вышедшие из окна
+	start := 0
+	for start < len(marks) && !marks[start].After(now.Add(-window)) {
+		start++
+	}
+	marks = marks[start:]
+
+	if len(marks) >= limit {
+		s.createMarks[email] = marks
+		return false, nil
+	}
+
+	s.createMarks[email] = append(marks, now)
+	return true, nil
+}
+
+// AreTokensBlacklisted проверяет несколько сырых refresh токенов в черном списке
+func (s *MemoryStore) AreTokensBlacklisted(ctx context.Context, tokens []string) (map[string]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	result := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+
+		expiresAt, ok := s.blacklist[refreshTokenHash(token)]
+		result[token] = ok && now.Before(expiresAt)
+	}
+
+	return result, nil
+}
+
+// IsSessionValid проверяет сессию и ее refresh токен в черном списке
+func (s *MemoryStore) IsSessionValid(ctx context.Context, id string) (bool, string, error) {
+	if id == "" {
+		return false, "", fmt.Errorf("session ID is required")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.getLocked(id)
+	if !ok {
+		return false, SessionReasonNotFound, nil
+	}
+
+	expiresAt, blacklisted := s.blacklist[entry.session.RefreshToken]
+	blacklisted = blacklisted && s.clock.Now().Before(expiresAt)
+
+	reason := sessionValidity(&entry.session, blacklisted, s.clock.Now())
+	return reason == SessionReasonValid, reason, nil
+}
+
+// PublishRevocation рассылает событие отзыва всем подписчикам.
+// Как и Redis Pub/Sub, не ждет медленных подписчиков
+func (s *MemoryStore) PublishRevocation(ctx context.Context, event RevocationEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// SubscribeRevocations подписывается на события отзыва. Канал закрывается при отмене контекста
+func (s *MemoryStore) SubscribeRevocations(ctx context.Context) (<-chan RevocationEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+
+	ch := make(chan RevocationEvent, 16)
+	s.subscribers[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}()
+
+	return ch, nil
+}
+
+// Probe проверяет работоспособность хранилища
+func (s *MemoryStore) Probe(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+
+	return nil
+}
+
+// getLocked возвращает неистекшую запись сессии. Вызывается под мьютексом
+func (s *MemoryStore) getLocked(id string) (*memoryEntry, bool) {
+	entry, ok := s.sessions[id]
+	if !ok || !s.clock.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// setLocked сохраняет копию сессии с указанным TTL. Вызывается под мьютексом на запись
+func (s *MemoryStore) setLocked(session Session, ttl time.Duration) {
+	s.sessions[session.Id] = &memoryEntry{
+		session:   session,
+		expiresAt: s.clock.Now().Add(ttl),
+	}
+}
@@ -0,0 +1,565 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// storeHarness хранилище под тестом и способ сдвинуть время для него
+type storeHarness struct {
+	store   SessionStorage
+	clock   *fakeClock
+	advance func(d time.Duration) // Сдвигает часы хранилища и время жизни ключей
+
+	blacklistSize func() int // Число записей черного списка, включая истекшие, но не удаленные
+}
+
+// forEachStore прогоняет test на MemoryStore и на RedisStore поверх miniredis
+// (одиночный узел и клиент кластера), чтобы все реализации вели себя одинаково
+func forEachStore(t *testing.T, test func(t *testing.T, h storeHarness)) {
+	t.Run("memory", func(t *testing.T) {
+		clock := newFakeClock()
+		store := NewMemoryStore(WithClock(clock))
+		test(t, storeHarness{
+			store:   store,
+			clock:   clock,
+			advance: clock.Advance,
+			blacklistSize: func() int {
+				store.mu.RLock()
+				defer store.mu.RUnlock()
+				return len(store.blacklist)
+			},
+		})
+	})
+
+	redisStores := map[string]func(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis){
+		"redis":         newTestRedisStore,
+		"redis cluster": newTestClusterStore,
+	}
+	for _, name := range []string{"redis", "redis cluster"} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, mr := redisStores[name](t, WithClock(clock))
+			test(t, storeHarness{
+				store: store,
+				clock: clock,
+				advance: func(d time.Duration) {
+					clock.Advance(d)
+					mr.FastForward(d)
+				},
+				blacklistSize: func() int {
+					n := 0
+					for _, key := range mr.Keys() {
+						if strings.HasPrefix(key, store.keys.blacklist) {
+							n++
+						}
+					}
+					return n
+				},
+			})
+		})
+	}
+}
+
+func TestStoreCreateAndGet(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		session := newTestSession("s1", "user@example.com", h.clock.Now())
+		session.Label = "laptop"
+		session.Metadata = map[string]string{"tenant": "acme"}
+
+		created, err := h.store.CreateSession(ctx, session)
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if created.RefreshToken != "refresh-s1" {
+			t.Errorf("CreateSession returned refresh token %q, want the raw token", created.RefreshToken)
+		}
+
+		got, err := h.store.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+
+		if got.UserEmail != "user@example.com" || got.Label != "laptop" || got.Metadata["tenant"] != "acme" {
+			t.Errorf("GetSession = %+v, want stored fields", got)
+		}
+		if !got.ExpiresAt.Equal(session.ExpiresAt) {
+			t.Errorf("expires_at = %s, want %s", got.ExpiresAt, session.ExpiresAt)
+		}
+		if got.RefreshToken == "refresh-s1" || !got.RefreshTokenMatches("refresh-s1") {
+			t.Errorf("stored refresh token %q is not the hash of the raw token", got.RefreshToken)
+		}
+
+		byToken, err := h.store.GetSessionByRefreshToken(ctx, "refresh-s1")
+		if err != nil {
+			t.Fatalf("GetSessionByRefreshToken: %v", err)
+		}
+		if byToken.Id != "s1" {
+			t.Errorf("GetSessionByRefreshToken = %s, want s1", byToken.Id)
+		}
+
+		sessions, err := h.store.GetSessionsByEmail(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("GetSessionsByEmail: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].Id != "s1" {
+			t.Errorf("GetSessionsByEmail = %d sessions, want [s1]", len(sessions))
+		}
+	})
+}
+
+func TestStoreGetMissing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		if _, err := h.store.GetSession(context.Background(), "missing"); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetSession error = %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+}
+
+func TestStoreSessionExpires(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		if _, err := h.store.CreateSession(ctx, newTestSession("s1", "user@example.com", h.clock.Now())); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		h.advance(24*time.Hour - time.Second)
+		if _, err := h.store.GetSession(ctx, "s1"); err != nil {
+			t.Fatalf("GetSession before expiry: %v", err)
+		}
+
+		h.advance(2 * time.Second)
+		if _, err := h.store.GetSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetSession after expiry error = %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+}
+
+func TestStoreRevoke(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		if _, err := h.store.CreateSession(ctx, newTestSession("s1", "user@example.com", h.clock.Now())); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		if err := h.store.RevokeSession(ctx, "s1", RevokeReasonLogout); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		// Повторный отзыв не ошибка
+		if err := h.store.RevokeSession(ctx, "s1", RevokeReasonAdmin); err != nil {
+			t.Fatalf("second RevokeSession: %v", err)
+		}
+
+		got, err := h.store.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if !got.IsRevoked || got.RevokedReason != RevokeReasonLogout {
+			t.Errorf("revoked = %v reason = %q, want revoked with %q", got.IsRevoked, got.RevokedReason, RevokeReasonLogout)
+		}
+
+		blacklisted, err := h.store.IsTokenBlacklisted(ctx, "refresh-s1")
+		if err != nil {
+			t.Fatalf("IsTokenBlacklisted: %v", err)
+		}
+		if !blacklisted {
+			t.Error("refresh token of the revoked session is not blacklisted")
+		}
+
+		valid, reason, err := h.store.IsSessionValid(ctx, "s1")
+		if err != nil {
+			t.Fatalf("IsSessionValid: %v", err)
+		}
+		if valid || reason != SessionReasonRevoked {
+			t.Errorf("IsSessionValid = %v, %q, want false, %q", valid, reason, SessionReasonRevoked)
+		}
+
+		if err := h.store.RevokeSession(ctx, "missing", RevokeReasonLogout); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("RevokeSession(missing) error = %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+}
+
+func TestStoreRevokeAllUserSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		for _, id := range []string{"a", "b"} {
+			if _, err := h.store.CreateSession(ctx, newTestSession(id, "user@example.com", h.clock.Now())); err != nil {
+				t.Fatalf("CreateSession %s: %v", id, err)
+			}
+		}
+		if _, err := h.store.CreateSession(ctx, newTestSession("other", "other@example.com", h.clock.Now())); err != nil {
+			t.Fatalf("CreateSession other: %v", err)
+		}
+
+		count, err := h.store.RevokeAllUserSessions(ctx, "user@example.com", RevokeReasonPasswordChange)
+		if err != nil {
+			t.Fatalf("RevokeAllUserSessions: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("revoked %d sessions, want 2", count)
+		}
+
+		blacklisted, err := h.store.AreTokensBlacklisted(ctx, []string{"refresh-a", "refresh-b", "refresh-other"})
+		if err != nil {
+			t.Fatalf("AreTokensBlacklisted: %v", err)
+		}
+		if !blacklisted["refresh-a"] || !blacklisted["refresh-b"] || blacklisted["refresh-other"] {
+			t.Errorf("blacklisted = %v, want only the user's tokens", blacklisted)
+		}
+	})
+}
+
+func TestStoreDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		if _, err := h.store.CreateSession(ctx, newTestSession("s1", "user@example.com", h.clock.Now())); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		if err := h.store.DeleteSession(ctx, "s1"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		// Удаление отсутствующей сессии не ошибка
+		if err := h.store.DeleteSession(ctx, "s1"); err != nil {
+			t.Fatalf("second DeleteSession: %v", err)
+		}
+		if err := h.store.DeleteSession(ctx, "never-existed"); err != nil {
+			t.Fatalf("DeleteSession of a never existing ID: %v", err)
+		}
+
+		if _, err := h.store.GetSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("GetSession error = %v, want %v", err, ErrSessionNotFound)
+		}
+		if _, err := h.store.GetSessionByRefreshToken(ctx, "refresh-s1"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("GetSessionByRefreshToken error = %v, want %v", err, ErrSessionNotFound)
+		}
+
+		blacklisted, err := h.store.IsTokenBlacklisted(ctx, "refresh-s1")
+		if err != nil {
+			t.Fatalf("IsTokenBlacklisted: %v", err)
+		}
+		if !blacklisted {
+			t.Error("refresh token of the deleted session is not blacklisted")
+		}
+
+		count, err := h.store.CountActiveSessions(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("CountActiveSessions: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("CountActiveSessions = %d, want 0", count)
+		}
+	})
+}
+
+func TestStoreBlacklistToken(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+
+		if err := h.store.BlacklistToken(ctx, "leaked", time.Minute); err != nil {
+			t.Fatalf("BlacklistToken: %v", err)
+		}
+		// Более короткий срок не сокращает существующую запись
+		if err := h.store.BlacklistToken(ctx, "leaked", time.Second); err != nil {
+			t.Fatalf("second BlacklistToken: %v", err)
+		}
+
+		h.advance(30 * time.Second)
+		blacklisted, err := h.store.IsTokenBlacklisted(ctx, "leaked")
+		if err != nil {
+			t.Fatalf("IsTokenBlacklisted: %v", err)
+		}
+		if !blacklisted {
+			t.Fatal("token is not blacklisted within its TTL")
+		}
+
+		h.advance(31 * time.Second)
+		if blacklisted, err = h.store.IsTokenBlacklisted(ctx, "leaked"); err != nil {
+			t.Fatalf("IsTokenBlacklisted: %v", err)
+		}
+		if blacklisted {
+			t.Error("token is still blacklisted after its TTL")
+		}
+
+		if err := h.store.BlacklistToken(ctx, "", time.Minute); err == nil {
+			t.Error("BlacklistToken accepted an empty token")
+		}
+	})
+}
+
+func TestStoreRevokeIsIdempotent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		if _, err := h.store.CreateSession(ctx, newTestSession("s1", "user@example.com", h.clock.Now())); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := h.store.RevokeSession(ctx, "s1", RevokeReasonLogout); err != nil {
+				t.Fatalf("RevokeSession #%d: %v", i+1, err)
+			}
+		}
+
+		if n := h.blacklistSize(); n != 1 {
+			t.Errorf("blacklist has %d entries after a double revoke, want 1", n)
+		}
+	})
+}
+
+func TestStoreUpdateSessionLabel(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		session := newTestSession("s1", "user@example.com", h.clock.Now())
+		session.Label = "My iPhone"
+		if _, err := h.store.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		got, err := h.store.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if got.Label != "My iPhone" {
+			t.Errorf("label = %q, want My iPhone", got.Label)
+		}
+
+		if err := h.store.UpdateSessionLabel(ctx, "s1", "Work laptop"); err != nil {
+			t.Fatalf("UpdateSessionLabel: %v", err)
+		}
+		if got, err := h.store.GetSession(ctx, "s1"); err != nil || got.Label != "Work laptop" {
+			t.Errorf("label after rename = %q, %v, want Work laptop", got.Label, err)
+		}
+
+		if err := h.store.UpdateSessionLabel(ctx, "s1", strings.Repeat("я", MaxSessionLabelLength+1)); !errors.Is(err, ErrLabelTooLong) {
+			t.Errorf("UpdateSessionLabel with a long label error = %v, want %v", err, ErrLabelTooLong)
+		}
+		if err := h.store.UpdateSessionLabel(ctx, "missing", "label"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("UpdateSessionLabel of a missing session error = %v, want %v", err, ErrSessionNotFound)
+		}
+
+		if err := h.store.RevokeSession(ctx, "s1", RevokeReasonLogout); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		if err := h.store.UpdateSessionLabel(ctx, "s1", "Stolen"); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("UpdateSessionLabel of a revoked session error = %v, want %v", err, ErrSessionRevoked)
+		}
+	})
+}
+
+func TestStoreRevokeUserSessionsDryRun(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		for _, id := range []string{"s1", "s2", "s3"} {
+			if _, err := h.store.CreateSession(ctx, newTestSession(id, "user@example.com", h.clock.Now())); err != nil {
+				t.Fatalf("CreateSession(%s): %v", id, err)
+			}
+		}
+		if err := h.store.RevokeSession(ctx, "s3", RevokeReasonLogout); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+
+		dryRun, err := h.store.RevokeUserSessions(ctx, "user@example.com", RevokeReasonCompromised, true)
+		if err != nil {
+			t.Fatalf("RevokeUserSessions dry run: %v", err)
+		}
+		sort.Strings(dryRun)
+		if fmt.Sprint(dryRun) != "[s1 s2]" {
+			t.Errorf("dry run = %v, want [s1 s2]", dryRun)
+		}
+		for _, id := range []string{"s1", "s2"} {
+			if valid, _, err := h.store.IsSessionValid(ctx, id); err != nil || !valid {
+				t.Errorf("IsSessionValid(%s) after dry run = %v, %v, want valid", id, valid, err)
+			}
+		}
+
+		revoked, err := h.store.RevokeUserSessions(ctx, "user@example.com", RevokeReasonCompromised, false)
+		if err != nil {
+			t.Fatalf("RevokeUserSessions: %v", err)
+		}
+		sort.Strings(revoked)
+		if fmt.Sprint(revoked) != fmt.Sprint(dryRun) {
+			t.Errorf("revoked = %v, want the dry run list %v", revoked, dryRun)
+		}
+		for _, id := range []string{"s1", "s2"} {
+			if valid, _, err := h.store.IsSessionValid(ctx, id); err != nil || valid {
+				t.Errorf("IsSessionValid(%s) after revoke = %v, %v, want revoked", id, valid, err)
+			}
+		}
+
+		if again, err := h.store.RevokeUserSessions(ctx, "user@example.com", RevokeReasonCompromised, true); err != nil || len(again) != 0 {
+			t.Errorf("dry run after revoke = %v, %v, want nothing left", again, err)
+		}
+	})
+}
+
+func TestStoreIsSessionValidReasons(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		now := h.clock.Now()
+
+		for _, id := range []string{"valid", "revoked", "blacklisted", "expired"} {
+			session := newTestSession(id, "user@example.com", now)
+			if id == "expired" {
+				session.ExpiresAt = now.Add(time.Hour)
+			}
+			if _, err := h.store.CreateSession(ctx, session); err != nil {
+				t.Fatalf("CreateSession(%s): %v", id, err)
+			}
+		}
+		if err := h.store.RevokeSession(ctx, "revoked", RevokeReasonLogout); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		// Токен в черном списке без отзыва самой сессии
+		if err := h.store.BlacklistToken(ctx, "refresh-blacklisted", 3*time.Hour); err != nil {
+			t.Fatalf("BlacklistToken: %v", err)
+		}
+		// Истекшая сессия уходит из хранилища вместе с ключом
+		h.advance(2 * time.Hour)
+
+		tests := []struct {
+			id         string
+			wantValid  bool
+			wantReason string
+		}{
+			{"valid", true, SessionReasonValid},
+			{"unknown", false, SessionReasonNotFound},
+			{"revoked", false, SessionReasonRevoked},
+			{"blacklisted", false, SessionReasonRevoked},
+			{"expired", false, SessionReasonNotFound},
+		}
+		for _, tt := range tests {
+			valid, reason, err := h.store.IsSessionValid(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("IsSessionValid(%s): %v", tt.id, err)
+			}
+			if valid != tt.wantValid || reason != tt.wantReason {
+				t.Errorf("IsSessionValid(%s) = %v, %q, want %v, %q", tt.id, valid, reason, tt.wantValid, tt.wantReason)
+			}
+		}
+
+		if _, _, err := h.store.IsSessionValid(ctx, ""); err == nil {
+			t.Error("IsSessionValid accepted an empty ID")
+		}
+	})
+}
+
+func TestStoreTimestampsAreUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+3", 3*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+
+		// Часы и клиент отдают время в локальном поясе сервера
+		h.clock.mu.Lock()
+		h.clock.now = h.clock.now.Local()
+		h.clock.mu.Unlock()
+
+		now := h.clock.Now()
+		session := &Session{
+			Id:           "s1",
+			UserEmail:    "user@example.com",
+			RefreshToken: "refresh-s1",
+			ExpiresAt:    now.Add(24 * time.Hour),
+		}
+		created, err := h.store.CreateSession(ctx, session)
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		got, err := h.store.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+
+		for name, s := range map[string]*Session{"created": created, "stored": got} {
+			if s.CreatedAt.Location() != time.UTC || s.ExpiresAt.Location() != time.UTC {
+				t.Errorf("%s CreatedAt = %s, ExpiresAt = %s, want UTC", name, s.CreatedAt, s.ExpiresAt)
+			}
+			if !s.CreatedAt.Equal(now) || !s.ExpiresAt.Equal(now.Add(24*time.Hour)) {
+				t.Errorf("%s CreatedAt = %s, ExpiresAt = %s, want the same instants as %s", name, s.CreatedAt, s.ExpiresAt, now)
+			}
+		}
+	})
+}
+
+func TestStoreAreTokensBlacklistedMixed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+		for _, id := range []string{"revoked", "clean"} {
+			if _, err := h.store.CreateSession(ctx, newTestSession(id, "user@example.com", h.clock.Now())); err != nil {
+				t.Fatalf("CreateSession(%s): %v", id, err)
+			}
+		}
+		if err := h.store.RevokeSession(ctx, "revoked", RevokeReasonLogout); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+		if err := h.store.BlacklistToken(ctx, "leaked", time.Hour); err != nil {
+			t.Fatalf("BlacklistToken: %v", err)
+		}
+
+		got, err := h.store.AreTokensBlacklisted(ctx, []string{"refresh-revoked", "refresh-clean", "leaked", "unknown", "leaked", ""})
+		if err != nil {
+			t.Fatalf("AreTokensBlacklisted: %v", err)
+		}
+		want := map[string]bool{
+			"refresh-revoked": true,
+			"refresh-clean":   false,
+			"leaked":          true,
+			"unknown":         false,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("AreTokensBlacklisted = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestStoreSessionStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, h storeHarness) {
+		ctx := context.Background()
+
+		// Пользователей больше страницы SCAN, чтобы подсчет прошел по курсору
+		const users = reapScanCount + 20
+		for i := 0; i < users; i++ {
+			email := fmt.Sprintf("user%d@example.com", i)
+			sessions := 1 + i%3
+			for j := 0; j < sessions; j++ {
+				id := fmt.Sprintf("u%d-s%d", i, j)
+				if _, err := h.store.CreateSession(ctx, newTestSession(id, email, h.clock.Now())); err != nil {
+					t.Fatalf("CreateSession(%s): %v", id, err)
+				}
+			}
+		}
+		// Пользователь без сессий в счет не идет
+		if err := h.store.DeleteSession(ctx, "u0-s0"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+
+		var wantSessions int64
+		for i := 1; i < users; i++ {
+			wantSessions += int64(1 + i%3)
+		}
+
+		stats, err := h.store.SessionStats(ctx)
+		if err != nil {
+			t.Fatalf("SessionStats: %v", err)
+		}
+		if stats.UniqueUsers != users-1 || stats.ActiveSessions != wantSessions {
+			t.Errorf("SessionStats = %d users, %d sessions, want %d users, %d sessions",
+				stats.UniqueUsers, stats.ActiveSessions, users-1, wantSessions)
+		}
+		if !stats.SnapshotTime.Equal(h.clock.Now()) {
+			t.Errorf("SnapshotTime = %s, want %s", stats.SnapshotTime, h.clock.Now())
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pageSessions сортирует сессии по CreatedAt, затем по ID, и возвращает страницу
+// после cursor. Курсор указывает на последнюю выданную сессию, поэтому остается
+// стабильным, даже если между запросами страниц появились новые сессии
+func pageSessions(sessions []*Session, cursor string, limit int) ([]*Session, string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("limit must be positive")
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessionLess(sessions[i].CreatedAt, sessions[i].Id, sessions[j].CreatedAt, sessions[j].Id)
+	})
+
+	start := 0
+	if cursor != "" {
+		afterTime, afterID, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		start = sort.Search(len(sessions), func(i int) bool {
+			return sessionLess(afterTime, afterID, sessions[i].CreatedAt, sessions[i].Id)
+		})
+	}
+
+	end := start + limit
+	if end >= len(sessions) {
+		return sessions[start:], "", nil
+	}
+
+	last := sessions[end-1]
+	return sessions[start:end], encodeCursor(last.CreatedAt, last.Id), nil
+}
+
+// sessionLess задает детерминированный порядок сессий
+func sessionLess(aTime time.Time, aID string, bTime time.Time, bID string) bool {
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return aID < bID
+}
+
+// encodeCursor кодирует позицию сессии в непрозрачный курсор
+func encodeCursor(createdAt time.Time, id string) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor разбирает курсор, полученный от encodeCursor
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	return time.Unix(0, n), id, nil
+}
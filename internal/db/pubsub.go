@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PublishRevocation публикует событие отзыва сессии в канал Pub/Sub
+func (s *RedisStore) PublishRevocation(ctx context.Context, event RevocationEvent) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation event: %w", err)
+	}
+
+	if err := s.client.Publish(ctx, s.revocationChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish revocation event: %w", err)
+	}
+
+	return nil
+}
+
+// SubscribeRevocations подписывается на события отзыва сессий.
+// Канал закрывается при отмене контекста
+func (s *RedisStore) SubscribeRevocations(ctx context.Context) (<-chan RevocationEvent, error) {
+	pubsub := s.client.Subscribe(ctx, s.revocationChannel)
+
+	// Дожидаемся подтверждения подписки, чтобы не потерять первые события
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to revocation events: %w", err)
+	}
+
+	events := make(chan RevocationEvent)
+
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event RevocationEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue // Пропускаем поврежденные сообщения
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
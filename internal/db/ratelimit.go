@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// createRateLimitPrefix префикс окон лимита создания сессий по email
+const createRateLimitPrefix = "ratelimit:create:"
+
+// createRateLimitScript скользящее окно на sorted set: удаляет отметки старше окна
+// и добавляет новую, только если лимит не исчерпан. Отказ не продлевает окно.
+// Ключ живет не дольше окна, поэтому пользователи без активности не оставляют ключей.
+// KEYS[1] — ключ окна, ARGV: текущее время в мс, окно в мс, лимит, уникальная отметка
+var createRateLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return 1
+`)
+
+// AllowSessionCreate учитывает создание сессии пользователем и сообщает, укладывается ли
+// оно в limit созданий за скользящее окно window. Отказанные попытки не учитываются
+func (s *RedisStore) AllowSessionCreate(ctx context.Context, email string, limit int, window time.Duration) (bool, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if email == "" {
+		return false, fmt.Errorf("user email is required")
+	}
+
+	if limit <= 0 || window <= 0 {
+		return true, nil
+	}
+
+	// Отметки с одинаковым временем не должны схлопываться в sorted set
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return false, fmt.Errorf("failed to generate rate limit mark: %w", err)
+	}
+
+	now := s.clock.Now().UnixMilli()
+	mark := fmt.Sprintf("%d-%s", now, hex.EncodeToString(b))
+
+	allowed, err := createRateLimitScript.Run(ctx, s.client, []string{s.keys.createRateLimit + email},
+		now, window.Milliseconds(), limit, mark,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to check session create rate limit: %w", err)
+	}
+
+	return allowed == 1, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// reapScanCount количество ключей, запрашиваемых за одну итерацию SCAN
+const reapScanCount = 100
+
+// ReapResult итог очистки индексов сессий пользователей
+type ReapResult struct {
+	UsersScanned int // Сколько индексов пользователей проверено
+	PrunedIDs    int // Сколько висячих ID удалено
+}
+
+// ReconcileUser приводит индекс сессий пользователя в соответствие с хранилищем:
+// удаляет ID истекших сессий и сессий, принадлежащих другому пользователю.
+// Возвращает количество удаленных записей
+func (s *RedisStore) ReconcileUser(ctx context.Context, email string) (int, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
+	}
+
+	sessionIDs, err := s.client.SMembers(ctx, s.keys.userSessions+email).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = s.keys.session + id
+	}
+
+	sessionDataList, err := s.mget(ctx, keys...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sessions data: %w", err)
+	}
+
+	dangling := make([]string, 0)
+	for i, sessionData := range sessionDataList {
+		if sessionData == nil {
+			dangling = append(dangling, sessionIDs[i])
+			continue
+		}
+
+		str, ok := sessionData.(string)
+		if !ok {
+			continue
+		}
+
+		var session Session
+		if err := s.codec.Unmarshal([]byte(str), &session); err != nil {
+			continue
+		}
+
+		if session.UserEmail != email {
+			dangling = append(dangling, sessionIDs[i])
+		}
+	}
+
+	if err := s.removeFromUserIndex(ctx, email, dangling); err != nil {
+		return 0, err
+	}
+
+	return len(dangling), nil
+}
+
+// ReapUserIndexes обходит все индексы сессий пользователей курсором SCAN,
+// не блокируя Redis, и удаляет из них висячие ID. В кластере SCAN
+// видит только один узел, поэтому обходятся все мастера
+func (s *RedisStore) ReapUserIndexes(ctx context.Context) (*ReapResult, error) {
+	result := &ReapResult{}
+	var mu sync.Mutex
+
+	cluster, ok := s.client.(*redis.ClusterClient)
+	if !ok {
+		return result, s.reapNode(ctx, s.client, result, &mu)
+	}
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return s.reapNode(ctx, node, result, &mu)
+	})
+	return result, err
+}
+
+// reapNode обходит индексы на одном узле. mu защищает result: узлы
+// кластера обходятся параллельно
+func (s *RedisStore) reapNode(ctx context.Context, node redis.UniversalClient, result *ReapResult, mu *sync.Mutex) error {
+	var cursor uint64
+	for {
+		// Таймаут применяется к каждому шагу отдельно: полный обход может быть долгим
+		scanCtx, cancel := s.opContext(ctx)
+		keys, next, err := node.Scan(scanCtx, cursor, s.keys.userSessions+"*", reapScanCount).Result()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to scan user indexes: %w", err)
+		}
+
+		for _, key := range keys {
+			pruned, err := s.ReconcileUser(ctx, strings.TrimPrefix(key, s.keys.userSessions))
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			result.UsersScanned++
+			result.PrunedIDs += pruned
+			mu.Unlock()
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// StartReaper запускает фоновую очистку индексов сессий с заданным интервалом.
+// Останавливается при отмене контекста
+func StartReaper(ctx context.Context, storage SessionStorage, interval time.Duration, log logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+
+				result, err := storage.ReapUserIndexes(ctx)
+				if err != nil {
+					log.Error("Session index reap failed", "error", err)
+					continue
+				}
+
+				log.Info("Session index reap completed",
+					"users_scanned", result.UsersScanned,
+					"pruned_ids", result.PrunedIDs,
+					"duration", time.Since(start),
+				)
+			}
+		}
+	}()
+}
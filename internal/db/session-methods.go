@@ -2,9 +2,13 @@ package db
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -13,8 +17,45 @@ const (
 	sessionPrefix   = "session:"
 	blacklistPrefix = "blacklist:"
 	userSessionsIdx = "user_sessions:" // Новый префикс для индекса пользовательских сессий
+	refreshTokenIdx = "refresh_token:" // Обратный индекс: хеш refresh токена -> ID сессии
+	probePrefix     = "health:probe:"  // Префикс временных ключей для проверки хранилища
+	probeTTL        = 30 * time.Second
 )
 
+// keySpace префиксы ключей хранилища с учетом пространства имен
+type keySpace struct {
+	session         string
+	blacklist       string
+	userSessions    string
+	refreshToken    string
+	probe           string
+	createRateLimit string
+}
+
+// newKeySpace строит префиксы ключей. Непустое пространство имен добавляется
+// перед каждым префиксом ("staging:session:..."), пустое оставляет ключи как раньше
+func newKeySpace(namespace string) keySpace {
+	ns := ""
+	if namespace != "" {
+		ns = namespace + ":"
+	}
+
+	return keySpace{
+		session:         ns + sessionPrefix,
+		blacklist:       ns + blacklistPrefix,
+		userSessions:    ns + userSessionsIdx,
+		refreshToken:    ns + refreshTokenIdx,
+		probe:           ns + probePrefix,
+		createRateLimit: ns + createRateLimitPrefix,
+	}
+}
+
+// blacklistTTL время хранения токена в черном списке: до истечения сессии,
+// но не меньше retention. Токен истекшей сессии все равно хранится минимум минуту
+func blacklistTTL(now, expiresAt time.Time, retention time.Duration) time.Duration {
+	return max(expiresAt.Sub(now), retention, time.Minute)
+}
+
 // Close закрывает соединение с Redis
 func (s *RedisStore) Close() error {
 	return s.client.Close()
@@ -22,96 +63,484 @@ func (s *RedisStore) Close() error {
 
 // CreateSession создает новую сессию в Redis
 func (s *RedisStore) CreateSession(ctx context.Context, session *Session) (*Session, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	sessionData, ttl, err := prepareNewSession(session, s.codec, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	key := s.keys.session + session.Id
+	if err := s.client.Set(ctx, key, sessionData, ttl).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save session to Redis: %w", err)
+	}
+
+	// Обратный индекс по refresh токену живет столько же, сколько сессия
+	tokenKey := s.keys.refreshToken + refreshTokenHash(session.RefreshToken)
+	if err := s.client.Set(ctx, tokenKey, session.Id, ttl).Err(); err != nil {
+		s.client.Del(ctx, key)
+		return nil, fmt.Errorf("failed to index session by refresh token: %w", err)
+	}
+
+	// Добавляем sessionID в список сессий пользователя
+	userSessionsKey := s.keys.userSessions + session.UserEmail
+	if err := s.client.SAdd(ctx, userSessionsKey, session.Id).Err(); err != nil {
+		// Если не удалось добавить в индекс, удаляем созданную сессию
+		s.client.Del(ctx, key)
+		s.client.Del(ctx, tokenKey)
+		return nil, fmt.Errorf("failed to index session for user: %w", err)
+	}
+
+	// Устанавливаем TTL для индекса такой же, как для сессии
+	if err := s.client.Expire(ctx, userSessionsKey, ttl).Err(); err != nil {
+		// Если не удалось установить TTL для индекса, удаляем созданную сессию
+		s.client.Del(ctx, key)
+		s.client.Del(ctx, tokenKey)
+		s.client.SRem(ctx, userSessionsKey, session.Id)
+		return nil, fmt.Errorf("failed to set expiration for user sessions index: %w", err)
+	}
+
+	// Проверяем лимит одновременных сессий пользователя
+	if err := s.evictExcessSessions(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// prepareNewSession проверяет новую сессию и возвращает данные для записи
+// (с хешем вместо refresh токена) и TTL ключа, отсчитанный от now
+func prepareNewSession(session *Session, codec SessionCodec, now time.Time) ([]byte, time.Duration, error) {
 	// Проверяем обязательные поля
 	if session.Id == "" {
-		return nil, fmt.Errorf("session ID is required")
+		return nil, 0, fmt.Errorf("session ID is required")
 	}
 
 	if session.UserEmail == "" {
-		return nil, fmt.Errorf("user email is required")
+		return nil, 0, fmt.Errorf("user email is required")
 	}
 
 	if session.RefreshToken == "" {
-		return nil, fmt.Errorf("refresh token is required")
+		return nil, 0, fmt.Errorf("refresh token is required")
+	}
+
+	if err := validateLabel(session.Label); err != nil {
+		return nil, 0, err
+	}
+
+	if err := ValidateMetadata(session.Metadata); err != nil {
+		return nil, 0, err
 	}
 
 	// Если время создания не установлено, устанавливаем текущее время
 	if session.CreatedAt.IsZero() {
-		session.CreatedAt = time.Now()
+		session.CreatedAt = now
 	}
 
-	// Если время истечения не установлено, возвращаем ошибку
-	if session.ExpiresAt.IsZero() {
-		return nil, fmt.Errorf("expiration time is required")
+	if err := session.ValidateExpiry(now); err != nil {
+		return nil, 0, err
 	}
 
-	sessionData, err := json.Marshal(session)
+	session.normalizeTimes()
+
+	// Сохраняем хеш refresh токена, сырой токен возвращается вызывающему только здесь
+	stored := *session
+	stored.RefreshToken = refreshTokenHash(session.RefreshToken)
+
+	sessionData, err := codec.Marshal(&stored)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal session: %w", err)
+		return nil, 0, fmt.Errorf("failed to marshal session: %w", err)
 	}
 
-	// Вычисляем TTL как разницу между временем истечения и текущим временем
-	ttl := session.ExpiresAt.Sub(time.Now())
-	if ttl <= 0 {
-		return nil, fmt.Errorf("session expiration time must be in the future")
+	return sessionData, session.ExpiresAt.Sub(now), nil
+}
+
+// BatchCreateSessions создает несколько сессий одним пайплайном. Возвращает ошибки
+// по каждой сессии в порядке входного списка (nil = создана); обновляется
+// индекс каждого пользователя. Общая ошибка возможна только при проверке лимита сессий
+func (s *RedisStore) BatchCreateSessions(ctx context.Context, sessions []*Session) ([]error, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	itemErrs := make([]error, len(sessions))
+
+	type pending struct {
+		index int
+		set   *redis.StatusCmd
+		token *redis.StatusCmd
+		add   *redis.IntCmd
 	}
 
-	key := sessionPrefix + session.Id
-	if err := s.client.Set(ctx, key, sessionData, ttl).Err(); err != nil {
-		return nil, fmt.Errorf("failed to save session to Redis: %w", err)
+	var (
+		queued  []pending
+		userTTL = make(map[string]time.Duration)
+		last    = make(map[string]*Session) // Последняя сессия пользователя в пачке
+	)
+
+	// Ошибка пайплайна повторяет ошибку первой неудачной команды,
+	// поэтому результат разбирается по каждой команде
+	_, _ = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, session := range sessions {
+			sessionData, ttl, err := prepareNewSession(session, s.codec, s.clock.Now())
+			if err != nil {
+				itemErrs[i] = err
+				continue
+			}
+
+			userSessionsKey := s.keys.userSessions + session.UserEmail
+			queued = append(queued, pending{
+				index: i,
+				set:   pipe.Set(ctx, s.keys.session+session.Id, sessionData, ttl),
+				token: pipe.Set(ctx, s.keys.refreshToken+refreshTokenHash(session.RefreshToken), session.Id, ttl),
+				add:   pipe.SAdd(ctx, userSessionsKey, session.Id),
+			})
+
+			// Индекс живет не меньше самой долгой сессии пользователя
+			if ttl > userTTL[session.UserEmail] {
+				userTTL[session.UserEmail] = ttl
+			}
+			last[session.UserEmail] = session
+		}
+
+		for email, ttl := range userTTL {
+			pipe.Expire(ctx, s.keys.userSessions+email, ttl)
+		}
+		return nil
+	})
+
+	for _, q := range queued {
+		session := sessions[q.index]
+		tokenKey := s.keys.refreshToken + refreshTokenHash(session.RefreshToken)
+
+		// Команды пайплайна выполнены независимо: откатываем записи, прошедшие
+		// вместе с неудачной, включая ID в индексе пользователя
+		if err := q.set.Err(); err != nil {
+			s.client.Del(ctx, tokenKey)
+			s.client.SRem(ctx, s.keys.userSessions+session.UserEmail, session.Id)
+			itemErrs[q.index] = fmt.Errorf("failed to save session to Redis: %w", err)
+			continue
+		}
+		if err := q.token.Err(); err != nil {
+			s.client.Del(ctx, s.keys.session+session.Id)
+			s.client.SRem(ctx, s.keys.userSessions+session.UserEmail, session.Id)
+			itemErrs[q.index] = fmt.Errorf("failed to index session by refresh token: %w", err)
+			continue
+		}
+		if err := q.add.Err(); err != nil {
+			s.client.Del(ctx, s.keys.session+session.Id)
+			s.client.Del(ctx, tokenKey)
+			itemErrs[q.index] = fmt.Errorf("failed to index session for user: %w", err)
+		}
 	}
 
-	// Добавляем sessionID в список сессий пользователя
-	userSessionsKey := userSessionsIdx + session.UserEmail
-	if err := s.client.SAdd(ctx, userSessionsKey, session.Id).Err(); err != nil {
-		// Если не удалось добавить в индекс, удаляем созданную сессию
-		s.client.Del(ctx, key)
-		return nil, fmt.Errorf("failed to index session for user: %w", err)
+	// Лимит сессий проверяется один раз на пользователя
+	for _, session := range last {
+		if err := s.evictExcessSessions(ctx, session); err != nil {
+			return itemErrs, err
+		}
 	}
 
-	// Устанавливаем TTL для индекса такой же, как для сессии
-	if err := s.client.Expire(ctx, userSessionsKey, ttl).Err(); err != nil {
-		// Если не удалось установить TTL для индекса, удаляем созданную сессию
-		s.client.Del(ctx, key)
-		s.client.SRem(ctx, userSessionsKey, session.Id)
-		return nil, fmt.Errorf("failed to set expiration for user sessions index: %w", err)
+	return itemErrs, nil
+}
+
+// maxEvictAttempts сколько раз повторяется вытеснение, если индекс пользователя
+// изменился между чтением и записью
+const maxEvictAttempts = 10
+
+// evictExcessSessions удаляет самые старые сессии пользователя, если их больше лимита.
+// Только что созданная сессия никогда не вытесняется. Выбор и удаление выполняются
+// транзакцией под WATCH индекса: параллельное создание или удаление сессий того же
+// пользователя перезапускает вытеснение, поэтому лишние сессии не переживают гонку
+func (s *RedisStore) evictExcessSessions(ctx context.Context, created *Session) error {
+	if s.maxSessionsPerUser <= 0 {
+		return nil
 	}
 
-	return session, nil
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		return s.evictExcessSessionsCluster(ctx, created)
+	}
+
+	userSessionsKey := s.keys.userSessions + created.UserEmail
+
+	for attempt := 0; attempt < maxEvictAttempts; attempt++ {
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			evict, stale, err := s.evictionCandidates(ctx, tx, userSessionsKey, created)
+			if err != nil {
+				return err
+			}
+
+			if len(evict) == 0 && len(stale) == 0 {
+				return nil
+			}
+
+			now := s.clock.Now()
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				// ID истекших сессий убираются из индекса вместе с вытеснением
+				for _, id := range stale {
+					pipe.SRem(ctx, userSessionsKey, id)
+				}
+
+				for _, session := range evict {
+					pipe.Set(ctx, s.keys.blacklist+session.RefreshToken, "evicted", blacklistTTL(now, session.ExpiresAt, s.blacklistRetention))
+					pipe.SRem(ctx, userSessionsKey, session.Id)
+					pipe.Del(ctx, s.keys.session+session.Id)
+					pipe.Del(ctx, s.keys.refreshToken+session.RefreshToken)
+				}
+				return nil
+			})
+			return err
+		}, userSessionsKey)
+
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, redis.TxFailedErr) {
+			return fmt.Errorf("failed to evict excess sessions: %w", err)
+		}
+	}
+
+	return fmt.Errorf("failed to evict excess sessions: user index kept changing after %d attempts", maxEvictAttempts)
+}
+
+// evictionCandidates выбирает сессии пользователя для вытеснения (самые старые сверх
+// лимита) и ID из индекса, чьих сессий уже нет. Ошибка чтения не считается
+// отсутствием сессии, чтобы сбой Redis не выбрасывал живые сессии из индекса
+func (s *RedisStore) evictionCandidates(ctx context.Context, tx *redis.Tx, userSessionsKey string, created *Session) ([]*Session, []string, error) {
+	count, err := tx.SCard(ctx, userSessionsKey).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count user sessions: %w", err)
+	}
+
+	if count <= int64(s.maxSessionsPerUser) {
+		return nil, nil, nil
+	}
+
+	members, err := tx.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	ids := make([]string, 0, len(members))
+	keys := make([]string, 0, len(members))
+	for _, id := range members {
+		if id != created.Id {
+			ids = append(ids, id)
+			keys = append(keys, s.keys.session+id)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	values, err := tx.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get sessions data: %w", err)
+	}
+
+	candidates := make([]*Session, 0, len(values))
+	var stale []string
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			stale = append(stale, ids[i]) // Сессия истекла, но осталась в индексе
+			continue
+		}
+
+		var session Session
+		if err := s.codec.Unmarshal([]byte(data), &session); err != nil {
+			continue // Поврежденную сессию не вытесняем и не трогаем
+		}
+		candidates = append(candidates, &session)
+	}
+
+	return oldestExcess(candidates, s.maxSessionsPerUser), stale, nil
+}
+
+// evictExcessSessionsCluster вариант evictExcessSessions для Redis Cluster. Сессии
+// и индекс лежат в разных слотах, поэтому транзакция невозможна: сессии удаляются
+// по одной, а повторное создание сессии досчитывает вытеснение
+func (s *RedisStore) evictExcessSessionsCluster(ctx context.Context, created *Session) error {
+	userSessionsKey := s.keys.userSessions + created.UserEmail
+	count, err := s.client.SCard(ctx, userSessionsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count user sessions: %w", err)
+	}
+
+	if count <= int64(s.maxSessionsPerUser) {
+		return nil
+	}
+
+	sessionIDs, err := s.client.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	candidates := make([]*Session, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		if id == created.Id {
+			continue
+		}
+
+		session, err := s.GetSession(ctx, id)
+		if err != nil {
+			if !errors.Is(err, ErrSessionNotFound) {
+				return fmt.Errorf("failed to get session %s for eviction: %w", id, err)
+			}
+			// Сессия уже истекла, но осталась в индексе — убираем ее
+			s.client.SRem(ctx, userSessionsKey, id)
+			continue
+		}
+		candidates = append(candidates, session)
+	}
+
+	for _, session := range oldestExcess(candidates, s.maxSessionsPerUser) {
+		if err := s.DeleteSession(ctx, session.Id); err != nil {
+			return fmt.Errorf("failed to evict session %s: %w", session.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// oldestExcess возвращает самые старые сессии сверх лимита. Лимит учитывает
+// только что созданную сессию, поэтому остаются maxSessions-1 кандидатов
+func oldestExcess(candidates []*Session, maxSessions int) []*Session {
+	excess := len(candidates) - (maxSessions - 1)
+	if excess <= 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+
+	return candidates[:excess]
 }
 
 // GetSession получает сессию из Redis по ID
 func (s *RedisStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
 	if id == "" {
 		return nil, fmt.Errorf("session ID is required")
 	}
 
-	key := sessionPrefix + id
+	key := s.keys.session + id
 
 	sessionData, err := s.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("session %s not found", id)
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
 		}
 		return nil, fmt.Errorf("failed to get session from Redis: %w", err)
 	}
 
 	var session Session
-	if err := json.Unmarshal([]byte(sessionData), &session); err != nil {
+	if err := s.codec.Unmarshal([]byte(sessionData), &session); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
 	}
 
 	return &session, nil
 }
 
+// GetSessionByRefreshToken находит сессию по сырому refresh токену через обратный индекс.
+// Неизвестный, ротированный или устаревший токен — ErrSessionNotFound. Сессии, записанные
+// до хеширования токенов, попадают в индекс только после RehashRefreshToken
+func (s *RedisStore) GetSessionByRefreshToken(ctx context.Context, token string) (*Session, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if token == "" {
+		return nil, fmt.Errorf("refresh token is required")
+	}
+
+	id, err := s.client.Get(ctx, s.keys.refreshToken+refreshTokenHash(token)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session by refresh token: %w", err)
+	}
+
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Индекс мог пережить ротацию токена, поэтому сверяем хеш с сессией
+	if !session.RefreshTokenMatches(token) {
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// BatchGetSessions получает несколько сессий одним запросом MGET.
+// Возвращает мапу ID -> сессия; отсутствующие и поврежденные сессии пропускаются
+func (s *RedisStore) BatchGetSessions(ctx context.Context, ids []string) (map[string]*Session, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	// Убираем дубликаты и пустые ID
+	seen := make(map[string]struct{}, len(ids))
+	uniqueIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		uniqueIDs = append(uniqueIDs, id)
+	}
+
+	sessions := make(map[string]*Session, len(uniqueIDs))
+	if len(uniqueIDs) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, len(uniqueIDs))
+	for i, id := range uniqueIDs {
+		keys[i] = s.keys.session + id
+	}
+
+	sessionDataList, err := s.mget(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions data: %w", err)
+	}
+
+	for i, sessionData := range sessionDataList {
+		sessionStr, ok := sessionData.(string)
+		if !ok {
+			continue // Пропускаем отсутствующие и неверные данные
+		}
+
+		var session Session
+		if err := s.codec.Unmarshal([]byte(sessionStr), &session); err != nil {
+			continue // Пропускаем поврежденные данные
+		}
+
+		sessions[uniqueIDs[i]] = &session
+	}
+
+	return sessions, nil
+}
+
 // GetSessionsByEmail получает все активные сессии пользователя по email
 func (s *RedisStore) GetSessionsByEmail(ctx context.Context, email string) ([]*Session, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
 	if email == "" {
 		return nil, fmt.Errorf("user email is required")
 	}
 
 	// Получаем список ID сессий пользователя
-	userSessionsKey := userSessionsIdx + email
+	userSessionsKey := s.keys.userSessions + email
 	sessionIDs, err := s.client.SMembers(ctx, userSessionsKey).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user sessions: %w", err)
@@ -124,20 +553,23 @@ func (s *RedisStore) GetSessionsByEmail(ctx context.Context, email string) ([]*S
 	// Формируем ключи для команды MGET
 	keys := make([]string, len(sessionIDs))
 	for i, id := range sessionIDs {
-		keys[i] = sessionPrefix + id
+		keys[i] = s.keys.session + id
 	}
 
 	// Получаем данные всех сессий одним запросом
-	sessionDataList, err := s.client.MGet(ctx, keys...).Result()
+	sessionDataList, err := s.mget(ctx, keys...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sessions data: %w", err)
 	}
 
 	// Десериализуем сессии
 	sessions := make([]*Session, 0, len(sessionDataList))
-	for _, sessionData := range sessionDataList {
+	dangling := make([]string, 0)
+	for i, sessionData := range sessionDataList {
 		if sessionData == nil {
-			continue // Пропускаем отсутствующие сессии
+			// Ключ сессии истек, а ID остался в индексе
+			dangling = append(dangling, sessionIDs[i])
+			continue
 		}
 
 		var session Session
@@ -146,7 +578,7 @@ func (s *RedisStore) GetSessionsByEmail(ctx context.Context, email string) ([]*S
 			continue // Пропускаем неверные данные
 		}
 
-		if err := json.Unmarshal([]byte(sessionStr), &session); err != nil {
+		if err := s.codec.Unmarshal([]byte(sessionStr), &session); err != nil {
 			continue // Пропускаем поврежденные данные
 		}
 
@@ -157,99 +589,668 @@ func (s *RedisStore) GetSessionsByEmail(ctx context.Context, email string) ([]*S
 		}
 	}
 
+	// Чиним индекс при чтении: ошибка очистки не должна ломать выдачу сессий
+	_ = s.removeFromUserIndex(ctx, email, dangling)
+
 	return sessions, nil
 }
 
-// RevokeSession отзывает сессию, добавляя токен в черный список
-func (s *RedisStore) RevokeSession(ctx context.Context, id string) error {
-	if id == "" {
-		return fmt.Errorf("session ID is required")
+// GetSessionsByEmailPaged возвращает страницу активных сессий пользователя и курсор
+// следующей страницы (пустой, если страница последняя)
+func (s *RedisStore) GetSessionsByEmailPaged(ctx context.Context, email, cursor string, limit int) ([]*Session, string, error) {
+	// Индекс пользователя — неупорядоченное множество, поэтому страницы
+	// формируются после загрузки и сортировки всех его сессий
+	sessions, err := s.GetSessionsByEmail(ctx, email)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Получаем сессию
-	session, err := s.GetSession(ctx, id)
+	return pageSessions(sessions, cursor, limit)
+}
+
+// PruneUserIndex удаляет из индекса пользователя ID сессий, ключи которых уже истекли.
+// Возвращает количество удаленных записей
+func (s *RedisStore) PruneUserIndex(ctx context.Context, email string) (int, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
+	}
+
+	userSessionsKey := s.keys.userSessions + email
+	sessionIDs, err := s.client.SMembers(ctx, userSessionsKey).Result()
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("failed to get user sessions: %w", err)
 	}
 
-	// Проверяем, не отозвана ли сессия уже
-	if session.IsRevoked {
-		return fmt.Errorf("session is already revoked")
+	if len(sessionIDs) == 0 {
+		return 0, nil
 	}
 
-	// Добавляем refresh токен в черный список
-	blacklistKey := blacklistPrefix + session.RefreshToken
-	ttl := session.ExpiresAt.Sub(time.Now())
-	if ttl <= 0 {
-		ttl = time.Minute // Если токен уже истек, все равно добавляем его на короткое время
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = s.keys.session + id
 	}
 
-	if err := s.client.Set(ctx, blacklistKey, "revoked", ttl).Err(); err != nil {
-		return fmt.Errorf("failed to add token to blacklist: %w", err)
+	sessionDataList, err := s.mget(ctx, keys...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sessions data: %w", err)
 	}
 
-	// Обновляем статус сессии
-	session.IsRevoked = true
+	dangling := make([]string, 0)
+	for i, sessionData := range sessionDataList {
+		if sessionData == nil {
+			dangling = append(dangling, sessionIDs[i])
+		}
+	}
 
-	// Сохраняем обновленную сессию
-	sessionData, err := json.Marshal(session)
-	if err != nil {
-		return fmt.Errorf("failed to marshal session %w", err)
+	if err := s.removeFromUserIndex(ctx, email, dangling); err != nil {
+		return 0, err
 	}
 
-	key := sessionPrefix + id
-	if err := s.client.Set(ctx, key, sessionData, ttl).Err(); err != nil {
-		return fmt.Errorf("failed to update session in Redis: %w", err)
+	return len(dangling), nil
+}
+
+// removeFromUserIndex удаляет указанные ID сессий из индекса пользователя
+func (s *RedisStore) removeFromUserIndex(ctx context.Context, email string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+
+	if err := s.client.SRem(ctx, s.keys.userSessions+email, members...).Err(); err != nil {
+		return fmt.Errorf("failed to remove stale sessions from user index: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteSession удаляет сессию из Redis
-func (s *RedisStore) DeleteSession(ctx context.Context, id string) error {
-	if id == "" {
-		return fmt.Errorf("session ID is required")
+// CountActiveSessions возвращает количество сессий пользователя, не загружая их данные.
+// ID сессий, ключи которых уже истекли, удаляются из индекса
+func (s *RedisStore) CountActiveSessions(ctx context.Context, email string) (int64, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if email == "" {
+		return 0, fmt.Errorf("user email is required")
 	}
 
-	// Получаем сессию, чтобы добавить токен в черный список перед удалением
-	session, err := s.GetSession(ctx, id)
+	userSessionsKey := s.keys.userSessions + email
+	sessionIDs, err := s.client.SMembers(ctx, userSessionsKey).Result()
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("failed to get user sessions: %w", err)
 	}
 
-	// Добавляем refresh токен в черный список
-	blacklistKey := blacklistPrefix + session.RefreshToken
-	ttl := session.ExpiresAt.Sub(time.Now())
-	if ttl <= 0 {
-		ttl = time.Minute
+	if len(sessionIDs) == 0 {
+		return 0, nil
 	}
 
-	if err := s.client.Set(ctx, blacklistKey, "deleted", ttl).Err(); err != nil {
-		return fmt.Errorf("failed to add token to blacklist: %w", err)
+	// Проверяем существование всех ключей сессий одним запросом
+	cmds := make([]*redis.IntCmd, len(sessionIDs))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range sessionIDs {
+			cmds[i] = pipe.Exists(ctx, s.keys.session+id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check sessions existence: %w", err)
 	}
 
-	// Удаляем сессию из индекса пользователя
-	userSessionsKey := userSessionsIdx + session.UserEmail
-	if err := s.client.SRem(ctx, userSessionsKey, id).Err(); err != nil {
-		return fmt.Errorf("failed to remove session from user index: %w", err)
+	var count int64
+	dangling := make([]string, 0)
+	for i, cmd := range cmds {
+		if cmd.Val() > 0 {
+			count++
+			continue
+		}
+		dangling = append(dangling, sessionIDs[i])
 	}
 
-	// Удаляем сессию
-	key := sessionPrefix + id
-	if err := s.client.Del(ctx, key).Err(); err != nil {
-		return fmt.Errorf("failed to delete session from Redis: %w", err)
+	// Удаляем из индекса ID истекших сессий
+	if err := s.removeFromUserIndex(ctx, email, dangling); err != nil {
+		return 0, err
 	}
 
-	return nil
+	return count, nil
 }
 
-// IsTokenBlacklisted проверяет, находится ли токен в черном списке
-func (s *RedisStore) IsTokenBlacklisted(ctx context.Context, token string) (bool, error) {
-	if token == "" {
-		return false, fmt.Errorf("token is required")
+// RevokeSession отзывает сессию, добавляя токен в черный список.
+// Отзыв уже отозванной сессии не является ошибкой.
+// Запись в черный список и обновление сессии выполняются в одной транзакции
+// (MULTI/EXEC): либо применяются обе, либо ни одна. В Redis Cluster ключи лежат
+// в разных слотах, поэтому запись идет по очереди: сначала черный список
+func (s *RedisStore) RevokeSession(ctx context.Context, id string, reason RevokeReason) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	// Получаем сессию
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Повторный отзыв ничего не меняет: токен уже находится в черном списке
+	if session.IsRevoked {
+		return nil
+	}
+
+	now := s.clock.Now()
+	ttl := session.ExpiresAt.Sub(now)
+	if ttl <= 0 {
+		ttl = time.Minute // Если токен уже истек, все равно добавляем его на короткое время
+	}
+
+	// Обновляем статус сессии
+	session.IsRevoked = true
+	session.RevokedReason = reason.orUnspecified()
+
+	sessionData, err := s.codec.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session %w", err)
+	}
+
+	blacklistKey := s.keys.blacklist + session.RefreshToken
+	blacklistExpiry := blacklistTTL(now, session.ExpiresAt, s.blacklistRetention)
+
+	// Токен в черном списке уже не пройдет проверку, поэтому при сбое записи сессии
+	// отзыв не теряется, а повторный вызов допишет сессию
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		if err := s.client.Set(ctx, blacklistKey, "revoked", blacklistExpiry).Err(); err != nil {
+			return fmt.Errorf("failed to blacklist refresh token: %w", err)
+		}
+		if err := s.client.Set(ctx, s.keys.session+id, sessionData, ttl).Err(); err != nil {
+			return fmt.Errorf("failed to revoke session in Redis: %w", err)
+		}
+		return nil
+	}
+
+	// Добавляем refresh токен в черный список и сохраняем обновленную сессию атомарно
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, blacklistKey, "revoked", blacklistExpiry)
+		pipe.Set(ctx, s.keys.session+id, sessionData, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllUserSessions отзывает все сессии пользователя и очищает индекс его сессий.
+// Возвращает количество отозванных сессий
+func (s *RedisStore) RevokeAllUserSessions(ctx context.Context, email string, reason RevokeReason) (int, error) {
+	ids, err := s.RevokeUserSessions(ctx, email, reason, false)
+	return len(ids), err
+}
+
+// RevokeUserSessions отзывает все действующие сессии пользователя и возвращает их ID.
+// При dryRun ничего не меняется, но возвращается тот же список, что и при отзыве
+func (s *RedisStore) RevokeUserSessions(ctx context.Context, email string, reason RevokeReason, dryRun bool) ([]string, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if email == "" {
+		return nil, fmt.Errorf("user email is required")
+	}
+
+	userSessionsKey := s.keys.userSessions + email
+	sessionIDs, err := s.client.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	if len(sessionIDs) == 0 {
+		return []string{}, nil // Нечего отзывать
+	}
+
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = s.keys.session + id
+	}
+
+	sessionDataList, err := s.mget(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions data: %w", err)
+	}
+
+	// Собираем сессии, которые еще нужно отозвать
+	sessions := make([]*Session, 0, len(sessionDataList))
+	revokedIDs := make([]string, 0, len(sessionDataList))
+	for _, sessionData := range sessionDataList {
+		sessionStr, ok := sessionData.(string)
+		if !ok {
+			continue // Пропускаем отсутствующие и неверные данные
+		}
+
+		var session Session
+		if err := s.codec.Unmarshal([]byte(sessionStr), &session); err != nil {
+			continue // Пропускаем поврежденные данные
+		}
+
+		if session.UserEmail == email && !session.IsRevoked {
+			sessions = append(sessions, &session)
+			revokedIDs = append(revokedIDs, session.Id)
+		}
+	}
+	sort.Strings(revokedIDs)
+
+	if dryRun {
+		return revokedIDs, nil
+	}
+
+	now := s.clock.Now()
+	revoked := make([]revokedSession, 0, len(sessions))
+	for _, session := range sessions {
+		ttl := session.ExpiresAt.Sub(now)
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+
+		session.IsRevoked = true
+		session.RevokedReason = reason.orUnspecified()
+		sessionData, err := s.codec.Marshal(session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal session %w", err)
+		}
+
+		revoked = append(revoked, revokedSession{
+			id:              session.Id,
+			data:            sessionData,
+			ttl:             ttl,
+			blacklistKey:    s.keys.blacklist + session.RefreshToken,
+			blacklistExpiry: blacklistTTL(now, session.ExpiresAt, s.blacklistRetention),
+		})
+	}
+
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		if err := s.revokeSessionsCluster(ctx, userSessionsKey, revoked); err != nil {
+			return nil, err
+		}
+		return revokedIDs, nil
+	}
+
+	// Все изменения применяются одной транзакцией
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range revoked {
+			pipe.Set(ctx, r.blacklistKey, "revoked", r.blacklistExpiry)
+			pipe.Set(ctx, s.keys.session+r.id, r.data, r.ttl)
+		}
+
+		pipe.Del(ctx, userSessionsKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	return revokedIDs, nil
+}
+
+// revokedSession подготовленная к записи отозванная сессия
+type revokedSession struct {
+	id              string
+	data            []byte
+	ttl             time.Duration
+	blacklistKey    string
+	blacklistExpiry time.Duration
+}
+
+// revokeSessionsCluster вариант записи RevokeUserSessions для Redis Cluster, где
+// транзакция не охватывает ключи разных слотов. Сначала в черный список попадают
+// все токены: после этого сессии уже недействительны, и сбой следующего шага
+// оставляет их отозванными, а повторный вызов допишет данные сессий
+func (s *RedisStore) revokeSessionsCluster(ctx context.Context, userSessionsKey string, revoked []revokedSession) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range revoked {
+			pipe.Set(ctx, r.blacklistKey, "revoked", r.blacklistExpiry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to blacklist refresh tokens: %w", err)
+	}
+
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range revoked {
+			pipe.Set(ctx, s.keys.session+r.id, r.data, r.ttl)
+		}
+		pipe.Del(ctx, userSessionsKey)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken заменяет refresh токен сессии на новый, добавляя старый в черный список.
+// Оставшееся время жизни сессии сохраняется
+func (s *RedisStore) RotateRefreshToken(ctx context.Context, sessionID, newRefreshToken string) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if newRefreshToken == "" {
+		return fmt.Errorf("new refresh token is required")
+	}
+
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.IsRevoked {
+		return fmt.Errorf("cannot rotate refresh token: %w", ErrSessionRevoked)
+	}
+
+	ttl := session.ExpiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return fmt.Errorf("session is expired")
+	}
+
+	oldRefreshToken := session.RefreshToken
+	session.RefreshToken = refreshTokenHash(newRefreshToken)
+
+	// Старый токен хранится в черном списке не меньше blacklistRetention, даже если
+	// сессии осталось жить меньше; более долгую запись скрипт не сокращает
+	blacklistExpiry := blacklistTTL(s.clock.Now(), session.ExpiresAt, s.blacklistRetention)
+
+	sessionData, err := s.codec.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session %w", err)
+	}
+
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		return s.rotateRefreshTokenCluster(ctx, session, sessionData, oldRefreshToken, ttl, blacklistExpiry)
+	}
+
+	// Индекс пользователя не трогаем: ID сессии не меняется.
+	// Внутри MULTI скрипт передается целиком: EVALSHA мог бы упасть с NOSCRIPT
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		blacklistTokenScript.Eval(ctx, pipe, []string{s.keys.blacklist + oldRefreshToken}, "rotated", blacklistExpiry.Milliseconds())
+		pipe.Set(ctx, s.keys.session+sessionID, sessionData, ttl)
+		pipe.Del(ctx, s.keys.refreshToken+oldRefreshToken)
+		pipe.Set(ctx, s.keys.refreshToken+session.RefreshToken, sessionID, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// rotateRefreshTokenCluster вариант записи RotateRefreshToken для Redis Cluster.
+// Шаги упорядочены так, чтобы сбой на любом из них не оставлял рабочим старый
+// токен вместе с новым: индекс нового токена без сессии не находит ничего, при
+// сбое записи сессии он удаляется. После записи сессии старый токен уже не
+// совпадает с ней, поэтому черный список и удаление старого индекса — очистка,
+// ошибки которой не отменяют ротацию: индекс истечет вместе с сессией
+func (s *RedisStore) rotateRefreshTokenCluster(ctx context.Context, session *Session, sessionData []byte, oldRefreshToken string, ttl, blacklistExpiry time.Duration) error {
+	newIndexKey := s.keys.refreshToken + session.RefreshToken
+	if err := s.client.Set(ctx, newIndexKey, session.Id, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := s.client.Set(ctx, s.keys.session+session.Id, sessionData, ttl).Err(); err != nil {
+		// Компенсация: без сессии индекс нового токена бесполезен
+		s.client.Del(ctx, newIndexKey)
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	blacklistTokenScript.Run(ctx, s.client, []string{s.keys.blacklist + oldRefreshToken}, "rotated", blacklistExpiry.Milliseconds())
+	s.client.Del(ctx, s.keys.refreshToken+oldRefreshToken)
+
+	return nil
+}
+
+// RehashRefreshToken переводит сессию, записанную до хеширования refresh токенов, на хеш:
+// сохраняет хеш вместо сырого токена и создает запись обратного индекса, которой у таких
+// сессий нет. Сессия с уже хешированным токеном не меняется
+func (s *RedisStore) RehashRefreshToken(ctx context.Context, sessionID, token string) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !session.HasLegacyRefreshToken() {
+		return nil
+	}
+
+	if !session.RefreshTokenMatches(token) {
+		return fmt.Errorf("refresh token does not match session")
+	}
+
+	ttl := session.ExpiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return fmt.Errorf("session is expired")
+	}
+
+	session.RefreshToken = refreshTokenHash(token)
+
+	sessionData, err := s.codec.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session %w", err)
+	}
+
+	if err := s.client.Set(ctx, s.keys.session+sessionID, sessionData, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to update session in Redis: %w", err)
+	}
+
+	if err := s.client.Set(ctx, s.keys.refreshToken+session.RefreshToken, sessionID, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to index session by refresh token: %w", err)
 	}
 
-	key := blacklistPrefix + token
+	return nil
+}
+
+// ExtendSession продлевает жизнь сессии на ttl от текущего момента (sliding expiration).
+// TTL индекса пользовательских сессий при этом никогда не становится короче TTL сессии
+func (s *RedisStore) ExtendSession(ctx context.Context, id string, ttl time.Duration) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if session.IsRevoked {
+		return fmt.Errorf("cannot extend session: %w", ErrSessionRevoked)
+	}
+
+	now := s.clock.Now().UTC()
+	session.LastAccessedAt = now
+	session.ExpiresAt = now.Add(ttl)
+
+	sessionData, err := s.codec.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session %w", err)
+	}
+
+	key := s.keys.session + id
+	if err := s.client.Set(ctx, key, sessionData, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to update session in Redis: %w", err)
+	}
+
+	if err := s.client.Expire(ctx, s.keys.refreshToken+session.RefreshToken, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to extend refresh token index: %w", err)
+	}
+
+	// Продлеваем индекс, только если он живет меньше продленной сессии
+	userSessionsKey := s.keys.userSessions + session.UserEmail
+	indexTTL, err := s.client.TTL(ctx, userSessionsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get user sessions index TTL: %w", err)
+	}
+
+	if indexTTL < ttl {
+		if err := s.client.Expire(ctx, userSessionsKey, ttl).Err(); err != nil {
+			return fmt.Errorf("failed to set expiration for user sessions index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateSessionLabel меняет пользовательское название сессии; пустая строка убирает название
+func (s *RedisStore) UpdateSessionLabel(ctx context.Context, id, label string) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if err := validateLabel(label); err != nil {
+		return err
+	}
+
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if session.IsRevoked {
+		return fmt.Errorf("cannot update session label: %w", ErrSessionRevoked)
+	}
+
+	ttl := session.ExpiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return fmt.Errorf("session is expired")
+	}
+
+	session.Label = label
+
+	sessionData, err := s.codec.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session %w", err)
+	}
+
+	if err := s.client.Set(ctx, s.keys.session+id, sessionData, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to update session in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// validateLabel проверяет длину названия сессии
+func validateLabel(label string) error {
+	if utf8.RuneCountInString(label) > MaxSessionLabelLength {
+		return fmt.Errorf("%w: max %d characters", ErrLabelTooLong, MaxSessionLabelLength)
+	}
+	return nil
+}
+
+// ValidateMetadata проверяет число ключей и длину ключей и значений метаданных сессии
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxSessionMetadataKeys {
+		return fmt.Errorf("%w: max %d keys", ErrInvalidMetadata, MaxSessionMetadataKeys)
+	}
+
+	for key, value := range metadata {
+		if key == "" {
+			return fmt.Errorf("%w: empty key", ErrInvalidMetadata)
+		}
+		if len(key) > MaxSessionMetadataKeyLength {
+			return fmt.Errorf("%w: key %q longer than %d bytes", ErrInvalidMetadata, key, MaxSessionMetadataKeyLength)
+		}
+		if len(value) > MaxSessionMetadataValueLength {
+			return fmt.Errorf("%w: value of %q longer than %d bytes", ErrInvalidMetadata, key, MaxSessionMetadataValueLength)
+		}
+	}
+
+	return nil
+}
+
+// DeleteSession удаляет сессию; отсутствующая сессия считается уже удаленной из Redis
+func (s *RedisStore) DeleteSession(ctx context.Context, id string) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+
+	// Получаем сессию, чтобы добавить токен в черный список перед удалением.
+	// Удаление уже отсутствующей сессии не считается ошибкой: ее ID мог остаться
+	// только в индексе пользователя, а его чистят GetSessionsByEmail и reaper
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Добавляем refresh токен в черный список
+	blacklistKey := s.keys.blacklist + session.RefreshToken
+	ttl := blacklistTTL(s.clock.Now(), session.ExpiresAt, s.blacklistRetention)
+
+	if err := s.client.Set(ctx, blacklistKey, "deleted", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to add token to blacklist: %w", err)
+	}
+
+	// Удаляем сессию из индекса пользователя
+	userSessionsKey := s.keys.userSessions + session.UserEmail
+	if err := s.client.SRem(ctx, userSessionsKey, id).Err(); err != nil {
+		return fmt.Errorf("failed to remove session from user index: %w", err)
+	}
+
+	// Удаляем сессию
+	key := s.keys.session + id
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete session from Redis: %w", err)
+	}
+
+	// Обратный индекс без сессии безвреден: поиск сверяет токен с сессией
+	if err := s.client.Del(ctx, s.keys.refreshToken+session.RefreshToken).Err(); err != nil {
+		return fmt.Errorf("failed to delete refresh token index: %w", err)
+	}
+
+	return nil
+}
+
+// IsTokenBlacklisted проверяет, находится ли сырой refresh токен в черном списке
+func (s *RedisStore) IsTokenBlacklisted(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if token == "" {
+		return false, fmt.Errorf("token is required")
+	}
+
+	key := s.keys.blacklist + refreshTokenHash(token)
 	exists, err := s.client.Exists(ctx, key).Result()
 	if err != nil {
 		return false, fmt.Errorf("failed to check if token is blacklisted: %w", err)
@@ -257,3 +1258,105 @@ func (s *RedisStore) IsTokenBlacklisted(ctx context.Context, token string) (bool
 
 	return exists > 0, nil
 }
+
+// blacklistTokenScript записывает токен в черный список, не сокращая срок уже
+// существующей записи. KEYS[1] — ключ черного списка, ARGV: значение, TTL в мс
+var blacklistTokenScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -1 or ttl >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// BlacklistToken вносит сырой refresh токен в черный список на ttl, даже если
+// сессии с этим токеном нет. Если токен уже в черном списке дольше, срок не меняется
+func (s *RedisStore) BlacklistToken(ctx context.Context, token string, ttl time.Duration) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("blacklist TTL must be positive")
+	}
+
+	key := s.keys.blacklist + refreshTokenHash(token)
+	if err := blacklistTokenScript.Run(ctx, s.client, []string{key}, "blacklisted", ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to add token to blacklist: %w", err)
+	}
+
+	return nil
+}
+
+// AreTokensBlacklisted проверяет несколько сырых refresh токенов одним пайплайном.
+// Результат содержит каждый непустой токен из запроса; повторы проверяются один раз
+func (s *RedisStore) AreTokensBlacklisted(ctx context.Context, tokens []string) (map[string]bool, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	pipe := s.client.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(tokens))
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		if _, ok := cmds[token]; ok {
+			continue
+		}
+		cmds[token] = pipe.Exists(ctx, s.keys.blacklist+refreshTokenHash(token))
+	}
+
+	result := make(map[string]bool, len(cmds))
+	if len(cmds) == 0 {
+		return result, nil
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to check if tokens are blacklisted: %w", err)
+	}
+
+	for token, cmd := range cmds {
+		result[token] = cmd.Val() > 0
+	}
+
+	return result, nil
+}
+
+// Probe проверяет, что хранилище действительно доступно на запись и чтение:
+// записывает временный ключ, читает его и удаляет.
+// Ключ имеет TTL, поэтому не остается в Redis, даже если удаление не прошло
+func (s *RedisStore) Probe(ctx context.Context) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("probe: failed to generate key: %w", err)
+	}
+
+	key := s.keys.probe + hex.EncodeToString(b)
+	value := s.clock.Now().UTC().Format(time.RFC3339Nano)
+
+	if err := s.client.Set(ctx, key, value, probeTTL).Err(); err != nil {
+		return fmt.Errorf("probe write failed: %w", err)
+	}
+
+	got, err := s.client.Get(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("probe read failed: %w", err)
+	}
+
+	if got != value {
+		return fmt.Errorf("probe read returned unexpected value")
+	}
+
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("probe delete failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,827 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeClock управляемые часы для проверок TTL и истечения
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestRedisStore поднимает miniredis и RedisStore поверх него
+func newTestRedisStore(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://"+mr.Addr(), context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store, mr
+}
+
+// newTestClusterStore RedisStore с клиентом Redis Cluster поверх miniredis,
+// который отвечает на CLUSTER SLOTS как кластер из одного узла
+func newTestClusterStore(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://"+mr.Addr(), context.Background(), append(opts, WithCluster(mr.Addr()))...)
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if _, ok := store.client.(*redis.ClusterClient); !ok {
+		t.Fatalf("client = %T, want *redis.ClusterClient", store.client)
+	}
+	return store, mr
+}
+
+// newTestSession сессия пользователя email, действующая сутки от now
+func newTestSession(id, email string, now time.Time) *Session {
+	return &Session{
+		Id:           id,
+		UserEmail:    email,
+		RefreshToken: "refresh-" + id,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(24 * time.Hour),
+	}
+}
+
+// userIndex возвращает отсортированные ID из индекса сессий пользователя
+func userIndex(t *testing.T, store *RedisStore, email string) []string {
+	t.Helper()
+
+	ids, err := store.client.SMembers(context.Background(), store.keys.userSessions+email).Result()
+	if err != nil {
+		t.Fatalf("SMembers: %v", err)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRedisStoreEvictsOldestSession(t *testing.T) {
+	clock := newFakeClock()
+	store, _ := newTestRedisStore(t, WithMaxSessionsPerUser(3), WithClock(clock))
+	ctx := context.Background()
+
+	for i := 1; i <= 4; i++ {
+		if _, err := store.CreateSession(ctx, newTestSession(fmt.Sprintf("s%d", i), "user@example.com", clock.Now())); err != nil {
+			t.Fatalf("CreateSession s%d: %v", i, err)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	if _, err := store.GetSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetSession(s1) error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	blacklisted, err := store.IsTokenBlacklisted(ctx, "refresh-s1")
+	if err != nil {
+		t.Fatalf("IsTokenBlacklisted: %v", err)
+	}
+	if !blacklisted {
+		t.Error("refresh token of the evicted session is not blacklisted")
+	}
+
+	if _, err := store.GetSessionByRefreshToken(ctx, "refresh-s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionByRefreshToken(s1) error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if got, want := userIndex(t, store, "user@example.com"), []string{"s2", "s3", "s4"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("user index = %v, want %v", got, want)
+	}
+}
+
+func TestRedisStoreEvictionDropsStaleIndexEntries(t *testing.T) {
+	clock := newFakeClock()
+	store, _ := newTestRedisStore(t, WithMaxSessionsPerUser(2), WithClock(clock))
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := store.CreateSession(ctx, newTestSession(id, "user@example.com", clock.Now())); err != nil {
+			t.Fatalf("CreateSession %s: %v", id, err)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	// ID истекшей сессии, оставшийся в индексе
+	if err := store.client.SAdd(ctx, store.keys.userSessions+"user@example.com", "ghost").Err(); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+
+	if _, err := store.CreateSession(ctx, newTestSession("c", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession c: %v", err)
+	}
+
+	if got, want := userIndex(t, store, "user@example.com"), []string{"b", "c"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("user index = %v, want %v", got, want)
+	}
+}
+
+func TestRedisStoreConcurrentCreatesRespectLimit(t *testing.T) {
+	const limit, creators = 3, 8
+
+	store, _ := newTestRedisStore(t, WithMaxSessionsPerUser(limit))
+	ctx := context.Background()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, creators)
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session := newTestSession(fmt.Sprintf("s%d", i), "user@example.com", now.Add(time.Duration(i)*time.Second))
+			if _, err := store.CreateSession(ctx, session); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("CreateSession: %v", err)
+	}
+
+	ids := userIndex(t, store, "user@example.com")
+	if len(ids) != limit {
+		t.Fatalf("user index has %d sessions, want %d: %v", len(ids), limit, ids)
+	}
+
+	sessions, err := store.BatchGetSessions(ctx, ids)
+	if err != nil {
+		t.Fatalf("BatchGetSessions: %v", err)
+	}
+	if len(sessions) != limit {
+		t.Errorf("%d indexed sessions exist, want %d", len(sessions), limit)
+	}
+
+	keys, err := store.client.Keys(ctx, store.keys.session+"*").Result()
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(keys) != limit {
+		t.Errorf("%d session keys left, want %d", len(keys), limit)
+	}
+}
+
+func TestRedisStoreStoresRefreshTokenHash(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	if _, err := store.CreateSession(ctx, newTestSession("s1", "user@example.com", clock.Now())); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	raw, err := mr.Get(store.keys.session + "s1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if strings.Contains(raw, "refresh-s1") {
+		t.Errorf("stored session contains the raw refresh token: %s", raw)
+	}
+	if !strings.Contains(raw, refreshTokenHash("refresh-s1")) {
+		t.Errorf("stored session does not contain the refresh token hash: %s", raw)
+	}
+
+	// Утекший хеш не должен работать как токен
+	session, err := store.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if session.RefreshTokenMatches(session.RefreshToken) {
+		t.Error("stored hash is accepted as a refresh token")
+	}
+
+	if err := store.RevokeSession(ctx, "s1", RevokeReasonLogout); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	blacklisted, err := store.IsTokenBlacklisted(ctx, "refresh-s1")
+	if err != nil {
+		t.Fatalf("IsTokenBlacklisted: %v", err)
+	}
+	if !blacklisted {
+		t.Error("raw refresh token is not blacklisted after revoke")
+	}
+}
+
+func TestRedisStoreRehashesLegacyRefreshToken(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	// Сессия, записанная до хеширования: в ней сырой токен и нет обратного индекса
+	const legacyToken = "dGhpcy1pcy1hLWxlZ2FjeS1yZWZyZXNoLXRva2VuLXZhbHVl"
+	legacy := newTestSession("s1", "user@example.com", clock.Now())
+	legacy.RefreshToken = legacyToken
+	data, err := store.codec.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := mr.Set(store.keys.session+"s1", string(data)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	mr.SetTTL(store.keys.session+"s1", 24*time.Hour)
+
+	session, err := store.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if !session.HasLegacyRefreshToken() || !session.RefreshTokenMatches(legacyToken) {
+		t.Fatal("legacy session does not accept its raw refresh token")
+	}
+	if session.RefreshTokenMatches("other") {
+		t.Fatal("legacy session accepts a foreign refresh token")
+	}
+
+	if err := store.RehashRefreshToken(ctx, "s1", "other"); err == nil {
+		t.Fatal("RehashRefreshToken accepted a foreign refresh token")
+	}
+	if err := store.RehashRefreshToken(ctx, "s1", legacyToken); err != nil {
+		t.Fatalf("RehashRefreshToken: %v", err)
+	}
+
+	session, err = store.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if session.HasLegacyRefreshToken() || session.RefreshToken != refreshTokenHash(legacyToken) {
+		t.Errorf("refresh token after rehash = %q, want its hash", session.RefreshToken)
+	}
+	if !session.RefreshTokenMatches(legacyToken) {
+		t.Error("rehashed session does not accept its refresh token")
+	}
+
+	byToken, err := store.GetSessionByRefreshToken(ctx, legacyToken)
+	if err != nil {
+		t.Fatalf("GetSessionByRefreshToken: %v", err)
+	}
+	if byToken.Id != "s1" {
+		t.Errorf("GetSessionByRefreshToken = %s, want s1", byToken.Id)
+	}
+
+	if ttl := mr.TTL(store.keys.session + "s1"); ttl <= 0 || ttl > 24*time.Hour {
+		t.Errorf("session TTL after rehash = %s, want the remaining lifetime", ttl)
+	}
+}
+
+func TestRedisStoreRotateRefreshToken(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis){
+		"single node": newTestRedisStore,
+		"cluster":     newTestClusterStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, _ := newStore(t, WithClock(clock))
+			ctx := context.Background()
+
+			if _, err := store.CreateSession(ctx, newTestSession("s1", "user@example.com", clock.Now())); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+
+			if err := store.RotateRefreshToken(ctx, "s1", "refresh-new"); err != nil {
+				t.Fatalf("RotateRefreshToken: %v", err)
+			}
+
+			blacklisted, err := store.AreTokensBlacklisted(ctx, []string{"refresh-s1", "refresh-new"})
+			if err != nil {
+				t.Fatalf("AreTokensBlacklisted: %v", err)
+			}
+			if !blacklisted["refresh-s1"] || blacklisted["refresh-new"] {
+				t.Errorf("blacklisted = %v, want only the old token", blacklisted)
+			}
+
+			if _, err := store.GetSessionByRefreshToken(ctx, "refresh-s1"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("GetSessionByRefreshToken(old) error = %v, want %v", err, ErrSessionNotFound)
+			}
+			session, err := store.GetSessionByRefreshToken(ctx, "refresh-new")
+			if err != nil {
+				t.Fatalf("GetSessionByRefreshToken(new): %v", err)
+			}
+			if session.Id != "s1" || session.RefreshTokenMatches("refresh-s1") {
+				t.Errorf("session after rotation = %+v, want s1 matching only the new token", session)
+			}
+		})
+	}
+}
+
+func TestRedisStoreRotateRefreshTokenBlacklistRetention(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis){
+		"single node": newTestRedisStore,
+		"cluster":     newTestClusterStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, mr := newStore(t, WithClock(clock), WithBlacklistRetention(2*time.Hour))
+			ctx := context.Background()
+
+			// Сессии осталось жить 30 секунд, но старый токен держится в черном списке retention
+			session := newTestSession("s1", "user@example.com", clock.Now())
+			session.ExpiresAt = clock.Now().Add(30 * time.Second)
+			if _, err := store.CreateSession(ctx, session); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if err := store.RotateRefreshToken(ctx, "s1", "refresh-new"); err != nil {
+				t.Fatalf("RotateRefreshToken: %v", err)
+			}
+			if ttl := mr.TTL(store.keys.blacklist + refreshTokenHash("refresh-s1")); ttl != 2*time.Hour {
+				t.Errorf("blacklist TTL = %s, want the 2h retention", ttl)
+			}
+
+			// Более долгая запись черного списка не сокращается ротацией
+			if err := store.BlacklistToken(ctx, "refresh-new", 48*time.Hour); err != nil {
+				t.Fatalf("BlacklistToken: %v", err)
+			}
+			if err := store.RotateRefreshToken(ctx, "s1", "refresh-newer"); err != nil {
+				t.Fatalf("RotateRefreshToken: %v", err)
+			}
+			if ttl := mr.TTL(store.keys.blacklist + refreshTokenHash("refresh-new")); ttl != 48*time.Hour {
+				t.Errorf("blacklist TTL = %s, want the existing 48h", ttl)
+			}
+		})
+	}
+}
+
+// failSetHook выдает ошибку для SET указанного ключа в пайплайне, как при сбое
+// записи одной команды (например, OOM на узле)
+type failSetHook struct {
+	key string
+}
+
+func (failSetHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failSetHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (failSetHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h failSetHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if args := cmd.Args(); cmd.Name() == "set" && len(args) > 1 && args[1] == h.key {
+			cmd.SetErr(errors.New("OOM command not allowed when used memory > 'maxmemory'"))
+		}
+	}
+	return nil
+}
+
+func TestRedisStoreBatchCreateCleansUpFailedEntry(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	store.client.AddHook(failSetHook{key: store.keys.session + "s2"})
+
+	itemErrs, err := store.BatchCreateSessions(ctx, []*Session{
+		newTestSession("s1", "user@example.com", clock.Now()),
+		newTestSession("s2", "user@example.com", clock.Now()),
+	})
+	if err != nil {
+		t.Fatalf("BatchCreateSessions: %v", err)
+	}
+	if itemErrs[0] != nil || itemErrs[1] == nil {
+		t.Fatalf("item errors = %v, want only s2 to fail", itemErrs)
+	}
+
+	if got := userIndex(t, store, "user@example.com"); fmt.Sprint(got) != "[s1]" {
+		t.Errorf("user index = %v, want [s1]", got)
+	}
+	if mr.Exists(store.keys.refreshToken + refreshTokenHash("refresh-s2")) {
+		t.Error("refresh token index of the failed session is left behind")
+	}
+	if _, err := store.GetSessionByRefreshToken(ctx, "refresh-s1"); err != nil {
+		t.Errorf("GetSessionByRefreshToken(s1): %v", err)
+	}
+}
+
+// createExpiredSession создает у user@example.com сессию "short" на час и "long" на сутки
+// и сдвигает время так, что ключ "short" истекает, а его ID остается в индексе
+func createExpiredSession(t *testing.T, store *RedisStore, clock *fakeClock, mr *miniredis.Miniredis) {
+	t.Helper()
+	ctx := context.Background()
+
+	short := newTestSession("short", "user@example.com", clock.Now())
+	short.ExpiresAt = clock.Now().Add(time.Hour)
+	for _, session := range []*Session{short, newTestSession("long", "user@example.com", clock.Now())} {
+		if _, err := store.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession %s: %v", session.Id, err)
+		}
+	}
+
+	clock.Advance(2 * time.Hour)
+	mr.FastForward(2 * time.Hour)
+
+	if got := userIndex(t, store, "user@example.com"); fmt.Sprint(got) != "[long short]" {
+		t.Fatalf("user index before cleanup = %v, want [long short]", got)
+	}
+}
+
+func TestRedisStoreCountActiveSessionsPrunesExpired(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	createExpiredSession(t, store, clock, mr)
+
+	count, err := store.CountActiveSessions(context.Background(), "user@example.com")
+	if err != nil {
+		t.Fatalf("CountActiveSessions: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("CountActiveSessions = %d, want 1", count)
+	}
+	if got := userIndex(t, store, "user@example.com"); fmt.Sprint(got) != "[long]" {
+		t.Errorf("user index = %v, want [long]", got)
+	}
+}
+
+func TestRedisStoreCleansUpOrphanedIndexEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		cleanup func(t *testing.T, store *RedisStore)
+	}{
+		{"PruneUserIndex", func(t *testing.T, store *RedisStore) {
+			pruned, err := store.PruneUserIndex(context.Background(), "user@example.com")
+			if err != nil {
+				t.Fatalf("PruneUserIndex: %v", err)
+			}
+			if pruned != 1 {
+				t.Errorf("PruneUserIndex pruned %d, want 1", pruned)
+			}
+		}},
+		{"GetSessionsByEmail", func(t *testing.T, store *RedisStore) {
+			sessions, err := store.GetSessionsByEmail(context.Background(), "user@example.com")
+			if err != nil {
+				t.Fatalf("GetSessionsByEmail: %v", err)
+			}
+			if len(sessions) != 1 || sessions[0].Id != "long" {
+				t.Errorf("GetSessionsByEmail returned %d sessions, want only long", len(sessions))
+			}
+		}},
+		{"ReapUserIndexes", func(t *testing.T, store *RedisStore) {
+			result, err := store.ReapUserIndexes(context.Background())
+			if err != nil {
+				t.Fatalf("ReapUserIndexes: %v", err)
+			}
+			if result.UsersScanned != 1 || result.PrunedIDs != 1 {
+				t.Errorf("ReapUserIndexes = %+v, want 1 user scanned and 1 ID pruned", result)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, mr := newTestRedisStore(t, WithClock(clock))
+			createExpiredSession(t, store, clock, mr)
+
+			tt.cleanup(t, store)
+
+			if got := userIndex(t, store, "user@example.com"); fmt.Sprint(got) != "[long]" {
+				t.Errorf("user index after %s = %v, want [long]", tt.name, got)
+			}
+		})
+	}
+}
+
+func TestRedisStoreRevokeSessionWritesBothKeys(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis){
+		"single node": newTestRedisStore,
+		"cluster":     newTestClusterStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, mr := newStore(t, WithClock(clock))
+			ctx := context.Background()
+
+			if _, err := store.CreateSession(ctx, newTestSession("s1", "user@example.com", clock.Now())); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if err := store.RevokeSession(ctx, "s1", RevokeReasonCompromised); err != nil {
+				t.Fatalf("RevokeSession: %v", err)
+			}
+
+			// Сессия переписана с отметкой отзыва и прежним сроком жизни
+			data, err := mr.Get(store.keys.session + "s1")
+			if err != nil {
+				t.Fatalf("session key: %v", err)
+			}
+			var stored Session
+			if err := store.codec.Unmarshal([]byte(data), &stored); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !stored.IsRevoked || stored.RevokedReason != RevokeReasonCompromised {
+				t.Errorf("stored session revoked = %v reason = %q, want revoked with %q", stored.IsRevoked, stored.RevokedReason, RevokeReasonCompromised)
+			}
+			if ttl := mr.TTL(store.keys.session + "s1"); ttl != 24*time.Hour {
+				t.Errorf("session TTL = %s, want 24h", ttl)
+			}
+
+			blacklistKey := store.keys.blacklist + refreshTokenHash("refresh-s1")
+			if !mr.Exists(blacklistKey) {
+				t.Fatal("refresh token is not blacklisted")
+			}
+			if ttl := mr.TTL(blacklistKey); ttl != 24*time.Hour {
+				t.Errorf("blacklist TTL = %s, want 24h", ttl)
+			}
+		})
+	}
+}
+
+func TestRedisStoreBatchGetSessionsPartialHits(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := store.CreateSession(ctx, newTestSession(id, "user@example.com", clock.Now())); err != nil {
+			t.Fatalf("CreateSession(%s): %v", id, err)
+		}
+	}
+	// Поврежденная запись не должна ломать весь запрос
+	if err := mr.Set(store.keys.session+"corrupt", "{not json"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	sessions, err := store.BatchGetSessions(ctx, []string{"s1", "missing", "s2", "s1", "", "corrupt"})
+	if err != nil {
+		t.Fatalf("BatchGetSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("BatchGetSessions returned %d sessions, want 2: %v", len(sessions), sessions)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		if got, ok := sessions[id]; !ok || got.Id != id {
+			t.Errorf("sessions[%s] = %+v, want session %s", id, got, id)
+		}
+	}
+}
+
+// nopLogger отбрасывает логи фоновых задач в тестах
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) Fatal(string, ...interface{}) {}
+func (nopLogger) Panic(string, ...interface{}) {}
+
+func TestStartReaperCleansStaleIndexes(t *testing.T) {
+	stores := map[string]func(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis){
+		"single node": newTestRedisStore,
+		"cluster":     newTestClusterStore,
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			store, _ := newStore(t, WithClock(clock))
+			ctx := context.Background()
+
+			for _, email := range []string{"alice@example.com", "bob@example.com"} {
+				if _, err := store.CreateSession(ctx, newTestSession("live-"+email, email, clock.Now())); err != nil {
+					t.Fatalf("CreateSession: %v", err)
+				}
+				// Висячие ID: ключей сессий нет, а индекс на них ссылается
+				if err := store.client.SAdd(ctx, store.keys.userSessions+email, "gone-1", "gone-2").Err(); err != nil {
+					t.Fatalf("SAdd: %v", err)
+				}
+			}
+			// Индекс, ссылающийся на сессию другого пользователя
+			if err := store.client.SAdd(ctx, store.keys.userSessions+"carol@example.com", "live-alice@example.com").Err(); err != nil {
+				t.Fatalf("SAdd: %v", err)
+			}
+
+			reapCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			StartReaper(reapCtx, store, 10*time.Millisecond, nopLogger{})
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				alice := fmt.Sprint(userIndex(t, store, "alice@example.com"))
+				bob := fmt.Sprint(userIndex(t, store, "bob@example.com"))
+				carol := userIndex(t, store, "carol@example.com")
+				if alice == "[live-alice@example.com]" && bob == "[live-bob@example.com]" && len(carol) == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("indexes after reaping: alice %s, bob %s, carol %v", alice, bob, carol)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if _, err := store.GetSession(ctx, "live-alice@example.com"); err != nil {
+				t.Errorf("reaper touched a live session: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedisStoreRefreshTokenIndex(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+	ctx := context.Background()
+
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := store.CreateSession(ctx, newTestSession(id, "user@example.com", clock.Now())); err != nil {
+			t.Fatalf("CreateSession(%s): %v", id, err)
+		}
+	}
+
+	indexKey := store.keys.refreshToken + refreshTokenHash("refresh-s1")
+	if got := mr.TTL(indexKey); got != mr.TTL(store.keys.session+"s1") || got != 24*time.Hour {
+		t.Errorf("reverse index TTL = %s, want the session TTL %s", got, mr.TTL(store.keys.session+"s1"))
+	}
+
+	session, err := store.GetSessionByRefreshToken(ctx, "refresh-s1")
+	if err != nil {
+		t.Fatalf("GetSessionByRefreshToken: %v", err)
+	}
+	if session.Id != "s1" {
+		t.Errorf("GetSessionByRefreshToken = %s, want s1", session.Id)
+	}
+	if _, err := store.GetSessionByRefreshToken(ctx, "unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionByRefreshToken(unknown) error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if err := store.DeleteSession(ctx, "s1"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if mr.Exists(indexKey) {
+		t.Error("reverse index entry left after DeleteSession")
+	}
+	if _, err := store.GetSessionByRefreshToken(ctx, "refresh-s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionByRefreshToken after delete error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	// Удаление одной сессии не трогает индекс другой
+	if _, err := store.GetSessionByRefreshToken(ctx, "refresh-s2"); err != nil {
+		t.Errorf("GetSessionByRefreshToken(s2) after deleting s1: %v", err)
+	}
+}
+
+func TestRedisStoreIsSessionValidExpired(t *testing.T) {
+	// С JSON проверка идет Lua скриптом, с gzip двумя запросами
+	for _, codec := range []SessionCodec{JSONCodec{}, GzipCodec{}} {
+		t.Run(fmt.Sprintf("%T", codec), func(t *testing.T) {
+			clock := newFakeClock()
+			store, _ := newTestRedisStore(t, WithClock(clock), WithCodec(codec))
+			ctx := context.Background()
+
+			session := newTestSession("s1", "user@example.com", clock.Now())
+			if _, err := store.CreateSession(ctx, session); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+
+			// Часы сервиса ушли вперед, а ключ в Redis еще не истек
+			clock.Advance(25 * time.Hour)
+			valid, reason, err := store.IsSessionValid(ctx, "s1")
+			if err != nil {
+				t.Fatalf("IsSessionValid: %v", err)
+			}
+			if valid || reason != SessionReasonExpired {
+				t.Errorf("IsSessionValid = %v, %q, want false, %q", valid, reason, SessionReasonExpired)
+			}
+		})
+	}
+}
+
+func TestRedisStoreReadsLegacyLocalTimes(t *testing.T) {
+	clock := newFakeClock()
+	store, mr := newTestRedisStore(t, WithClock(clock))
+
+	// Сессия, записанная до перехода на UTC сервером в поясе +03:00
+	legacy := `{"Id":"s1","UserEmail":"user@example.com","RefreshToken":"` + refreshTokenHash("refresh-s1") +
+		`","CreatedAt":"2025-01-01T15:00:00+03:00","ExpiresAt":"2025-01-02T15:00:00+03:00"}`
+	mr.Set(store.keys.session+"s1", legacy)
+
+	got, err := store.GetSession(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if got.CreatedAt.Location() != time.UTC || !got.CreatedAt.Equal(clock.Now()) {
+		t.Errorf("CreatedAt = %s, want %s in UTC", got.CreatedAt, clock.Now())
+	}
+	if got.ExpiresAt.Location() != time.UTC {
+		t.Errorf("ExpiresAt = %s, want UTC", got.ExpiresAt)
+	}
+}
+
+func TestRedisStoreKeyNamespace(t *testing.T) {
+	clock := newFakeClock()
+	staging, mr := newTestRedisStore(t, WithClock(clock), WithKeyNamespace("staging"))
+	other, err := NewRedisStore("redis://"+mr.Addr(), context.Background(), WithClock(clock), WithKeyNamespace("test"))
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { other.Close() })
+	ctx := context.Background()
+
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := staging.CreateSession(ctx, newTestSession(id, "user@example.com", clock.Now())); err != nil {
+			t.Fatalf("CreateSession(%s): %v", id, err)
+		}
+	}
+	if err := staging.RevokeSession(ctx, "s2", RevokeReasonLogout); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	keys := mr.Keys()
+	if len(keys) == 0 {
+		t.Fatal("no keys written")
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "staging:") {
+			t.Errorf("key %q is outside the staging namespace", key)
+		}
+	}
+	for _, want := range []string{"staging:" + sessionPrefix + "s1", "staging:" + userSessionsIdx + "user@example.com"} {
+		if !mr.Exists(want) {
+			t.Errorf("key %q does not exist, keys = %v", want, keys)
+		}
+	}
+
+	// Чтение идет по своему пространству имен
+	if _, err := staging.GetSession(ctx, "s1"); err != nil {
+		t.Errorf("GetSession in staging: %v", err)
+	}
+	if got, err := staging.GetSessionByRefreshToken(ctx, "refresh-s1"); err != nil || got.Id != "s1" {
+		t.Errorf("GetSessionByRefreshToken in staging = %v, %v, want s1", got, err)
+	}
+	if blacklisted, err := staging.IsTokenBlacklisted(ctx, "refresh-s2"); err != nil || !blacklisted {
+		t.Errorf("IsTokenBlacklisted in staging = %v, %v, want true", blacklisted, err)
+	}
+
+	if _, err := other.GetSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession in another namespace error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if blacklisted, err := other.IsTokenBlacklisted(ctx, "refresh-s2"); err != nil || blacklisted {
+		t.Errorf("IsTokenBlacklisted in another namespace = %v, %v, want false", blacklisted, err)
+	}
+	if sessions, err := other.GetSessionsByEmail(ctx, "user@example.com"); err != nil || len(sessions) != 0 {
+		t.Errorf("GetSessionsByEmail in another namespace = %v, %v, want none", sessions, err)
+	}
+}
+
+func TestSessionValidateExpiry(t *testing.T) {
+	now := newFakeClock().Now()
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		wantErr   bool
+	}{
+		{"missing", time.Time{}, true},
+		{"past", now.Add(-time.Second), true},
+		{"now", now, true},
+		{"future", now.Add(time.Hour), false},
+		{"max lifetime", now.Add(MaxSessionLifetime), false},
+		{"far future", now.Add(MaxSessionLifetime + time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Session{ExpiresAt: tt.expiresAt}).ValidateExpiry(now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidExpiry) {
+				t.Errorf("ValidateExpiry error = %v, want %v", err, ErrInvalidExpiry)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateExpiry: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SessionStats сводные счетчики сессий
+type SessionStats struct {
+	ActiveSessions int64     // Сумма размеров индексов пользователей
+	UniqueUsers    int64     // Пользователи хотя бы с одной сессией в индексе
+	SnapshotTime   time.Time // Момент подсчета
+}
+
+// SessionStats считает пользователей и сессии по индексам user_sessions, обходя их
+// курсором SCAN. Между очистками индексов в сумму могут попасть ID уже истекших
+// сессий, поэтому число сессий приблизительное. В кластере обходятся все мастера
+func (s *RedisStore) SessionStats(ctx context.Context) (*SessionStats, error) {
+	stats := &SessionStats{SnapshotTime: s.clock.Now().UTC()}
+	var mu sync.Mutex
+
+	cluster, ok := s.client.(*redis.ClusterClient)
+	if !ok {
+		return stats, s.statsNode(ctx, s.client, stats, &mu)
+	}
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return s.statsNode(ctx, node, stats, &mu)
+	})
+	return stats, err
+}
+
+// statsNode считает индексы на одном узле: размеры наборов из одной страницы SCAN
+// запрашиваются одним пайплайном. mu защищает stats
+func (s *RedisStore) statsNode(ctx context.Context, node redis.UniversalClient, stats *SessionStats, mu *sync.Mutex) error {
+	var cursor uint64
+	for {
+		stepCtx, cancel := s.opContext(ctx)
+		keys, next, err := node.Scan(stepCtx, cursor, s.keys.userSessions+"*", reapScanCount).Result()
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to scan user indexes: %w", err)
+		}
+
+		if len(keys) > 0 {
+			pipe := node.Pipeline()
+			cmds := make([]*redis.IntCmd, len(keys))
+			for i, key := range keys {
+				cmds[i] = pipe.SCard(stepCtx, key)
+			}
+
+			// Индекс мог истечь между SCAN и SCARD: тогда SCARD вернет 0
+			if _, err := pipe.Exec(stepCtx); err != nil {
+				cancel()
+				return fmt.Errorf("failed to count user sessions: %w", err)
+			}
+
+			mu.Lock()
+			for _, cmd := range cmds {
+				if n := cmd.Val(); n > 0 {
+					stats.UniqueUsers++
+					stats.ActiveSessions += n
+				}
+			}
+			mu.Unlock()
+		}
+		cancel()
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
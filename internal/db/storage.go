@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -10,39 +11,228 @@ import (
 // SessionStorage определяет интерфейс для работы с сессиями
 type SessionStorage interface {
 	CreateSession(ctx context.Context, session *Session) (*Session, error)
+	// BatchCreateSessions возвращает ошибку по каждой сессии, nil = создана
+	BatchCreateSessions(ctx context.Context, sessions []*Session) ([]error, error)
 	GetSession(ctx context.Context, id string) (*Session, error)
+	GetSessionByRefreshToken(ctx context.Context, token string) (*Session, error)
+	BatchGetSessions(ctx context.Context, ids []string) (map[string]*Session, error)
 	GetSessionsByEmail(ctx context.Context, email string) ([]*Session, error)
-	RevokeSession(ctx context.Context, id string) error
+	GetSessionsByEmailPaged(ctx context.Context, email, cursor string, limit int) ([]*Session, string, error)
+	CountActiveSessions(ctx context.Context, email string) (int64, error)
+	PruneUserIndex(ctx context.Context, email string) (int, error)
+	ReconcileUser(ctx context.Context, email string) (int, error)
+	ReapUserIndexes(ctx context.Context) (*ReapResult, error)
+	// SessionStats возвращает число активных сессий и пользователей с сессиями
+	SessionStats(ctx context.Context) (*SessionStats, error)
+	RevokeSession(ctx context.Context, id string, reason RevokeReason) error
+	RevokeAllUserSessions(ctx context.Context, email string, reason RevokeReason) (int, error)
+	// RevokeUserSessions отзывает сессии пользователя и возвращает их ID; dryRun = только список
+	RevokeUserSessions(ctx context.Context, email string, reason RevokeReason, dryRun bool) ([]string, error)
+	RotateRefreshToken(ctx context.Context, sessionID, newRefreshToken string) error
+	// RehashRefreshToken заменяет сырой refresh токен сессии, записанной до хеширования, его хешем
+	RehashRefreshToken(ctx context.Context, sessionID, token string) error
+	ExtendSession(ctx context.Context, id string, ttl time.Duration) error
+	UpdateSessionLabel(ctx context.Context, id, label string) error
 	DeleteSession(ctx context.Context, id string) error
 	IsTokenBlacklisted(ctx context.Context, token string) (bool, error)
+	// AllowSessionCreate учитывает создание сессии пользователем в скользящем окне;
+	// false = лимит исчерпан. limit <= 0 отключает ограничение
+	AllowSessionCreate(ctx context.Context, email string, limit int, window time.Duration) (bool, error)
+	// BlacklistToken вносит сырой refresh токен в черный список на ttl без поиска сессии
+	BlacklistToken(ctx context.Context, token string, ttl time.Duration) error
+	// AreTokensBlacklisted проверяет пачку сырых refresh токенов; ключ результата — токен
+	AreTokensBlacklisted(ctx context.Context, tokens []string) (map[string]bool, error)
+	// IsSessionValid проверяет сессию и черный список; reason — одна из SessionReason*
+	IsSessionValid(ctx context.Context, id string) (valid bool, reason string, err error)
+	PublishRevocation(ctx context.Context, event RevocationEvent) error
+	SubscribeRevocations(ctx context.Context) (<-chan RevocationEvent, error)
+	Probe(ctx context.Context) error
 	Close() error
 }
 
 // RedisStore реализует методы SessionStorage
 type RedisStore struct {
-	client *redis.Client
+	client             redis.UniversalClient
+	maxSessionsPerUser int // 0 = без ограничения
+	revocationChannel  string
+	opTimeout          time.Duration // 0 = без таймаута
+	blacklistRetention time.Duration // 0 = минута
+	codec              SessionCodec
+	keys               keySpace
+	clock              Clock
 }
 
-// GetClient возвращает Redis клиент (для health checks)
-func (s *RedisStore) GetClient() *redis.Client {
+// newRedisClient создает клиент под режим из конфигурации: *redis.ClusterClient
+// при заданных адресах кластера, иначе *redis.Client (одиночный узел или Sentinel)
+func newRedisClient(redisOpts *redis.Options, config Config) (redis.UniversalClient, error) {
+	switch {
+	case len(config.ClusterAddrs) > 0:
+		if len(config.SentinelAddrs) > 0 {
+			return nil, fmt.Errorf("cluster and sentinel addrs are mutually exclusive")
+		}
+		if redisOpts.DB != 0 {
+			return nil, fmt.Errorf("redis cluster supports only DB 0, got %d", redisOpts.DB)
+		}
+
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        config.ClusterAddrs,
+			Username:     redisOpts.Username,
+			Password:     redisOpts.Password,
+			PoolSize:     redisOpts.PoolSize,
+			MinIdleConns: redisOpts.MinIdleConns,
+			DialTimeout:  redisOpts.DialTimeout,
+		}), nil
+	case len(config.SentinelAddrs) > 0:
+		if config.SentinelMasterName == "" {
+			return nil, fmt.Errorf("sentinel master name is required when sentinel addrs are set")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    config.SentinelMasterName,
+			SentinelAddrs: config.SentinelAddrs,
+			Username:      redisOpts.Username,
+			Password:      redisOpts.Password,
+			DB:            redisOpts.DB,
+			PoolSize:      redisOpts.PoolSize,
+			MinIdleConns:  redisOpts.MinIdleConns,
+			DialTimeout:   redisOpts.DialTimeout,
+		}), nil
+	default:
+		return redis.NewClient(redisOpts), nil
+	}
+}
+
+// GetClient возвращает Redis клиент (для health checks): *redis.Client
+// для одиночного узла и Sentinel, *redis.ClusterClient для кластера
+func (s *RedisStore) GetClient() redis.UniversalClient {
 	return s.client
 }
 
 // NewRedisStore создает новое хранилище Redis
-func NewRedisStore(redisURL string, ctx context.Context) (*RedisStore, error) {
-	opts, err := redis.ParseURL(redisURL)
+func NewRedisStore(redisURL string, ctx context.Context, opts ...Option) (*RedisStore, error) {
+	// Применяем дефолтную конфигурацию
+	config := defaultConfig()
+
+	// Применяем все переданные опции
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	// URL нужен в обоих режимах: из него берутся пароль и номер БД
+	redisOpts, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
 	}
 
-	client := redis.NewClient(opts)
+	applyPoolConfig(redisOpts, config)
+
+	client, err := newRedisClient(redisOpts, config)
+	if err != nil {
+		return nil, err
+	}
 
 	// Проверка соединения с Redis
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
+	if err := waitForRedis(ctx, client, config); err != nil {
+		client.Close()
+		return nil, err
 	}
 
 	return &RedisStore{
-		client: client,
+		client:             client,
+		maxSessionsPerUser: config.MaxSessionsPerUser,
+		revocationChannel:  config.RevocationChannel,
+		opTimeout:          config.OpTimeout,
+		blacklistRetention: config.BlacklistRetention,
+		codec:              config.Codec,
+		keys:               newKeySpace(config.KeyNamespace),
+		clock:              config.Clock,
 	}, nil
 }
+
+// maxConnectRetryDelay верхняя граница задержки между попытками подключения
+const maxConnectRetryDelay = 30 * time.Second
+
+// waitForRedis пингует Redis, повторяя попытки с экспоненциальной задержкой.
+// Отмена ctx прерывает ожидание
+func waitForRedis(ctx context.Context, client redis.UniversalClient, config Config) error {
+	delay := config.ConnectRetryDelay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = client.Ping(ctx).Err(); err == nil {
+			return nil
+		}
+
+		if attempt >= config.ConnectAttempts {
+			return fmt.Errorf("failed to connect to Redis after %d attempts: %w", attempt, err)
+		}
+
+		if config.Logger != nil {
+			config.Logger.Warn("Redis is not available, retrying",
+				"attempt", attempt,
+				"max_attempts", config.ConnectAttempts,
+				"retry_in", delay,
+				"error", err,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect to Redis: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
+}
+
+// opContext ограничивает контекст операции таймаутом хранилища, если он задан
+func (s *RedisStore) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.opTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.opTimeout)
+}
+
+// mget читает значения ключей в порядке keys, nil = ключа нет. В кластере
+// MGET по ключам из разных слотов отклоняется, поэтому ключи читаются
+// конвейером GET, который клиент раскладывает по узлам
+func (s *RedisStore) mget(ctx context.Context, keys ...string) ([]interface{}, error) {
+	if _, ok := s.client.(*redis.ClusterClient); !ok {
+		return s.client.MGet(ctx, keys...).Result()
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if value, err := cmd.Result(); err == nil {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+// applyPoolConfig переносит заданные настройки пула в опции клиента
+func applyPoolConfig(opts *redis.Options, config Config) {
+	if config.PoolSize > 0 {
+		opts.PoolSize = config.PoolSize
+	}
+
+	if config.MinIdleConns > 0 {
+		opts.MinIdleConns = config.MinIdleConns
+	}
+
+	if config.DialTimeout > 0 {
+		opts.DialTimeout = config.DialTimeout
+	}
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNewRedisClient(t *testing.T) {
+	base := defaultConfig
+
+	tests := []struct {
+		name   string
+		url    string
+		config func() Config
+		want   string // Ожидаемый тип клиента, пусто = ошибка
+	}{
+		{"single node", "redis://localhost:6379/2", base, "*redis.Client"},
+		{"cluster", "redis://localhost:6379", func() Config {
+			config := base()
+			WithCluster("node-1:6379", "node-2:6379")(&config)
+			return config
+		}, "*redis.ClusterClient"},
+		{"sentinel", "redis://localhost:6379/1", func() Config {
+			config := base()
+			WithSentinel("mymaster", "sentinel-1:26379")(&config)
+			return config
+		}, "*redis.Client"},
+		{"cluster with DB", "redis://localhost:6379/3", func() Config {
+			config := base()
+			WithCluster("node-1:6379")(&config)
+			return config
+		}, ""},
+		{"cluster and sentinel", "redis://localhost:6379", func() Config {
+			config := base()
+			WithCluster("node-1:6379")(&config)
+			WithSentinel("mymaster", "sentinel-1:26379")(&config)
+			return config
+		}, ""},
+		{"sentinel without master", "redis://localhost:6379", func() Config {
+			config := base()
+			config.SentinelAddrs = []string{"sentinel-1:26379"}
+			return config
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisOpts, err := redis.ParseURL(tt.url)
+			if err != nil {
+				t.Fatalf("ParseURL: %v", err)
+			}
+
+			client, err := newRedisClient(redisOpts, tt.config())
+			if tt.want == "" {
+				if err == nil {
+					client.Close()
+					t.Fatal("newRedisClient accepted an invalid config")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRedisClient: %v", err)
+			}
+			defer client.Close()
+
+			if got := typeName(client); got != tt.want {
+				t.Errorf("client type = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func typeName(client redis.UniversalClient) string {
+	switch client.(type) {
+	case *redis.ClusterClient:
+		return "*redis.ClusterClient"
+	case *redis.Client:
+		return "*redis.Client"
+	default:
+		return "unknown"
+	}
+}
+
+// retryLogger считает предупреждения о повторных попытках подключения
+type retryLogger struct {
+	nopLogger
+	mu       sync.Mutex
+	attempts []interface{}
+}
+
+func (l *retryLogger) Warn(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "attempt" {
+			l.attempts = append(l.attempts, args[i+1])
+		}
+	}
+}
+
+// deadAddr возвращает адрес, на котором никто не слушает
+func deadAddr(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	return addr
+}
+
+func TestNewRedisStoreRetriesConnect(t *testing.T) {
+	log := &retryLogger{}
+
+	_, err := NewRedisStore("redis://"+deadAddr(t), context.Background(),
+		WithConnectRetry(3, time.Millisecond),
+		WithLogger(log),
+	)
+	if err == nil {
+		t.Fatal("NewRedisStore succeeded with a dead address")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("error = %v, want it to mention 3 attempts", err)
+	}
+	if fmt.Sprint(log.attempts) != "[1 2]" {
+		t.Errorf("retries logged for attempts %v, want [1 2] before the last attempt", log.attempts)
+	}
+}
+
+func TestNewRedisStoreRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewRedisStore("redis://"+deadAddr(t), ctx, WithConnectRetry(10, time.Second))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("NewRedisStore error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("NewRedisStore returned after %s, want it to stop with the context", elapsed)
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"time"
+
+	"github.com/rx3lixir/auth-service/pkg/logger"
+)
+
+// Config конфигурация для Redis хранилища
+type Config struct {
+	MaxSessionsPerUser int // 0 = без ограничения
+
+	SentinelMasterName string
+	SentinelAddrs      []string // Пусто = подключение к одиночному узлу
+
+	ClusterAddrs []string // Узлы Redis Cluster, пусто = не кластер
+
+	// Настройки пула соединений, 0 = значение go-redis по умолчанию
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+
+	RevocationChannel string // Канал Pub/Sub для событий отзыва сессий
+
+	OpTimeout time.Duration // Таймаут одной операции хранилища, 0 = без таймаута
+
+	BlacklistRetention time.Duration // Минимальное время хранения отозванного токена, 0 = минута
+
+	Codec SessionCodec // Формат записи сессий в Redis
+
+	KeyNamespace string // Префикс всех ключей для общего Redis, пусто = без префикса
+
+	Clock Clock // Источник времени для TTL и проверок истечения
+
+	// Повторы первичного подключения с экспоненциальной задержкой
+	ConnectAttempts   int           // Всего попыток, 1 = без повторов
+	ConnectRetryDelay time.Duration // Задержка перед первым повтором, удваивается
+
+	Logger logger.Logger // nil = попытки подключения не логируются
+}
+
+// Option функция для настройки Redis хранилища
+type Option func(*Config)
+
+// defaultConfig возвращает конфигурацию по умолчанию
+func defaultConfig() Config {
+	return Config{
+		MaxSessionsPerUser: 0,
+		SentinelAddrs:      []string{},
+		RevocationChannel:  "session_revocations",
+		ConnectAttempts:    1,
+		ConnectRetryDelay:  500 * time.Millisecond,
+		Codec:              JSONCodec{},
+		Clock:              SystemClock{},
+	}
+}
+
+// WithMaxSessionsPerUser ограничивает количество одновременных сессий пользователя.
+// При превышении лимита самая старая сессия удаляется
+func WithMaxSessionsPerUser(max int) Option {
+	return func(c *Config) {
+		c.MaxSessionsPerUser = max
+	}
+}
+
+// WithSentinel включает подключение к Redis через Sentinel.
+// Если список адресов пуст, используется одиночный узел из URL
+func WithSentinel(masterName string, addrs ...string) Option {
+	return func(c *Config) {
+		c.SentinelMasterName = masterName
+		c.SentinelAddrs = make([]string, len(addrs))
+		copy(c.SentinelAddrs, addrs)
+	}
+}
+
+// WithCluster включает подключение к Redis Cluster по списку начальных узлов.
+// Если список пуст, используется одиночный узел или Sentinel
+func WithCluster(addrs ...string) Option {
+	return func(c *Config) {
+		c.ClusterAddrs = make([]string, len(addrs))
+		copy(c.ClusterAddrs, addrs)
+	}
+}
+
+// WithPool устанавливает параметры пула соединений.
+// Нулевые значения оставляют настройки go-redis по умолчанию
+func WithPool(poolSize, minIdleConns int, dialTimeout time.Duration) Option {
+	return func(c *Config) {
+		c.PoolSize = poolSize
+		c.MinIdleConns = minIdleConns
+		c.DialTimeout = dialTimeout
+	}
+}
+
+// WithRevocationChannel устанавливает канал Pub/Sub для событий отзыва сессий
+func WithRevocationChannel(channel string) Option {
+	return func(c *Config) {
+		if channel != "" {
+			c.RevocationChannel = channel
+		}
+	}
+}
+
+// WithOpTimeout ограничивает время выполнения каждой операции хранилища,
+// чтобы зависший Redis не блокировал обработчики запросов
+func WithOpTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.OpTimeout = timeout
+	}
+}
+
+// WithBlacklistRetention задает минимальное время, которое отозванный или удаленный
+// refresh токен хранится в черном списке, даже если сессия уже истекла
+func WithBlacklistRetention(retention time.Duration) Option {
+	return func(c *Config) {
+		c.BlacklistRetention = retention
+	}
+}
+
+// WithCodec задает формат записи сессий. Сессии, записанные другим
+// встроенным кодеком, по-прежнему читаются
+func WithCodec(codec SessionCodec) Option {
+	return func(c *Config) {
+		if codec != nil {
+			c.Codec = codec
+		}
+	}
+}
+
+// WithKeyNamespace добавляет пространство имен ко всем ключам хранилища
+// ("<namespace>:session:..."), чтобы несколько экземпляров сервиса могли делить один Redis.
+// Смена пространства имен делает существующие сессии недоступными
+func WithKeyNamespace(namespace string) Option {
+	return func(c *Config) {
+		c.KeyNamespace = namespace
+	}
+}
+
+// WithClock подменяет источник времени хранилища, например в тестах TTL
+func WithClock(clock Clock) Option {
+	return func(c *Config) {
+		if clock != nil {
+			c.Clock = clock
+		}
+	}
+}
+
+// WithConnectRetry повторяет первичную проверку соединения до attempts раз,
+// начиная с задержки baseDelay и удваивая ее после каждой неудачи
+func WithConnectRetry(attempts int, baseDelay time.Duration) Option {
+	return func(c *Config) {
+		if attempts > 0 {
+			c.ConnectAttempts = attempts
+		}
+		if baseDelay > 0 {
+			c.ConnectRetryDelay = baseDelay
+		}
+	}
+}
+
+// WithLogger задает логгер для сообщений хранилища о подключении
+func WithLogger(log logger.Logger) Option {
+	return func(c *Config) {
+		c.Logger = log
+	}
+}
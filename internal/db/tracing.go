@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName имя трейсера для спанов хранилища
+const tracerName = "github.com/rx3lixir/auth-service/internal/db"
+
+// sessionIDKey атрибут спана с ID сессии. Токены в атрибуты не попадают никогда
+const sessionIDKey = attribute.Key("session.id")
+
+// TracedStore оборачивает SessionStorage и создает спан на каждую операцию.
+// Подписка на отзывы и проверка health не трассируются: первая живет
+// все время работы сервиса, вторая вызывается слишком часто
+type TracedStore struct {
+	SessionStorage
+	tracer trace.Tracer
+}
+
+var _ SessionStorage = (*TracedStore)(nil)
+
+// NewTracedStore создает трассирующую обертку над хранилищем.
+// Использует глобальный TracerProvider, поэтому без настроенного экспорта ничего не стоит
+func NewTracedStore(backend SessionStorage) *TracedStore {
+	return &TracedStore{
+		SessionStorage: backend,
+		tracer:         otel.Tracer(tracerName),
+	}
+}
+
+// start открывает спан операции хранилища
+func (s *TracedStore) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "SessionStorage."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// end закрывает спан, отмечая ошибку, если она есть
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *TracedStore) CreateSession(ctx context.Context, session *Session) (created *Session, err error) {
+	ctx, span := s.start(ctx, "CreateSession", sessionIDKey.String(session.Id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.CreateSession(ctx, session)
+}
+
+func (s *TracedStore) BatchCreateSessions(ctx context.Context, sessions []*Session) (itemErrs []error, err error) {
+	ctx, span := s.start(ctx, "BatchCreateSessions", attribute.Int("session.count", len(sessions)))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.BatchCreateSessions(ctx, sessions)
+}
+
+func (s *TracedStore) GetSession(ctx context.Context, id string) (session *Session, err error) {
+	ctx, span := s.start(ctx, "GetSession", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.GetSession(ctx, id)
+}
+
+func (s *TracedStore) GetSessionByRefreshToken(ctx context.Context, token string) (session *Session, err error) {
+	ctx, span := s.start(ctx, "GetSessionByRefreshToken")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.GetSessionByRefreshToken(ctx, token)
+}
+
+func (s *TracedStore) BatchGetSessions(ctx context.Context, ids []string) (sessions map[string]*Session, err error) {
+	ctx, span := s.start(ctx, "BatchGetSessions", attribute.Int("session.count", len(ids)))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.BatchGetSessions(ctx, ids)
+}
+
+func (s *TracedStore) GetSessionsByEmail(ctx context.Context, email string) (sessions []*Session, err error) {
+	ctx, span := s.start(ctx, "GetSessionsByEmail")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.GetSessionsByEmail(ctx, email)
+}
+
+func (s *TracedStore) GetSessionsByEmailPaged(ctx context.Context, email, cursor string, limit int) (sessions []*Session, next string, err error) {
+	ctx, span := s.start(ctx, "GetSessionsByEmailPaged", attribute.Int("page.limit", limit))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.GetSessionsByEmailPaged(ctx, email, cursor, limit)
+}
+
+func (s *TracedStore) CountActiveSessions(ctx context.Context, email string) (count int64, err error) {
+	ctx, span := s.start(ctx, "CountActiveSessions")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.CountActiveSessions(ctx, email)
+}
+
+func (s *TracedStore) PruneUserIndex(ctx context.Context, email string) (pruned int, err error) {
+	ctx, span := s.start(ctx, "PruneUserIndex")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.PruneUserIndex(ctx, email)
+}
+
+func (s *TracedStore) ReconcileUser(ctx context.Context, email string) (pruned int, err error) {
+	ctx, span := s.start(ctx, "ReconcileUser")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.ReconcileUser(ctx, email)
+}
+
+func (s *TracedStore) ReapUserIndexes(ctx context.Context) (result *ReapResult, err error) {
+	ctx, span := s.start(ctx, "ReapUserIndexes")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.ReapUserIndexes(ctx)
+}
+
+func (s *TracedStore) SessionStats(ctx context.Context) (stats *SessionStats, err error) {
+	ctx, span := s.start(ctx, "SessionStats")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.SessionStats(ctx)
+}
+
+func (s *TracedStore) RevokeSession(ctx context.Context, id string, reason RevokeReason) (err error) {
+	ctx, span := s.start(ctx, "RevokeSession", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.RevokeSession(ctx, id, reason)
+}
+
+func (s *TracedStore) RevokeAllUserSessions(ctx context.Context, email string, reason RevokeReason) (revoked int, err error) {
+	ctx, span := s.start(ctx, "RevokeAllUserSessions")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.RevokeAllUserSessions(ctx, email, reason)
+}
+
+func (s *TracedStore) RevokeUserSessions(ctx context.Context, email string, reason RevokeReason, dryRun bool) (ids []string, err error) {
+	ctx, span := s.start(ctx, "RevokeUserSessions", attribute.Bool("revoke.dry_run", dryRun))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.RevokeUserSessions(ctx, email, reason, dryRun)
+}
+
+func (s *TracedStore) RotateRefreshToken(ctx context.Context, sessionID, newRefreshToken string) (err error) {
+	ctx, span := s.start(ctx, "RotateRefreshToken", sessionIDKey.String(sessionID))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.RotateRefreshToken(ctx, sessionID, newRefreshToken)
+}
+
+func (s *TracedStore) RehashRefreshToken(ctx context.Context, sessionID, token string) (err error) {
+	ctx, span := s.start(ctx, "RehashRefreshToken", sessionIDKey.String(sessionID))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.RehashRefreshToken(ctx, sessionID, token)
+}
+
+func (s *TracedStore) ExtendSession(ctx context.Context, id string, ttl time.Duration) (err error) {
+	ctx, span := s.start(ctx, "ExtendSession", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.ExtendSession(ctx, id, ttl)
+}
+
+func (s *TracedStore) UpdateSessionLabel(ctx context.Context, id, label string) (err error) {
+	ctx, span := s.start(ctx, "UpdateSessionLabel", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.UpdateSessionLabel(ctx, id, label)
+}
+
+func (s *TracedStore) DeleteSession(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "DeleteSession", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.DeleteSession(ctx, id)
+}
+
+func (s *TracedStore) IsTokenBlacklisted(ctx context.Context, token string) (blacklisted bool, err error) {
+	ctx, span := s.start(ctx, "IsTokenBlacklisted")
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.IsTokenBlacklisted(ctx, token)
+}
+
+func (s *TracedStore) AllowSessionCreate(ctx context.Context, email string, limit int, window time.Duration) (allowed bool, err error) {
+	ctx, span := s.start(ctx, "AllowSessionCreate", attribute.Int("ratelimit.limit", limit))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.AllowSessionCreate(ctx, email, limit, window)
+}
+
+func (s *TracedStore) BlacklistToken(ctx context.Context, token string, ttl time.Duration) (err error) {
+	ctx, span := s.start(ctx, "BlacklistToken", attribute.Int64("blacklist.ttl_seconds", int64(ttl.Seconds())))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.BlacklistToken(ctx, token, ttl)
+}
+
+func (s *TracedStore) AreTokensBlacklisted(ctx context.Context, tokens []string) (blacklisted map[string]bool, err error) {
+	ctx, span := s.start(ctx, "AreTokensBlacklisted", attribute.Int("token.count", len(tokens)))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.AreTokensBlacklisted(ctx, tokens)
+}
+
+func (s *TracedStore) IsSessionValid(ctx context.Context, id string) (valid bool, reason string, err error) {
+	ctx, span := s.start(ctx, "IsSessionValid", sessionIDKey.String(id))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.IsSessionValid(ctx, id)
+}
+
+func (s *TracedStore) PublishRevocation(ctx context.Context, event RevocationEvent) (err error) {
+	ctx, span := s.start(ctx, "PublishRevocation", sessionIDKey.String(event.SessionId))
+	defer func() { end(span, err) }()
+
+	return s.SessionStorage.PublishRevocation(ctx, event)
+}
@@ -1,28 +1,145 @@
 package db
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
 	"time"
 )
 
 // Session представляет сессию пользователя
 type Session struct {
-	Id           string    // ID сессии
-	UserEmail    string    // Email пользователя
-	RefreshToken string    // Refresh токен
-	IsRevoked    bool      // Флаг отзыва сессии
-	CreatedAt    time.Time // Время создания сессии
-	ExpiresAt    time.Time // Время истечения сессии
+	Id             string            // ID сессии
+	UserEmail      string            // Email пользователя
+	RefreshToken   string            // SHA-256 хеш refresh токена; сырой токен есть только в ответе CreateSession
+	IsRevoked      bool              // Флаг отзыва сессии
+	RevokedReason  RevokeReason      // Причина отзыва, пусто для действующих сессий
+	CreatedAt      time.Time         // Время создания сессии
+	ExpiresAt      time.Time         // Время истечения сессии
+	LastAccessedAt time.Time         // Время последнего обращения к сессии
+	IPAddress      string            // IP адрес, с которого создана сессия
+	UserAgent      string            // User-Agent клиента
+	DeviceName     string            // Название устройства
+	Label          string            // Пользовательское название сессии ("Мой iPhone")
+	Metadata       map[string]string // Произвольный контекст вызывающего сервиса (tenant, роли)
+	Impersonated   bool              // Сессия создана администратором от имени пользователя
+	ImpersonatedBy string            // Email администратора для Impersonated сессий
+	IsAdmin        bool              // Права администратора на момент входа; переносятся в обновленные access токены
+}
+
+// normalizeTimes переводит время сессии в UTC, чтобы сохраненные данные
+// не зависели от часового пояса сервера
+func (s *Session) normalizeTimes() {
+	s.CreatedAt = s.CreatedAt.UTC()
+	s.ExpiresAt = s.ExpiresAt.UTC()
+	s.LastAccessedAt = s.LastAccessedAt.UTC()
+}
+
+// RevokeReason причина отзыва сессии
+type RevokeReason string
+
+// Причины отзыва сессии
+const (
+	RevokeReasonUnspecified    RevokeReason = "unspecified"
+	RevokeReasonLogout         RevokeReason = "logout"
+	RevokeReasonPasswordChange RevokeReason = "password_change"
+	RevokeReasonAdmin          RevokeReason = "admin"
+	RevokeReasonCompromised    RevokeReason = "compromised"
+)
+
+// orUnspecified заменяет пустую причину на RevokeReasonUnspecified
+func (r RevokeReason) orUnspecified() RevokeReason {
+	if r == "" {
+		return RevokeReasonUnspecified
+	}
+	return r
+}
+
+// MaxSessionLabelLength максимальная длина названия сессии в символах
+const MaxSessionLabelLength = 64
+
+// Ограничения на метаданные сессии; длины в байтах
+const (
+	MaxSessionMetadataKeys        = 16
+	MaxSessionMetadataKeyLength   = 64
+	MaxSessionMetadataValueLength = 256
+)
+
+// MaxSessionLifetime наибольшее допустимое время жизни сессии от момента проверки
+const MaxSessionLifetime = 90 * 24 * time.Hour
+
+// ValidateExpiry проверяет, что время истечения задано и лежит в пределах
+// (now, now+MaxSessionLifetime]. Ошибка оборачивает ErrInvalidExpiry
+func (s *Session) ValidateExpiry(now time.Time) error {
+	switch {
+	case s.ExpiresAt.IsZero():
+		return fmt.Errorf("%w: expiration time is required", ErrInvalidExpiry)
+	case !s.ExpiresAt.After(now):
+		return fmt.Errorf("%w: expiration time must be in the future", ErrInvalidExpiry)
+	case s.ExpiresAt.Sub(now) > MaxSessionLifetime:
+		return fmt.Errorf("%w: expiration time must be within %s", ErrInvalidExpiry, MaxSessionLifetime)
+	}
+	return nil
+}
+
+// RefreshTokenMatches сравнивает сырой refresh токен с хешем, сохраненным в сессии.
+// Сессии, записанные до хеширования, хранят сырой токен и сравниваются с ним напрямую
+func (s *Session) RefreshTokenMatches(token string) bool {
+	if s.HasLegacyRefreshToken() {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(s.RefreshToken)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(refreshTokenHash(token)), []byte(s.RefreshToken)) == 1
+}
+
+// HasLegacyRefreshToken сообщает, что сессия записана до хеширования refresh токенов
+// и хранит сырой токен. Такой токен перехешируется при первом обновлении access токена
+func (s *Session) HasLegacyRefreshToken() bool {
+	return s.RefreshToken != "" && !isRefreshTokenHash(s.RefreshToken)
+}
+
+// isRefreshTokenHash сообщает, похоже ли значение на результат refreshTokenHash.
+// Сырые токены сервиса — base64 и в такой вид не попадают
+func isRefreshTokenHash(value string) bool {
+	if len(value) != 2*sha256.Size {
+		return false
+	}
+
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshTokenHash возвращает SHA-256 хеш refresh токена в hex.
+// В хранилище и черном списке лежат только хеши, чтобы дамп Redis не раскрывал токены
+func refreshTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RevocationEvent событие отзыва или удаления сессии, публикуемое в Redis Pub/Sub
+type RevocationEvent struct {
+	SessionId    string `json:"session_id"`    // ID сессии (пусто при отзыве всех сессий пользователя)
+	UserEmail    string `json:"user_email"`    // Email пользователя
+	RefreshToken string `json:"refresh_token"` // Хеш отозванного refresh токена
+	Reason       string `json:"reason"`        // Причина: revoke, delete, revoke_all
 }
 
 // RenewAccessTokenReq запрос на обновление access токена
 type RenewAccessTokenReq struct {
-	RefreshToken string `json:"refresh_token"` // Refresh токен
+	SessionId          string `json:"session_id"`           // ID сессии
+	RefreshToken       string `json:"refresh_token"`        // Refresh токен
+	RotateRefreshToken bool   `json:"rotate_refresh_token"` // Выпустить новый refresh токен
 }
 
 // RenewAccessTokenRes ответ с новым access токеном
 type RenewAccessTokenRes struct {
 	AccessToken          string    `json:"access_token"`            // Новый access токен
 	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"` // Время истечения токена
+	RefreshToken         string    `json:"refresh_token,omitempty"` // Новый refresh токен (при ротации)
 }
 
 // LoginUserReq запрос на аутентификацию пользователя
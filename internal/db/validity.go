@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Причины, которые возвращает IsSessionValid
+const (
+	SessionReasonValid    = "valid"
+	SessionReasonNotFound = "not_found"
+	SessionReasonRevoked  = "revoked"
+	SessionReasonExpired  = "expired"
+)
+
+// sessionValidityScript читает сессию и проверяет ее refresh токен в черном
+// списке за один вызов. Возвращает {данные сессии, 1|0} или пустой ответ,
+// если сессии нет. Сжатую сессию Lua разобрать не может: тогда вместо флага
+// возвращается -1. KEYS[1] — ключ сессии, ARGV[1] — префикс черного списка
+var sessionValidityScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return {}
+end
+if string.sub(data, 1, 1) ~= '{' then
+	return {data, -1}
+end
+local session = cjson.decode(data)
+local blacklisted = redis.call('EXISTS', ARGV[1] .. session['RefreshToken'])
+return {data, blacklisted}
+`)
+
+// IsSessionValid сообщает, действительна ли сессия прямо сейчас, и причину отказа:
+// SessionReasonNotFound, SessionReasonRevoked или SessionReasonExpired.
+// Ключ черного списка вычисляется из сессии, поэтому в кластере, где скрипт
+// не может обращаться к ключам других слотов, проверка идет двумя запросами
+func (s *RedisStore) IsSessionValid(ctx context.Context, id string) (bool, string, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if id == "" {
+		return false, "", fmt.Errorf("session ID is required")
+	}
+
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		return s.isSessionValidCluster(ctx, id)
+	}
+
+	result, err := sessionValidityScript.Run(ctx, s.client, []string{s.keys.session + id}, s.keys.blacklist).Slice()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check session validity: %w", err)
+	}
+
+	if len(result) == 0 {
+		return false, SessionReasonNotFound, nil
+	}
+
+	data, _ := result[0].(string)
+	blacklisted, _ := result[1].(int64)
+
+	var session Session
+	if err := s.codec.Unmarshal([]byte(data), &session); err != nil {
+		return false, "", fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+
+	// Сессия записана не в JSON: черный список проверяем отдельным запросом
+	if blacklisted < 0 {
+		if blacklisted, err = s.client.Exists(ctx, s.keys.blacklist+session.RefreshToken).Result(); err != nil {
+			return false, "", fmt.Errorf("failed to check if token is blacklisted: %w", err)
+		}
+	}
+
+	reason := sessionValidity(&session, blacklisted == 1, s.clock.Now())
+	return reason == SessionReasonValid, reason, nil
+}
+
+// isSessionValidCluster вариант IsSessionValid без скрипта для Redis Cluster
+func (s *RedisStore) isSessionValidCluster(ctx context.Context, id string) (bool, string, error) {
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return false, SessionReasonNotFound, nil
+		}
+		return false, "", err
+	}
+
+	blacklisted, err := s.client.Exists(ctx, s.keys.blacklist+session.RefreshToken).Result()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check if token is blacklisted: %w", err)
+	}
+
+	reason := sessionValidity(session, blacklisted == 1, s.clock.Now())
+	return reason == SessionReasonValid, reason, nil
+}
+
+// sessionValidity определяет причину недействительности сессии.
+// Отзыв важнее истечения: клиенту полезнее знать, что сессию закрыли
+func sessionValidity(session *Session, blacklisted bool, now time.Time) string {
+	switch {
+	case session.IsRevoked || blacklisted:
+		return SessionReasonRevoked
+	case !now.Before(session.ExpiresAt):
+		return SessionReasonExpired
+	default:
+		return SessionReasonValid
+	}
+}
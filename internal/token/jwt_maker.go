@@ -0,0 +1,322 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinSecretKeySize минимальная длина секретного ключа для HMAC подписи в байтах
+const MinSecretKeySize = 32
+
+// jwtClaims набор claims, который кладется в JWT
+type jwtClaims struct {
+	Email   string `json:"email"`
+	IsAdmin bool   `json:"is_admin"`
+	SID     string `json:"sid,omitempty"` // ID сессии
+	jwt.RegisteredClaims
+}
+
+// JWTMaker реализует Maker на основе JWT, подписанных HMAC-SHA256.
+// Токены подписываются текущим ключом, его ID пишется в заголовок kid.
+// Проверка принимает и ранее использованные ключи, пока они не удалены
+type JWTMaker struct {
+	mu         sync.RWMutex
+	primaryKID string
+	keys       map[string][]byte // kid -> ключ, включая текущий
+	closed     bool
+
+	issuer   string   // Claim iss, пусто = не пишется и не проверяется
+	audience []string // Claim aud, пусто = не пишется и не проверяется
+	clock    Clock    // Время выпуска и проверки срока токенов
+}
+
+// Clock источник текущего времени для JWTMaker. Подменяется в тестах,
+// чтобы проверять истечение токенов без ожидания
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock системные часы (по умолчанию)
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// MakerOption функция для настройки JWTMaker
+type MakerOption func(*makerConfig)
+
+// makerConfig настройки JWTMaker
+type makerConfig struct {
+	previousKeys []string
+	issuer       string
+	audience     []string
+	clock        Clock
+}
+
+// WithPreviousKeys добавляет ключи, которыми подписаны еще действующие токены;
+// они используются только для проверки
+func WithPreviousKeys(keys ...string) MakerOption {
+	return func(c *makerConfig) {
+		c.previousKeys = append(c.previousKeys, keys...)
+	}
+}
+
+// WithIssuer пишет issuer в claim iss новых токенов и требует его при проверке
+func WithIssuer(issuer string) MakerOption {
+	return func(c *makerConfig) {
+		c.issuer = issuer
+	}
+}
+
+// WithAudience пишет audience в claim aud новых токенов. При проверке токен
+// принимается, только если его aud содержит хотя бы одно значение из audience.
+// Пустой список отключает проверку
+func WithAudience(audience ...string) MakerOption {
+	return func(c *makerConfig) {
+		c.audience = append([]string(nil), audience...)
+	}
+}
+
+// WithClock задает источник времени для выпуска и проверки токенов
+func WithClock(clock Clock) MakerOption {
+	return func(c *makerConfig) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
+}
+
+// NewJWTMaker создает новый JWTMaker с ключом подписи secretKey
+func NewJWTMaker(secretKey string, opts ...MakerOption) (Maker, error) {
+	config := makerConfig{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if err := checkKeySize([]byte(secretKey)); err != nil {
+		return nil, err
+	}
+
+	m := &JWTMaker{
+		keys:     make(map[string][]byte, len(config.previousKeys)+1),
+		issuer:   config.issuer,
+		audience: config.audience,
+		clock:    config.clock,
+	}
+
+	for _, key := range config.previousKeys {
+		if err := checkKeySize([]byte(key)); err != nil {
+			return nil, err
+		}
+		m.keys[KeyID([]byte(key))] = []byte(key)
+	}
+
+	m.primaryKID = KeyID([]byte(secretKey))
+	m.keys[m.primaryKID] = []byte(secretKey)
+
+	return m, nil
+}
+
+// KeyID возвращает ID ключа для заголовка kid. ID детерминирован,
+// поэтому все реплики сервиса с одним ключом выдают одинаковый kid
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkKeySize проверяет, что ключ достаточно длинный для HMAC
+func checkKeySize(key []byte) error {
+	if len(key) < MinSecretKeySize {
+		return fmt.Errorf("invalid key size: must be at least %d bytes", MinSecretKeySize)
+	}
+	return nil
+}
+
+// CreateToken создает новый подписанный токен для сессии пользователя
+func (m *JWTMaker) CreateToken(email string, isAdmin bool, sessionID string, ttl time.Duration) (string, *Payload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return "", nil, ErrMakerClosed
+	}
+
+	payload := NewPayload(email, isAdmin, sessionID, m.clock.Now(), ttl)
+	payload.Issuer = m.issuer
+	payload.Audience = m.audience
+
+	claims := jwtClaims{
+		Email:   payload.Email,
+		IsAdmin: payload.IsAdmin,
+		SID:     payload.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   payload.Email,
+			Issuer:    payload.Issuer,
+			Audience:  jwt.ClaimStrings(payload.Audience),
+			IssuedAt:  jwt.NewNumericDate(payload.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(payload.ExpiresAt),
+		},
+	}
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	jwtToken.Header["kid"] = m.primaryKID
+
+	token, err := jwtToken.SignedString(m.keys[m.primaryKID])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return token, payload, nil
+}
+
+// VerifyToken проверяет подпись и срок действия токена.
+// Токены без kid проверяются текущим ключом
+func (m *JWTMaker) VerifyToken(token string) (*Payload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrMakerClosed
+	}
+
+	keyFunc := func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = m.primaryKID
+		}
+
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.clock.Now),
+	}
+	if m.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(m.issuer))
+	}
+
+	var claims jwtClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, keyFunc, parserOpts...); err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if !m.audienceMatches(claims.Audience) {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{
+		Email:     claims.Email,
+		IsAdmin:   claims.IsAdmin,
+		SessionID: claims.SID,
+		Issuer:    claims.Issuer,
+		Audience:  []string(claims.Audience),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if claims.IssuedAt != nil {
+		payload.IssuedAt = claims.IssuedAt.Time
+	}
+
+	return payload, nil
+}
+
+// audienceMatches сообщает, предназначен ли токен с claim aud этому сервису.
+// jwt.WithAudience принимает только одно значение, поэтому список сверяется вручную
+func (m *JWTMaker) audienceMatches(aud jwt.ClaimStrings) bool {
+	if len(m.audience) == 0 {
+		return true
+	}
+
+	for _, want := range m.audience {
+		if slices.Contains(aud, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateKey делает newKey ключом подписи новых токенов
+func (m *JWTMaker) RotateKey(newKey []byte) error {
+	if err := checkKeySize(newKey); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrMakerClosed
+	}
+
+	// Копируем ключ, чтобы вызывающий код не мог изменить его снаружи
+	key := make([]byte, len(newKey))
+	copy(key, newKey)
+
+	m.primaryKID = KeyID(key)
+	m.keys[m.primaryKID] = key
+
+	return nil
+}
+
+// RemoveKey удаляет ключ проверки. Текущий ключ подписи удалить нельзя
+func (m *JWTMaker) RemoveKey(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrMakerClosed
+	}
+
+	if kid == m.primaryKID {
+		return fmt.Errorf("cannot remove current signing key %s", kid)
+	}
+
+	if _, ok := m.keys[kid]; !ok {
+		return fmt.Errorf("unknown key id %s", kid)
+	}
+
+	clear(m.keys[kid])
+	delete(m.keys, kid)
+
+	return nil
+}
+
+// Close затирает ключи в памяти. Повторный вызов безопасен
+func (m *JWTMaker) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+
+	for kid, key := range m.keys {
+		clear(key)
+		delete(m.keys, kid)
+	}
+	m.primaryKID = ""
+	m.closed = true
+
+	return nil
+}
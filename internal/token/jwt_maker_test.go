@@ -0,0 +1,256 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testKey      = "36080001349340267925113477454910"
+	otherTestKey = "98765432109876543210987654321098"
+)
+
+func newTestMaker(t *testing.T, key string, opts ...MakerOption) Maker {
+	t.Helper()
+
+	maker, err := NewJWTMaker(key, opts...)
+	if err != nil {
+		t.Fatalf("NewJWTMaker: %v", err)
+	}
+	t.Cleanup(func() { maker.Close() })
+	return maker
+}
+
+// testClaims claims валидного токена, подписанного не тем алгоритмом
+func testClaims() jwtClaims {
+	now := time.Now()
+	return jwtClaims{
+		Email: "user@example.com",
+		SID:   "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user@example.com",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func TestNewJWTMakerRejectsShortKey(t *testing.T) {
+	if _, err := NewJWTMaker("short"); err == nil {
+		t.Fatal("NewJWTMaker accepted a short key")
+	}
+	if _, err := NewJWTMaker(testKey, WithPreviousKeys("short")); err == nil {
+		t.Fatal("NewJWTMaker accepted a short previous key")
+	}
+}
+
+func TestJWTMakerRoundTrip(t *testing.T) {
+	maker := newTestMaker(t, testKey)
+
+	tok, issued, err := maker.CreateToken("user@example.com", true, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	payload, err := maker.VerifyToken(tok)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+
+	if payload.Email != "user@example.com" || !payload.IsAdmin || payload.SessionID != "session-1" {
+		t.Errorf("payload = %+v, want user@example.com, admin, session-1", payload)
+	}
+	if !payload.ExpiresAt.Equal(issued.ExpiresAt.Truncate(time.Second)) {
+		t.Errorf("expires_at = %s, want %s", payload.ExpiresAt, issued.ExpiresAt)
+	}
+}
+
+func TestJWTMakerRejects(t *testing.T) {
+	maker := newTestMaker(t, testKey)
+
+	expired, _, err := maker.CreateToken("user@example.com", false, "session-1", -time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	foreign, _, err := newTestMaker(t, otherTestKey).CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	valid, _, err := maker.CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	tampered := valid[:len(valid)-2] + "xx"
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("sign none: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	rs256, err := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims()).SignedString(rsaKey)
+	if err != nil {
+		t.Fatalf("sign RS256: %v", err)
+	}
+
+	// HS512 тем же ключом: подпись верна, но алгоритм не разрешен
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims()).SignedString([]byte(testKey))
+	if err != nil {
+		t.Fatalf("sign HS512: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", expired, ErrExpiredToken},
+		{"signed with another key", foreign, ErrInvalidToken},
+		{"tampered signature", tampered, ErrInvalidToken},
+		{"alg none", none, ErrInvalidToken},
+		{"alg RS256", rs256, ErrInvalidToken},
+		{"alg HS512", hs512, ErrInvalidToken},
+		{"malformed", "not-a-jwt", ErrInvalidToken},
+		{"empty", "", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := maker.VerifyToken(tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyToken error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTMakerKeyRotation(t *testing.T) {
+	maker := newTestMaker(t, testKey)
+
+	old, _, err := maker.CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	if err := maker.RotateKey([]byte(otherTestKey)); err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+
+	if _, err := maker.VerifyToken(old); err != nil {
+		t.Fatalf("token signed with the previous key rejected: %v", err)
+	}
+
+	if err := maker.RemoveKey(KeyID([]byte(testKey))); err != nil {
+		t.Fatalf("RemoveKey: %v", err)
+	}
+
+	if _, err := maker.VerifyToken(old); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyToken after RemoveKey error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestJWTMakerClosed(t *testing.T) {
+	maker := newTestMaker(t, testKey)
+	if err := maker.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, _, err := maker.CreateToken("user@example.com", false, "session-1", time.Minute); !errors.Is(err, ErrMakerClosed) {
+		t.Fatalf("CreateToken after Close error = %v, want %v", err, ErrMakerClosed)
+	}
+}
+
+// fakeClock управляемые часы для проверки истечения токенов
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestJWTMakerUsesClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	maker := newTestMaker(t, testKey, WithClock(clock))
+
+	tok, payload, err := maker.CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if !payload.IssuedAt.Equal(clock.now) || !payload.ExpiresAt.Equal(clock.now.Add(time.Minute)) {
+		t.Errorf("payload issued %s expires %s, want %s and %s", payload.IssuedAt, payload.ExpiresAt, clock.now, clock.now.Add(time.Minute))
+	}
+
+	clock.now = clock.now.Add(59 * time.Second)
+	if _, err := maker.VerifyToken(tok); err != nil {
+		t.Fatalf("VerifyToken before expiry: %v", err)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if _, err := maker.VerifyToken(tok); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("VerifyToken at expiry error = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestJWTMakerIssuerAndAudience(t *testing.T) {
+	issuer := newTestMaker(t, testKey, WithIssuer("auth-service"), WithAudience("gateway", "billing"))
+
+	tok, issued, err := issuer.CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if issued.Issuer != "auth-service" || !slices.Equal(issued.Audience, []string{"gateway", "billing"}) {
+		t.Errorf("issued payload iss = %q, aud = %v, want auth-service, [gateway billing]", issued.Issuer, issued.Audience)
+	}
+
+	// В самом JWT стандартные claims iss и aud
+	var raw jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tok, &raw); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if raw.Issuer != "auth-service" || !slices.Equal([]string(raw.Audience), []string{"gateway", "billing"}) {
+		t.Errorf("claims iss = %q, aud = %v, want auth-service, [gateway billing]", raw.Issuer, raw.Audience)
+	}
+
+	payload, err := issuer.VerifyToken(tok)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if payload.Issuer != "auth-service" || !slices.Equal(payload.Audience, []string{"gateway", "billing"}) {
+		t.Errorf("verified payload iss = %q, aud = %v, want auth-service, [gateway billing]", payload.Issuer, payload.Audience)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []MakerOption
+		wantErr error
+	}{
+		{"one of the audiences", []MakerOption{WithAudience("billing")}, nil},
+		{"no audience check", nil, nil},
+		{"mismatched audience", []MakerOption{WithAudience("reports")}, ErrInvalidToken},
+		{"mismatched issuer", []MakerOption{WithIssuer("other-service")}, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newTestMaker(t, testKey, tt.opts...)
+			if _, err := verifier.VerifyToken(tok); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyToken error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Токен без aud не проходит проверку сервиса, которому aud нужен
+	plain, _, err := newTestMaker(t, testKey).CreateToken("user@example.com", false, "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if _, err := newTestMaker(t, testKey, WithAudience("gateway")).VerifyToken(plain); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken of a token without aud error = %v, want %v", err, ErrInvalidToken)
+	}
+}
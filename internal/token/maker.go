@@ -0,0 +1,30 @@
+package token
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidToken возвращается, если токен поврежден или подпись не совпадает
+	ErrInvalidToken = errors.New("token is invalid")
+	// ErrExpiredToken возвращается, если срок действия токена истек
+	ErrExpiredToken = errors.New("token has expired")
+	// ErrMakerClosed возвращается после вызова Close
+	ErrMakerClosed = errors.New("token maker is closed")
+)
+
+// Maker определяет интерфейс для выпуска и проверки access токенов
+type Maker interface {
+	// CreateToken создает новый токен для сессии пользователя с указанным временем жизни
+	CreateToken(email string, isAdmin bool, sessionID string, ttl time.Duration) (string, *Payload, error)
+	// VerifyToken проверяет токен и возвращает его payload
+	VerifyToken(token string) (*Payload, error)
+	// RotateKey делает newKey ключом подписи. Прежний ключ остается
+	// доступным для проверки, пока не будет удален через RemoveKey
+	RotateKey(newKey []byte) error
+	// RemoveKey удаляет выведенный из оборота ключ проверки по его ID
+	RemoveKey(kid string) error
+	// Close стирает ключи, после чего выпуск и проверка токенов невозможны
+	Close() error
+}
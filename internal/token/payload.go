@@ -0,0 +1,27 @@
+package token
+
+import (
+	"time"
+)
+
+// Payload содержит данные, зашитые в access токен
+type Payload struct {
+	Email     string    `json:"email"`      // Email пользователя
+	IsAdmin   bool      `json:"is_admin"`   // Флаг администратора
+	SessionID string    `json:"session_id"` // ID сессии, для которой выпущен токен
+	Issuer    string    `json:"issuer"`     // Кто выпустил токен (iss), пусто = не задан
+	Audience  []string  `json:"audience"`   // Для кого выпущен токен (aud)
+	IssuedAt  time.Time `json:"issued_at"`  // Время выпуска токена
+	ExpiresAt time.Time `json:"expires_at"` // Время истечения токена
+}
+
+// NewPayload создает новый payload для указанного пользователя, выпущенный в момент now
+func NewPayload(email string, isAdmin bool, sessionID string, now time.Time, ttl time.Duration) *Payload {
+	return &Payload{
+		Email:     email,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
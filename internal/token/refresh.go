@@ -0,0 +1,20 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// refreshTokenSize размер refresh токена в байтах (256 бит)
+const refreshTokenSize = 32
+
+// NewRefreshToken генерирует криптографически случайный refresh токен
+func NewRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
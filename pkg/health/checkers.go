@@ -2,68 +2,294 @@ package health
 
 import (
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// RedisClient команды Redis, нужные RedisChecker (реализуется любым redis.UniversalClient)
+type RedisClient interface {
+	Ping(ctx context.Context) *redis.StatusCmd
+	Info(ctx context.Context, section ...string) *redis.StringCmd
+}
+
+// RedisCheckOption функция для настройки RedisChecker
+type RedisCheckOption func(*redisCheckConfig)
+
+// redisCheckConfig настройки RedisChecker
+type redisCheckConfig struct {
+	requireWritable bool
+}
+
+// RequireWritable помечает проверку DOWN, если Redis — реплика, доступная только для чтения.
+// Без опции роль реплики только отражается в деталях
+func RequireWritable() RedisCheckOption {
+	return func(c *redisCheckConfig) {
+		c.requireWritable = true
+	}
+}
+
 // RedisChecker проверка Redis
-func RedisChecker(client *redis.Client) Checker {
-	return CheckerFunc(func(ctx context.Context) CheckResult {
-		start := time.Now()
+func RedisChecker(client RedisClient, opts ...RedisCheckOption) Checker {
+	var config redisCheckConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
 
+	return CheckerFunc(func(ctx context.Context) CheckResult {
 		// Пингуем Redis
-		_, err := client.Ping(ctx).Result()
-		duration := time.Since(start)
+		if _, err := client.Ping(ctx).Result(); err != nil {
+			return CheckResult{
+				Status: StatusDown,
+				Error:  err.Error(),
+			}
+		}
+
+		details := map[string]any{}
+
+		// Получаем информацию о сервере. Пинг уже прошел, поэтому ошибка INFO
+		// не делает Redis недоступным — просто не добавляем детали
+		if info, err := client.Info(ctx, "server").Result(); err == nil {
+			fields := parseRedisInfo(info)
+			if version, ok := fields["redis_version"]; ok {
+				details["redis_version"] = version
+			}
+			if uptime, err := strconv.ParseInt(fields["uptime_in_seconds"], 10, 64); err == nil {
+				details["uptime_in_seconds"] = uptime
+			}
+		}
+
+		if info, err := client.Info(ctx, "clients").Result(); err == nil {
+			fields := parseRedisInfo(info)
+			if clients, err := strconv.ParseInt(fields["connected_clients"], 10, 64); err == nil {
+				details["connected_clients"] = clients
+			}
+		}
+
+		result := CheckResult{
+			Status:  StatusUp,
+			Details: details,
+		}
+
+		// Реплика отвечает на пинг, но запись на нее завершится ошибкой
+		if info, err := client.Info(ctx, "replication").Result(); err == nil {
+			role := parseRedisInfo(info)["role"]
+			if role != "" {
+				details["role"] = role
+			}
 
+			if role == "slave" || role == "replica" {
+				details["read_only"] = true
+				if config.requireWritable {
+					result.Status = StatusDown
+					result.Error = "redis is a read-only replica"
+				}
+			}
+		}
+
+		return result
+	})
+}
+
+// RedisMemoryChecker проверка нехватки памяти Redis. При заполнении maxmemory Redis
+// начинает вытеснять ключи (в том числе сессии) без ошибок для клиента, поэтому
+// проверка падает заранее, когда used_memory превышает maxUsagePercent от maxmemory.
+// maxmemory = 0 (без лимита) проверку не проваливает
+func RedisMemoryChecker(client RedisClient, maxUsagePercent float64) Checker {
+	return CheckerFunc(func(ctx context.Context) CheckResult {
+		info, err := client.Info(ctx, "memory").Result()
 		if err != nil {
 			return CheckResult{
 				Status: StatusDown,
 				Error:  err.Error(),
-				Details: map[string]any{
-					"duration_ms": duration.Milliseconds(),
-				},
 			}
 		}
 
-		// Получаем информацию о сервере
-		info, _ := client.Info(ctx, "server").Result()
+		fields := parseRedisInfo(info)
+		used, err := strconv.ParseUint(fields["used_memory"], 10, 64)
+		if err != nil {
+			return CheckResult{
+				Status: StatusDown,
+				Error:  "used_memory is missing in redis INFO memory",
+			}
+		}
+
+		// Старые версии Redis не отдают maxmemory в INFO: считаем лимит отсутствующим
+		limit, _ := strconv.ParseUint(fields["maxmemory"], 10, 64)
+
+		details := map[string]any{
+			"used_memory":       used,
+			"maxmemory":         limit,
+			"max_usage_percent": maxUsagePercent,
+		}
+		if policy, ok := fields["maxmemory_policy"]; ok {
+			details["maxmemory_policy"] = policy
+		}
+
+		result := CheckResult{
+			Status:  StatusUp,
+			Details: details,
+		}
+
+		if limit == 0 {
+			details["note"] = "maxmemory is not set"
+			return result
+		}
+
+		usagePercent := float64(used) / float64(limit) * 100
+		details["usage_percent"] = usagePercent
+
+		if usagePercent > maxUsagePercent {
+			result.Status = StatusDown
+			result.Error = fmt.Sprintf("redis memory usage %.2f%% exceeds %.2f%%", usagePercent, maxUsagePercent)
+		}
+
+		return result
+	})
+}
+
+// SessionStore хранилище сессий, умеющее проверить свою работоспособность
+// (реализуется db.SessionStorage)
+type SessionStore interface {
+	Probe(ctx context.Context) error
+}
+
+// SessionStoreChecker проверка хранилища сессий полным циклом запись/чтение/удаление.
+// В отличие от пинга, выявляет read-only реплики и нехватку памяти
+func SessionStoreChecker(store SessionStore) Checker {
+	return CheckerFunc(func(ctx context.Context) CheckResult {
+		if err := store.Probe(ctx); err != nil {
+			return CheckResult{
+				Status: StatusDown,
+				Error:  err.Error(),
+			}
+		}
 
 		return CheckResult{
 			Status: StatusUp,
-			Details: map[string]any{
-				"duration_ms": duration.Milliseconds(),
-				"info":        info, // можно парсить info для деталей
-			},
 		}
 	})
 }
 
+// parseRedisInfo разбирает вывод команды INFO в мапу "поле -> значение".
+// Строки-заголовки секций ("# Server") и пустые строки пропускаются
+func parseRedisInfo(info string) map[string]string {
+	fields := make(map[string]string)
+
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields[key] = value
+	}
+
+	return fields
+}
+
+// errDiskCheckUnsupported возвращается, если проверка диска не реализована для ОС
+var errDiskCheckUnsupported = errors.New("disk check is not supported on this OS")
+
 // DiskSpaceChecker проверка свободного места на диске
 func DiskSpaceChecker(path string, minFreeBytes uint64) Checker {
 	return CheckerFunc(func(ctx context.Context) CheckResult {
-		// Для Linux/Unix систем
-		// В продакшене лучше использовать библиотеку типа github.com/shirou/gopsutil
-		return CheckResult{
+		free, total, err := diskUsage(path)
+		if errors.Is(err, errDiskCheckUnsupported) {
+			// Не блокируем сервис на ОС, где проверка невозможна
+			return CheckResult{
+				Status: StatusUp,
+				Details: map[string]any{
+					"path": path,
+					"note": err.Error(),
+				},
+			}
+		}
+
+		if err != nil {
+			return CheckResult{
+				Status: StatusDown,
+				Error:  err.Error(),
+				Details: map[string]any{
+					"path": path,
+				},
+			}
+		}
+
+		var usedPercent float64
+		if total > 0 {
+			usedPercent = float64(total-free) / float64(total) * 100
+		}
+
+		result := CheckResult{
 			Status: StatusUp,
 			Details: map[string]any{
-				"path": path,
-				"note": "implement disk check based on OS",
+				"path":           path,
+				"free_bytes":     free,
+				"total_bytes":    total,
+				"used_percent":   usedPercent,
+				"min_free_bytes": minFreeBytes,
 			},
 		}
+
+		if free < minFreeBytes {
+			result.Status = StatusDown
+			result.Error = fmt.Sprintf("free space %d bytes is below %d bytes", free, minFreeBytes)
+		}
+
+		return result
 	})
 }
 
-// MemoryChecker проверка использования памяти
-func MemoryChecker(maxUsagePercent float64) Checker {
+// MemoryChecker проверка использования памяти.
+// Доля heap считается от limitBytes; если limitBytes = 0, используется GOMEMLIMIT,
+// а при его отсутствии — объем памяти, полученный процессом от ОС
+func MemoryChecker(limitBytes uint64, maxUsagePercent float64) Checker {
 	return CheckerFunc(func(ctx context.Context) CheckResult {
-		// В продакшене использовать runtime.MemStats или gopsutil
-		return CheckResult{
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		ceiling := limitBytes
+		if ceiling == 0 {
+			if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+				ceiling = uint64(limit)
+			} else {
+				ceiling = m.Sys
+			}
+		}
+
+		var usagePercent float64
+		if ceiling > 0 {
+			usagePercent = float64(m.HeapAlloc) / float64(ceiling) * 100
+		}
+
+		result := CheckResult{
 			Status: StatusUp,
 			Details: map[string]any{
+				"alloc_bytes":       m.HeapAlloc,
+				"sys_bytes":         m.Sys,
+				"num_gc":            m.NumGC,
+				"limit_bytes":       ceiling,
+				"usage_percent":     usagePercent,
 				"max_usage_percent": maxUsagePercent,
-				"note":              "implement memory check",
 			},
 		}
+
+		if usagePercent > maxUsagePercent {
+			result.Status = StatusDown
+			result.Error = fmt.Sprintf("heap usage %.2f%% exceeds %.2f%%", usagePercent, maxUsagePercent)
+		}
+
+		return result
 	})
 }
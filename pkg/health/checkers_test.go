@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryChecker(t *testing.T) {
+	ctx := context.Background()
+
+	before := MemoryChecker(1<<40, 100).Check(ctx).Details["alloc_bytes"].(uint64)
+
+	// Держим выделенную память живой до второй проверки
+	const size = 64 << 20
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = 1
+	}
+
+	result := MemoryChecker(1<<40, 100).Check(ctx)
+	runtime.KeepAlive(buf)
+
+	if result.Status != StatusUp {
+		t.Fatalf("status = %s, want %s: %s", result.Status, StatusUp, result.Error)
+	}
+	if after := result.Details["alloc_bytes"].(uint64); after < before+size/2 {
+		t.Errorf("alloc_bytes = %d after allocating %d bytes, was %d", after, size, before)
+	}
+
+	low := MemoryChecker(1, 50).Check(ctx)
+	if low.Status != StatusDown {
+		t.Errorf("status with a 1 byte ceiling = %s, want %s", low.Status, StatusDown)
+	}
+	if low.Error == "" {
+		t.Error("down result has no error message")
+	}
+}
+
+func TestDiskSpaceCheckerTempDir(t *testing.T) {
+	result := DiskSpaceChecker(t.TempDir(), 0).Check(context.Background())
+
+	if result.Status != StatusUp {
+		t.Fatalf("status = %s, want %s: %s", result.Status, StatusUp, result.Error)
+	}
+	if _, ok := result.Details["note"]; ok {
+		t.Skipf("disk check is unsupported here: %v", result.Details["note"])
+	}
+	if free, _ := result.Details["free_bytes"].(uint64); free == 0 {
+		t.Errorf("free_bytes = %v, want nonzero", result.Details["free_bytes"])
+	}
+
+	full := DiskSpaceChecker(t.TempDir(), 1<<62).Check(context.Background())
+	if full.Status != StatusDown {
+		t.Errorf("status with an unreachable minimum = %s, want %s", full.Status, StatusDown)
+	}
+
+	missing := DiskSpaceChecker("/nonexistent/path/for/health", 0).Check(context.Background())
+	if missing.Status != StatusDown {
+		t.Errorf("status for a missing path = %s, want %s", missing.Status, StatusDown)
+	}
+}
+
+// stubRedis RedisClient, отвечающий на INFO заранее заданными секциями
+type stubRedis struct {
+	info map[string]string
+}
+
+func (s stubRedis) Ping(ctx context.Context) *redis.StatusCmd {
+	return redis.NewStatusResult("PONG", nil)
+}
+
+func (s stubRedis) Info(ctx context.Context, section ...string) *redis.StringCmd {
+	return redis.NewStringResult(s.info[strings.Join(section, ",")], nil)
+}
+
+func TestRedisCheckerReplicaRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		role         string
+		opts         []RedisCheckOption
+		want         Status
+		wantReadOnly bool
+	}{
+		{"master", "master", []RedisCheckOption{RequireWritable()}, StatusUp, false},
+		{"replica", "slave", nil, StatusUp, true},
+		{"replica must be writable", "slave", []RedisCheckOption{RequireWritable()}, StatusDown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubRedis{info: map[string]string{
+				"server":      "# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:42\r\n",
+				"replication": "# Replication\r\nrole:" + tt.role + "\r\nconnected_slaves:0\r\n",
+			}}
+
+			result := RedisChecker(client, tt.opts...).Check(context.Background())
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", result.Status, tt.want, result.Error)
+			}
+			if result.Details["role"] != tt.role {
+				t.Errorf("role = %v, want %s", result.Details["role"], tt.role)
+			}
+			if readOnly, _ := result.Details["read_only"].(bool); readOnly != tt.wantReadOnly {
+				t.Errorf("read_only = %v, want %v", readOnly, tt.wantReadOnly)
+			}
+		})
+	}
+}
+
+func TestRedisMemoryChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		used     string
+		limit    string
+		want     Status
+		wantNote bool
+	}{
+		{"below threshold", "799", "1000", StatusUp, false},
+		{"at threshold", "800", "1000", StatusUp, false},
+		{"above threshold", "801", "1000", StatusDown, false},
+		{"no maxmemory", "1000000", "0", StatusUp, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubRedis{info: map[string]string{
+				"memory": "# Memory\r\nused_memory:" + tt.used + "\r\nmaxmemory:" + tt.limit + "\r\nmaxmemory_policy:noeviction\r\n",
+			}}
+
+			result := RedisMemoryChecker(client, 80).Check(context.Background())
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", result.Status, tt.want, result.Error)
+			}
+			if _, ok := result.Details["note"]; ok != tt.wantNote {
+				t.Errorf("details = %v, want note %v", result.Details, tt.wantNote)
+			}
+			if result.Details["maxmemory_policy"] != "noeviction" {
+				t.Errorf("maxmemory_policy = %v, want noeviction", result.Details["maxmemory_policy"])
+			}
+		})
+	}
+
+	t.Run("missing used_memory", func(t *testing.T) {
+		client := stubRedis{info: map[string]string{"memory": "# Memory\r\nmaxmemory:1000\r\n"}}
+		if result := RedisMemoryChecker(client, 80).Check(context.Background()); result.Status != StatusDown {
+			t.Errorf("status = %s, want %s", result.Status, StatusDown)
+		}
+	})
+}
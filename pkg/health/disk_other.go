@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package health
+
+// diskUsage на неподдерживаемых ОС всегда возвращает errDiskCheckUnsupported
+func diskUsage(path string) (free, total uint64, err error) {
+	return 0, 0, errDiskCheckUnsupported
+}
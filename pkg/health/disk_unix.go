@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package health
+
+import (
+	"syscall"
+)
+
+// diskUsage возвращает свободное и общее место на файловой системе, содержащей path
+func diskUsage(path string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	// Bavail — место, доступное непривилегированному пользователю
+	blockSize := uint64(stat.Bsize)
+	return stat.Bavail * blockSize, stat.Blocks * blockSize, nil
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// SyncGRPCHealth периодически выполняет проверки и выставляет статус
+// стандартного gRPC health сервера (grpc.health.v1.Health).
+// Пустое имя сервиса ("") отвечает за статус сервера целиком.
+// Блокируется до отмены контекста
+func (s *Server) SyncGRPCHealth(ctx context.Context, grpcHealth *grpchealth.Server, interval time.Duration, services ...string) {
+	services = append([]string{""}, services...)
+
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if !s.IsHealthy(ctx) {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		for _, service := range services {
+			grpcHealth.SetServingStatus(service, status)
+		}
+	}
+
+	update()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
@@ -14,11 +14,14 @@ const (
 	StatusDown Status = "DOWN"
 )
 
-// CheckHealth результат проверки компонента
+// CheckHealth результат проверки компонента.
+// DurationMs и CheckedAt заполняются в Health, а не в самих проверках
 type CheckResult struct {
-	Status  Status         `json:"status"`
-	Details map[string]any `json:"details,omitempty"`
-	Error   string         `json:"error,omitempty"`
+	Status     Status         `json:"status"`
+	DurationMs int64          `json:"duration_ms"`
+	CheckedAt  string         `json:"checked_at"` // RFC3339
+	Details    map[string]any `json:"details,omitempty"`
+	Error      string         `json:"error,omitempty"`
 }
 
 // Response ответ healthcheck endpoint
@@ -27,7 +30,7 @@ type Response struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Service   string                 `json:"service"`
 	Version   string                 `json:"version,omitempty"`
-	Checks    map[string]CheckResult `json:"checks,omitempty"`
+	Checks    map[string]CheckResult `json:"checks,omitempty"` // encoding/json сортирует ключи, порядок в ответе стабилен
 	Duration  string                 `json:"duration"`
 }
 
@@ -50,15 +53,23 @@ type Health struct {
 	checkers map[string]Checker
 	mu       sync.RWMutex
 	timeout  time.Duration
+	metrics  MetricsCollector
 }
 
 // New создает новый экземпляр Health
 func New(service, version string, opts ...Option) *Health {
+	config := defaultConfig()
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	h := &Health{
 		service:  service,
 		version:  version,
 		checkers: make(map[string]Checker),
-		timeout:  5 * time.Second,
+		timeout:  config.Timeout,
+		metrics:  config.Metrics,
 	}
 
 	return h
@@ -73,12 +84,6 @@ func (h *Health) AddCheck(name string, checker Checker) {
 
 // Check выполняет все проверки
 func (h *Health) Check(ctx context.Context) Response {
-	start := time.Now()
-
-	// Контекст с таймаутом
-	checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
-	defer cancel()
-
 	h.mu.RLock()
 
 	checkers := make(map[string]Checker, len(h.checkers))
@@ -89,43 +94,68 @@ func (h *Health) Check(ctx context.Context) Response {
 
 	h.mu.RUnlock()
 
-	// Параллельное выполнение всех проверок
-	results := make(map[string]CheckResult)
+	return h.run(ctx, checkers)
+}
+
+// CheckOnly выполняет только проверки с указанными именами.
+// Незарегистрированные имена игнорируются
+func (h *Health) CheckOnly(ctx context.Context, names ...string) Response {
+	h.mu.RLock()
+
+	checkers := make(map[string]Checker, len(names))
+
+	for _, name := range names {
+		if checker, ok := h.checkers[name]; ok {
+			checkers[name] = checker
+		}
+	}
+
+	h.mu.RUnlock()
+
+	return h.run(ctx, checkers)
+}
+
+// run выполняет переданные проверки и собирает общий ответ
+func (h *Health) run(ctx context.Context, checkers map[string]Checker) Response {
+	start := time.Now()
 
-	resChan := make(chan struct {
-		name   string
-		result CheckResult
-	}, len(checkers))
+	// Параллельное выполнение всех проверок: каждая ограничена своим таймаутом,
+	// поэтому общее время ответа не превышает h.timeout
+	results := make(map[string]CheckResult, len(checkers))
+	overallStatus := StatusUp
 
-	var wg sync.WaitGroup
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
 
 	for name, checker := range checkers {
 		wg.Add(1)
 		go func(n string, c Checker) {
 			defer wg.Done()
 
-			// Запускаем проверку в горутине с обработкой паники
-			result := h.safeCheck(checkCtx, c)
-			resChan <- struct {
-				name   string
-				result CheckResult
-			}{n, result}
+			checkStart := time.Now()
+			result := h.boundedCheck(ctx, c)
+			duration := time.Since(checkStart)
+			if h.metrics != nil {
+				h.metrics.ObserveCheck(n, duration)
+			}
+
+			result.DurationMs = duration.Milliseconds()
+			result.CheckedAt = checkStart.UTC().Format(time.RFC3339)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[n] = result
+			if result.Status == StatusDown {
+				overallStatus = StatusDown
+			}
 		}(name, checker)
 	}
 
 	// Ждем завершения всех проверок
 	wg.Wait()
-	close(resChan)
-
-	// Собираем результаты
-	overallStatus := StatusUp
-
-	for r := range resChan {
-		results[r.name] = r.result
-		if r.result.Status == StatusDown {
-			overallStatus = StatusDown
-		}
-	}
 
 	return Response{
 		Status:    overallStatus,
@@ -137,6 +167,34 @@ func (h *Health) Check(ctx context.Context) Response {
 	}
 }
 
+// boundedCheck выполняет проверку с таймаутом. Если проверка не уважает контекст
+// и не вернулась вовремя, результат помечается DOWN, не дожидаясь ее завершения
+func (h *Health) boundedCheck(ctx context.Context, checker Checker) CheckResult {
+	checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	// Буфер нужен, чтобы зависшая проверка могла завершиться после таймаута
+	done := make(chan CheckResult, 1)
+
+	// Запускаем проверку в горутине с обработкой паники
+	go func() {
+		done <- h.safeCheck(checkCtx, checker)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-checkCtx.Done():
+		return CheckResult{
+			Status: StatusDown,
+			Error:  "timeout",
+			Details: map[string]any{
+				"timeout_ms": h.timeout.Milliseconds(),
+			},
+		}
+	}
+}
+
 // safeCheck безопасно выполняет проверку с обработкой паники
 func (h *Health) safeCheck(ctx context.Context, checker Checker) (result CheckResult) {
 	defer func() {
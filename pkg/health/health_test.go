@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sleepChecker проверка, которая отвечает UP через d
+func sleepChecker(d time.Duration) Checker {
+	return CheckerFunc(func(ctx context.Context) CheckResult {
+		select {
+		case <-time.After(d):
+			return CheckResult{Status: StatusUp}
+		case <-ctx.Done():
+			return CheckResult{Status: StatusDown, Error: ctx.Err().Error()}
+		}
+	})
+}
+
+func TestHealthRunsChecksInParallel(t *testing.T) {
+	h := New("test", "1.0.0", WithTimeout(time.Second))
+	for i := 0; i < 3; i++ {
+		h.AddCheck(fmt.Sprintf("slow_%d", i), sleepChecker(100*time.Millisecond))
+	}
+
+	start := time.Now()
+	res := h.Check(context.Background())
+	elapsed := time.Since(start)
+
+	if res.Status != StatusUp || len(res.Checks) != 3 {
+		t.Fatalf("response = %s with %d checks, want UP with 3", res.Status, len(res.Checks))
+	}
+	// Последовательно три проверки заняли бы 300 мс
+	if elapsed >= 250*time.Millisecond {
+		t.Errorf("Check took %s, want well under 300ms", elapsed)
+	}
+}
+
+func TestHealthTimesOutSlowChecker(t *testing.T) {
+	// Проверка игнорирует контекст, как зависший вызов без дедлайна
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	stuck := CheckerFunc(func(ctx context.Context) CheckResult {
+		<-release
+		return CheckResult{Status: StatusUp}
+	})
+
+	h := New("test", "1.0.0", WithTimeout(100*time.Millisecond))
+	h.AddCheck("stuck", stuck)
+	h.AddCheck("fast", sleepChecker(0))
+
+	start := time.Now()
+	res := h.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Check took %s, want about the 100ms timeout", elapsed)
+	}
+
+	if res.Status != StatusDown {
+		t.Errorf("status = %s, want %s", res.Status, StatusDown)
+	}
+	if got := res.Checks["stuck"]; got.Status != StatusDown || got.Error != "timeout" {
+		t.Errorf("stuck check = %s %q, want DOWN with timeout", got.Status, got.Error)
+	}
+	if got := res.Checks["fast"]; got.Status != StatusUp {
+		t.Errorf("fast check = %s, want UP", got.Status)
+	}
+}
+
+func TestHealthResponseHasCheckTiming(t *testing.T) {
+	// Проверка с собственными деталями и проверка, не заполняющая ничего, кроме статуса
+	detailed := CheckerFunc(func(ctx context.Context) CheckResult {
+		return CheckResult{Status: StatusUp, Details: map[string]any{"free_mb": 512}}
+	})
+	bare := CheckerFunc(func(ctx context.Context) CheckResult {
+		return CheckResult{Status: StatusUp}
+	})
+	s, _ := newTestServer(t, WithLocalCheck("detailed", detailed), WithLocalCheck("bare", bare), WithLocalCheck("disk", downChecker))
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var res struct {
+		Checks map[string]map[string]any `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode /health: %v: %s", err, rec.Body)
+	}
+	if len(res.Checks) < 4 {
+		t.Fatalf("/health has %d checks, want database and 3 local checks: %s", len(res.Checks), rec.Body)
+	}
+
+	for name, check := range res.Checks {
+		if _, ok := check["duration_ms"].(float64); !ok {
+			t.Errorf("check %s has no duration_ms: %v", name, check)
+		}
+		checkedAt, _ := check["checked_at"].(string)
+		if _, err := time.Parse(time.RFC3339, checkedAt); err != nil {
+			t.Errorf("check %s checked_at = %q, want RFC3339", name, checkedAt)
+		}
+	}
+
+	details, _ := res.Checks["detailed"]["details"].(map[string]any)
+	if details["free_mb"] != float64(512) {
+		t.Errorf("detailed check details = %v, want free_mb nested under details", res.Checks["detailed"])
+	}
+}
@@ -0,0 +1,36 @@
+package health
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// apiKeyHeader заголовок с ключом доступа к pprof и изменению уровня логов
+const apiKeyHeader = "X-Api-Key"
+
+// registerPprof регистрирует обработчики net/http/pprof под /debug/pprof/.
+// Профили раскрывают внутреннее состояние процесса, поэтому доступ только по ключу
+func registerPprof(mux *http.ServeMux, apiKey string) {
+	mux.Handle("/debug/pprof/", requireAPIKey(apiKey, http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", requireAPIKey(apiKey, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", requireAPIKey(apiKey, http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", requireAPIKey(apiKey, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireAPIKey(apiKey, http.HandlerFunc(pprof.Trace)))
+}
+
+// requireAPIKey пропускает только запросы с корректным ключом. Для прошедших
+// проверку снимается WriteTimeout сервера: CPU профиль и trace пишутся дольше него
+func requireAPIKey(apiKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -17,12 +20,20 @@ type Server struct {
 	config Config
 	health *Health
 	server *http.Server
-	redis  *redis.Client
+	redis  redis.UniversalClient
 	log    logger.Logger
+
+	// readinessChecks имена проверок внешних зависимостей для /ready
+	readinessChecks []string
+	readinessMu     sync.RWMutex
+
+	// listener занятый порт; nil, пока сервер не начал слушать
+	listener   net.Listener
+	listenerMu sync.Mutex
 }
 
 // NewServer создает новый healthcheck сервер
-func NewServer(redis *redis.Client, log logger.Logger, opts ...Option) *Server {
+func NewServer(redis redis.UniversalClient, log logger.Logger, opts ...Option) *Server {
 	// Применяем дефолтную конфигурацию
 	config := defaultConfig()
 
@@ -36,6 +47,7 @@ func NewServer(redis *redis.Client, log logger.Logger, opts ...Option) *Server {
 		config.ServiceName,
 		config.Version,
 		WithTimeout(config.Timeout),
+		WithMetrics(config.Metrics),
 	)
 
 	s := &Server{
@@ -54,7 +66,34 @@ func NewServer(redis *redis.Client, log logger.Logger, opts ...Option) *Server {
 // setupChecks настраивает все проверки здоровья для микросервиса
 func (s *Server) setupChecks() {
 	// Проверка базы данных
-	s.health.AddCheck("database", RedisChecker(s.redis))
+	var redisOpts []RedisCheckOption
+	if s.config.RedisWritable {
+		redisOpts = append(redisOpts, RequireWritable())
+	}
+	s.health.AddCheck("database", RedisChecker(s.redis, redisOpts...))
+	s.readinessChecks = append(s.readinessChecks, "database")
+
+	// Проверка хранилища сессий на запись и чтение
+	if s.config.SessionStore != nil {
+		s.health.AddCheck("session_store", SessionStoreChecker(s.config.SessionStore))
+		s.readinessChecks = append(s.readinessChecks, "session_store")
+	}
+
+	// Проверки, переданные через WithCheck
+	for _, check := range s.config.Checks {
+		s.AddCheck(check.Name, check.Checker)
+	}
+	for _, check := range s.config.LocalChecks {
+		s.health.AddCheck(check.Name, check.Checker)
+	}
+
+	// Предупреждаем, если сервис смотрит не в ту БД Redis
+	if _, db := redisTarget(s.redis); s.config.RedisDB >= 0 && db != s.config.RedisDB {
+		s.log.Warn("Redis DB differs from the expected one",
+			"expected_db", s.config.RedisDB,
+			"actual_db", db,
+		)
+	}
 
 	s.log.Info("Health checks configured",
 		"service", s.config.ServiceName,
@@ -64,6 +103,22 @@ func (s *Server) setupChecks() {
 	)
 }
 
+// AddCheck регистрирует проверку внешней зависимости: она попадает в /health и /ready.
+// Вызывается до Start; повторное имя заменяет прежнюю проверку
+func (s *Server) AddCheck(name string, checker Checker) {
+	s.health.AddCheck(name, checker)
+
+	s.readinessMu.Lock()
+	defer s.readinessMu.Unlock()
+
+	for _, existing := range s.readinessChecks {
+		if existing == name {
+			return
+		}
+	}
+	s.readinessChecks = append(s.readinessChecks, name)
+}
+
 // setupRoutes настраивает HTTP маршруты
 func (s *Server) setupRoutes() {
 	mux := http.NewServeMux()
@@ -71,7 +126,21 @@ func (s *Server) setupRoutes() {
 	// Основные эндпоинты
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/live", s.liveHandler)
+	mux.HandleFunc("/ready", s.readyHandler)
 	mux.HandleFunc("/info", s.infoHandler)
+	mux.Handle("/loglevel", s.logLevelHandler())
+
+	if s.config.Metrics != nil {
+		mux.Handle("/metrics", s.config.Metrics)
+	}
+
+	if s.config.PprofAPIKey != "" {
+		registerPprof(mux, s.config.PprofAPIKey)
+	}
+
+	for pattern, handler := range s.config.Handlers {
+		mux.Handle(pattern, handler)
+	}
 
 	s.server = &http.Server{
 		Addr:         s.config.Port,
@@ -82,6 +151,29 @@ func (s *Server) setupRoutes() {
 	}
 }
 
+// logLevelHandler отдает уровень логирования всем, а меняет его только с AdminAPIKey
+func (s *Server) logLevelHandler() http.Handler {
+	levels := logger.LevelHandler()
+	if s.config.AdminAPIKey == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "log level changes require an api key", http.StatusForbidden)
+				return
+			}
+			levels.ServeHTTP(w, r)
+		})
+	}
+
+	protected := requireAPIKey(s.config.AdminAPIKey, levels)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			levels.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
 // Handler возвращает HTTP handler для health эндпоинта
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	response := s.health.Check(r.Context())
@@ -104,38 +196,146 @@ func (s *Server) liveHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ALIVE"))
 }
 
+// readyHandler проверяет готовность внешних зависимостей сервиса
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	response := s.checkReadiness(r.Context())
+
+	// Пока зависимости недоступны, сервис не готов принимать трафик
+	statusCode := http.StatusOK
+	if response.Status == StatusDown {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
 // infoHandler возвращает информацию о сервисе
 func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	endpoints := map[string]string{
+		"health":   "/health",
+		"live":     "/live",
+		"ready":    "/ready",
+		"info":     "/info",
+		"loglevel": "/loglevel",
+	}
+
+	if s.config.Metrics != nil {
+		endpoints["metrics"] = "/metrics"
+	}
+
+	if s.config.PprofAPIKey != "" {
+		endpoints["pprof"] = "/debug/pprof/"
+	}
+
 	info := map[string]any{
 		"service":    s.config.ServiceName,
 		"version":    s.config.Version,
 		"build_time": time.Now().Format(time.RFC3339),
 		"go_version": runtime.Version(),
-		"endpoints": map[string]string{
-			"health": "/health",
-			"live":   "/live",
-			"info":   "/info",
-		},
+		"endpoints":  endpoints,
 	}
 
 	if len(s.config.RequiredTables) > 0 {
 		info["required_tables"] = s.config.RequiredTables
 	}
 
+	if s.config.Draining != nil {
+		info["draining"] = s.config.Draining()
+	}
+
+	info["redis"] = s.redisInfo()
+
 	json.NewEncoder(w).Encode(info)
 }
 
+// redisInfo описывает, к какому Redis подключен сервис. Учетные данные намеренно
+// не выводятся: в Options они хранятся отдельно от адреса
+func (s *Server) redisInfo() map[string]any {
+	addr, db := redisTarget(s.redis)
+
+	info := map[string]any{
+		"addr": addr,
+		"db":   db,
+	}
+
+	// У клиента Sentinel вместо адреса заглушка "FailoverClient"
+	if s.config.SentinelMasterName != "" {
+		info["addr"] = strings.Join(s.config.SentinelAddrs, ",")
+		info["sentinel_master"] = s.config.SentinelMasterName
+	}
+
+	if s.config.RedisDB >= 0 {
+		info["expected_db"] = s.config.RedisDB
+	}
+
+	return info
+}
+
+// Listen занимает порт сервера. Для ":0" номер порта выбирает ОС,
+// фактический адрес возвращает Addr. Start вызывает Listen сам, если порт еще не занят
+func (s *Server) Listen() error {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	if s.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	s.listener = listener
+
+	return nil
+}
+
+// Addr возвращает адрес, на котором слушает сервер. До Listen или Start
+// возвращает настроенный адрес
+func (s *Server) Addr() string {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.server.Addr
+}
+
+// redisTarget возвращает адрес и номер БД клиента. Для кластера адрес —
+// список начальных узлов через запятую, БД всегда 0
+func redisTarget(client redis.UniversalClient) (string, int) {
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.Options().Addr, c.Options().DB
+	case *redis.ClusterClient:
+		return strings.Join(c.Options().Addrs, ","), 0
+	default:
+		return "", 0
+	}
+}
+
 // Start запускает healthcheck сервер
 func (s *Server) Start() error {
+	if err := s.Listen(); err != nil {
+		return fmt.Errorf("health server error: %w", err)
+	}
+
+	s.listenerMu.Lock()
+	listener := s.listener
+	s.listenerMu.Unlock()
+
 	s.log.Info("Starting health check server",
-		"address", s.server.Addr,
+		"address", listener.Addr().String(),
 		"service", s.config.ServiceName,
 		"version", s.config.Version,
 	)
 
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("health server error: %w", err)
 	}
 	return nil
@@ -147,6 +347,21 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
+// checkReadiness выполняет только проверки внешних зависимостей
+func (s *Server) checkReadiness(ctx context.Context) Response {
+	s.readinessMu.RLock()
+	names := append([]string(nil), s.readinessChecks...)
+	s.readinessMu.RUnlock()
+
+	return s.health.CheckOnly(ctx, names...)
+}
+
+// IsReady возвращает true, если сервис готов принимать трафик: как и /ready,
+// учитывает только проверки внешних зависимостей
+func (s *Server) IsReady(ctx context.Context) bool {
+	return s.checkReadiness(ctx).Status != StatusDown
+}
+
 // IsHealthy возвращает true если все проверки проходят
 func (s *Server) IsHealthy(ctx context.Context) bool {
 	response := s.health.Check(ctx)
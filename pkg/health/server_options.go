@@ -1,6 +1,7 @@
 package health
 
 import (
+	"net/http"
 	"time"
 )
 
@@ -11,11 +12,43 @@ type Config struct {
 	Version          string
 	Timeout          time.Duration
 	RequiredTables   []string
-	MigrationVersion int // 0 = не проверять версию
+	MigrationVersion int  // 0 = не проверять версию
+	RedisDB          int  // Ожидаемый номер БД Redis, -1 = не проверять
+	RedisWritable    bool // Реплика Redis только для чтения считается недоступной
+
+	// Sentinel, через который найден мастер Redis: у такого клиента нет адреса узла,
+	// поэтому /info показывает имя мастера и адреса Sentinel
+	SentinelMasterName string
+	SentinelAddrs      []string
 
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+
+	Metrics      MetricsCollector // nil = эндпоинт /metrics отключен
+	SessionStore SessionStore     // nil = проверка хранилища сессий отключена
+
+	Checks      []NamedCheck // Дополнительные проверки зависимостей
+	LocalChecks []NamedCheck // Проверки ресурсов процесса (диск, память): только /health
+
+	Handlers map[string]http.Handler // Дополнительные маршруты на том же порту
+
+	PprofAPIKey string // Ключ доступа к /debug/pprof/, пусто = pprof отключен
+	AdminAPIKey string // Ключ для изменения уровня логов через /loglevel, пусто = только чтение
+
+	Draining func() bool // Состояние вывода из ротации для /info, nil = не выводится
+}
+
+// NamedCheck проверка с именем, под которым она попадает в ответ
+type NamedCheck struct {
+	Name    string
+	Checker Checker
+}
+
+// MetricsCollector отдает метрики по HTTP и записывает длительность проверок
+type MetricsCollector interface {
+	http.Handler
+	ObserveCheck(name string, duration time.Duration)
 }
 
 // Option функция для настройки health server
@@ -30,13 +63,14 @@ func defaultConfig() Config {
 		Timeout:          5 * time.Second,
 		RequiredTables:   []string{},
 		MigrationVersion: 0, // 0 = не проверять версию
+		RedisDB:          -1,
 		ReadTimeout:      10 * time.Second,
 		WriteTimeout:     10 * time.Second,
 		IdleTimeout:      60 * time.Second,
 	}
 }
 
-// WithPort устанавливает порт для health server
+// WithPort устанавливает порт для health server; ":0" = свободный порт на выбор ОС
 func WithPort(port string) Option {
 	return func(c *Config) {
 		c.Port = port
@@ -80,6 +114,22 @@ func WithMigrationVersion(version int) Option {
 	}
 }
 
+// WithRedisDB задает ожидаемый номер БД Redis. Несовпадение с БД клиента
+// логируется при старте, а оба значения видны в /info
+func WithRedisDB(db int) Option {
+	return func(c *Config) {
+		c.RedisDB = db
+	}
+}
+
+// WithRedisWritable требует, чтобы Redis принимал запись: подключение
+// к реплике помечает проверку database как DOWN
+func WithRedisWritable() Option {
+	return func(c *Config) {
+		c.RedisWritable = true
+	}
+}
+
 // WithHTTPTimeouts устанавливает все HTTP timeouts одновременно
 func WithHTTPTimeouts(read, write, idle time.Duration) Option {
 	return func(c *Config) {
@@ -89,6 +139,77 @@ func WithHTTPTimeouts(read, write, idle time.Duration) Option {
 	}
 }
 
+// WithMetrics включает эндпоинт /metrics и запись длительности проверок
+func WithMetrics(metrics MetricsCollector) Option {
+	return func(c *Config) {
+		c.Metrics = metrics
+	}
+}
+
+// WithDrainState показывает в /info, выведен ли сервис из ротации
+func WithDrainState(draining func() bool) Option {
+	return func(c *Config) {
+		c.Draining = draining
+	}
+}
+
+// WithCheck добавляет проверку внешней зависимости в /health и /ready
+func WithCheck(name string, checker Checker) Option {
+	return func(c *Config) {
+		c.Checks = append(c.Checks, NamedCheck{Name: name, Checker: checker})
+	}
+}
+
+// WithLocalCheck добавляет проверку ресурсов самого процесса, например места на диске
+// или памяти. Она видна в /health, но не влияет на /ready и ожидание при запуске
+func WithLocalCheck(name string, checker Checker) Option {
+	return func(c *Config) {
+		c.LocalChecks = append(c.LocalChecks, NamedCheck{Name: name, Checker: checker})
+	}
+}
+
+// WithHandler монтирует дополнительный обработчик на мукс health сервера.
+// Авторизацию обработчик выполняет сам: остальные эндпоинты открыты
+func WithHandler(pattern string, handler http.Handler) Option {
+	return func(c *Config) {
+		if c.Handlers == nil {
+			c.Handlers = make(map[string]http.Handler)
+		}
+		c.Handlers[pattern] = handler
+	}
+}
+
+// WithPprof включает /debug/pprof/ с доступом только по заголовку X-Api-Key.
+// Пустой ключ оставляет pprof отключенным
+func WithPprof(apiKey string) Option {
+	return func(c *Config) {
+		c.PprofAPIKey = apiKey
+	}
+}
+
+// WithAdminAPIKey требует заголовок X-Api-Key для изменения уровня логирования через
+// PUT /loglevel. Без ключа /loglevel доступен только для чтения
+func WithAdminAPIKey(apiKey string) Option {
+	return func(c *Config) {
+		c.AdminAPIKey = apiKey
+	}
+}
+
+// WithRedisSentinel сообщает, что клиент Redis подключен через Sentinel, для /info
+func WithRedisSentinel(masterName string, addrs ...string) Option {
+	return func(c *Config) {
+		c.SentinelMasterName = masterName
+		c.SentinelAddrs = addrs
+	}
+}
+
+// WithSessionStore добавляет проверку хранилища сессий циклом запись/чтение/удаление
+func WithSessionStore(store SessionStore) Option {
+	return func(c *Config) {
+		c.SessionStore = store
+	}
+}
+
 // - Предустановленные конфигурации - \\
 
 // EventServiceOptions возвращает специфичные для event-service опции
@@ -0,0 +1,251 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/rx3lixir/auth-service/pkg/logger"
+	"github.com/rx3lixir/auth-service/pkg/metrics"
+)
+
+func TestLogLevelRequiresAPIKey(t *testing.T) {
+	t.Cleanup(func() { logger.SetLevel("info") })
+
+	tests := []struct {
+		name   string
+		apiKey string
+		method string
+		key    string
+		want   int
+	}{
+		{"read without key", "admin-key", http.MethodGet, "", http.StatusOK},
+		{"change without key", "admin-key", http.MethodPut, "", http.StatusUnauthorized},
+		{"change with wrong key", "admin-key", http.MethodPut, "wrong", http.StatusUnauthorized},
+		{"change with key", "admin-key", http.MethodPut, "admin-key", http.StatusOK},
+		{"change when no key is configured", "", http.MethodPut, "", http.StatusForbidden},
+		{"read when no key is configured", "", http.MethodGet, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, WithAdminAPIKey(tt.apiKey))
+
+			body := ""
+			if tt.method == http.MethodPut {
+				body = `{"level":"debug"}`
+			}
+			req := httptest.NewRequest(tt.method, "/loglevel", strings.NewReader(body))
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s /loglevel = %d, want %d: %s", tt.method, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRedisInfo(t *testing.T) {
+	t.Run("single node", func(t *testing.T) {
+		s, mr := newTestServer(t)
+
+		info := s.redisInfo()
+		if info["addr"] != mr.Addr() || info["db"] != 0 {
+			t.Errorf("redis info = %v, want addr %s and db 0", info, mr.Addr())
+		}
+		if _, ok := info["sentinel_master"]; ok {
+			t.Errorf("redis info = %v, want no sentinel_master", info)
+		}
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		client := redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    "mymaster",
+			SentinelAddrs: []string{mr.Addr()},
+		})
+		t.Cleanup(func() { client.Close() })
+
+		s := NewServer(client, nopLogger{}, WithRedisSentinel("mymaster", "sentinel-1:26379", "sentinel-2:26379"))
+
+		info := s.redisInfo()
+		if info["addr"] != "sentinel-1:26379,sentinel-2:26379" || info["sentinel_master"] != "mymaster" {
+			t.Errorf("redis info = %v, want sentinel addresses and master name", info)
+		}
+	})
+}
+
+func TestReadyAndLiveWhenRedisIsDown(t *testing.T) {
+	s, mr := newTestServer(t)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := get("/ready"); code != http.StatusOK {
+		t.Fatalf("/ready with Redis up = %d, want %d", code, http.StatusOK)
+	}
+
+	mr.Close()
+
+	if code := get("/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("/ready with Redis down = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	// Живость не зависит от внешних зависимостей: перезапуск не поможет Redis
+	if code := get("/live"); code != http.StatusOK {
+		t.Errorf("/live with Redis down = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := metrics.New()
+	s, _ := newTestServer(t, WithMetrics(m))
+
+	m.SessionCreated()
+	m.SessionsRevoked(2)
+
+	// /health записывает длительность проверок в те же метрики
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"auth_service_sessions_created_total 1",
+		"auth_service_sessions_revoked_total 2",
+		"auth_service_sessions_deleted_total 0",
+		`auth_service_health_check_duration_seconds_count{check="database"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics has no %q", want)
+		}
+	}
+}
+
+func TestCustomCheckInHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(t *testing.T) *Server
+	}{
+		{"WithCheck", func(t *testing.T) *Server {
+			s, _ := newTestServer(t, WithCheck("users_service", downChecker))
+			return s
+		}},
+		{"AddCheck", func(t *testing.T) *Server {
+			s, _ := newTestServer(t)
+			s.AddCheck("users_service", downChecker)
+			return s
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.register(t)
+
+			for _, path := range []string{"/health", "/ready"} {
+				rec := httptest.NewRecorder()
+				s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("%s = %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+				}
+
+				var res Response
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("decode %s: %v", path, err)
+				}
+				if check, ok := res.Checks["users_service"]; !ok || check.Status != StatusDown {
+					t.Errorf("%s users_service check = %+v, want it named and DOWN", path, check)
+				}
+				if check := res.Checks["database"]; check.Status != StatusUp {
+					t.Errorf("%s database check = %s, want UP", path, check.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestEphemeralPorts(t *testing.T) {
+	servers := make([]*Server, 2)
+	for i := range servers {
+		s, _ := newTestServer(t, WithPort(":0"))
+		if err := s.Listen(); err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		servers[i] = s
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- s.Start() }()
+		t.Cleanup(func() {
+			s.Shutdown(context.Background())
+			if err := <-errCh; err != nil {
+				t.Errorf("Start: %v", err)
+			}
+		})
+	}
+
+	if servers[0].Addr() == servers[1].Addr() || strings.HasSuffix(servers[0].Addr(), ":0") {
+		t.Fatalf("bound addresses = %s and %s, want two distinct ports", servers[0].Addr(), servers[1].Addr())
+	}
+
+	for _, s := range servers {
+		resp, err := http.Get("http://" + s.Addr() + "/live")
+		if err != nil {
+			t.Fatalf("GET /live on %s: %v", s.Addr(), err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET /live on %s = %d, want %d", s.Addr(), resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestPprof(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		path string
+		key  string
+		want int
+	}{
+		{"disabled", nil, "/debug/pprof/", "", http.StatusNotFound},
+		{"disabled with key", nil, "/debug/pprof/", "pprof-key", http.StatusNotFound},
+		{"disabled by empty key", []Option{WithPprof("")}, "/debug/pprof/", "", http.StatusNotFound},
+		{"enabled without key", []Option{WithPprof("pprof-key")}, "/debug/pprof/", "", http.StatusUnauthorized},
+		{"enabled with wrong key", []Option{WithPprof("pprof-key")}, "/debug/pprof/", "wrong", http.StatusUnauthorized},
+		{"enabled with key", []Option{WithPprof("pprof-key")}, "/debug/pprof/", "pprof-key", http.StatusOK},
+		{"named profile with key", []Option{WithPprof("pprof-key")}, "/debug/pprof/goroutine?debug=1", "pprof-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, tt.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// startupCheckInterval пауза между проверками в WaitReady
+const startupCheckInterval = 500 * time.Millisecond
+
+// ErrStartupTimeout проверки готовности не прошли за отведенное на запуск время
+var ErrStartupTimeout = errors.New("readiness checks did not pass before startup timeout")
+
+// WaitReady блокируется, пока не пройдут проверки готовности (те же, что у /ready),
+// но не дольше timeout. Вызывается до запуска gRPC сервера, чтобы он не принимал
+// трафик, пока Redis недоступен. Остальные проверки /health, например место на
+// диске или память процесса, запуск не задерживают
+func (s *Server) WaitReady(ctx context.Context, timeout time.Duration) error {
+	return waitUntil(ctx, timeout, startupCheckInterval, s.IsReady)
+}
+
+// waitUntil вызывает ready каждые interval, пока она не вернет true.
+// По истечении timeout возвращает ErrStartupTimeout, при отмене ctx — его ошибку
+func waitUntil(ctx context.Context, timeout, interval time.Duration, ready func(ctx context.Context) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ready(ctx) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w (%s)", ErrStartupTimeout, timeout)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// nopLogger отбрасывает логи health сервера в тестах
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) Fatal(string, ...interface{}) {}
+func (nopLogger) Panic(string, ...interface{}) {}
+
+// downChecker проверка, которая всегда падает
+var downChecker = CheckerFunc(func(ctx context.Context) CheckResult {
+	return CheckResult{Status: StatusDown, Error: "low disk space"}
+})
+
+func newTestServer(t *testing.T, opts ...Option) (*Server, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	opts = append([]Option{WithTimeout(time.Second)}, opts...)
+	return NewServer(client, nopLogger{}, opts...), mr
+}
+
+func TestWaitReadyIgnoresLocalChecks(t *testing.T) {
+	s, _ := newTestServer(t, WithLocalCheck("disk", downChecker))
+
+	if s.IsHealthy(context.Background()) {
+		t.Fatal("IsHealthy = true with a failing local check")
+	}
+
+	if err := s.WaitReady(context.Background(), time.Second); err != nil {
+		t.Fatalf("WaitReady with Redis up and a failing local check: %v", err)
+	}
+}
+
+func TestWaitReadyTimesOut(t *testing.T) {
+	s, mr := newTestServer(t)
+	mr.Close()
+
+	start := time.Now()
+	err := s.WaitReady(context.Background(), 200*time.Millisecond)
+	if !errors.Is(err, ErrStartupTimeout) {
+		t.Fatalf("WaitReady error = %v, want %v", err, ErrStartupTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("WaitReady returned after %s, want about the timeout", elapsed)
+	}
+}
+
+func TestWaitReadyFailsOnReadinessCheck(t *testing.T) {
+	s, _ := newTestServer(t, WithCheck("users_service", downChecker))
+
+	if err := s.WaitReady(context.Background(), 200*time.Millisecond); !errors.Is(err, ErrStartupTimeout) {
+		t.Fatalf("WaitReady error = %v, want %v", err, ErrStartupTimeout)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	t.Run("becomes ready", func(t *testing.T) {
+		calls := 0
+		err := waitUntil(context.Background(), time.Second, time.Millisecond, func(ctx context.Context) bool {
+			calls++
+			return calls == 3
+		})
+		if err != nil {
+			t.Fatalf("waitUntil: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("ready called %d times, want 3", calls)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := waitUntil(ctx, time.Second, time.Millisecond, func(ctx context.Context) bool { return false })
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("waitUntil error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"context"
+)
+
+// requestIDKey ключ для хранения request ID в контексте
+type requestIDKey struct{}
+
+// WithRequestID возвращает контекст с сохраненным request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext возвращает request ID из контекста, если он есть
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok && requestID != ""
+}
+
+// FromContext возвращает глобальный логгер, который добавляет request_id из контекста к каждой записи
+func FromContext(ctx context.Context) Logger {
+	return WithContext(ctx, NewLogger())
+}
+
+// WithContext оборачивает переданный логгер так, чтобы к каждой записи добавлялся request_id из контекста.
+// Если request ID в контексте нет, логгер возвращается без изменений
+func WithContext(ctx context.Context, l Logger) Logger {
+	requestID, ok := RequestIDFromContext(ctx)
+	if !ok {
+		return l
+	}
+	return With(l, "request_id", requestID)
+}
+
+// With возвращает логгер, добавляющий указанные пары ключ-значение к каждой записи
+func With(l Logger, args ...interface{}) Logger {
+	return &fieldsLogger{
+		base:   l,
+		fields: args,
+	}
+}
+
+// fieldsLogger добавляет фиксированный набор полей перед аргументами каждой записи
+type fieldsLogger struct {
+	base   Logger
+	fields []interface{}
+}
+
+// merge объединяет фиксированные поля с аргументами вызова
+func (l *fieldsLogger) merge(args []interface{}) []interface{} {
+	merged := make([]interface{}, 0, len(l.fields)+len(args))
+	merged = append(merged, l.fields...)
+	return append(merged, args...)
+}
+
+// Debug логирует с уровнем Debug
+func (l *fieldsLogger) Debug(msg string, args ...interface{}) {
+	l.base.Debug(msg, l.merge(args)...)
+}
+
+// Info логирует с уровнем Info
+func (l *fieldsLogger) Info(msg string, args ...interface{}) {
+	l.base.Info(msg, l.merge(args)...)
+}
+
+// Warn логирует с уровнем Warn
+func (l *fieldsLogger) Warn(msg string, args ...interface{}) {
+	l.base.Warn(msg, l.merge(args)...)
+}
+
+// Error логирует с уровнем Error
+func (l *fieldsLogger) Error(msg string, args ...interface{}) {
+	l.base.Error(msg, l.merge(args)...)
+}
+
+// Fatal логирует с уровнем Fatal
+func (l *fieldsLogger) Fatal(msg string, args ...interface{}) {
+	l.base.Fatal(msg, l.merge(args)...)
+}
+
+// Panic логирует с уровнем Panic
+func (l *fieldsLogger) Panic(msg string, args ...interface{}) {
+	l.base.Panic(msg, l.merge(args)...)
+}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileConfig настройки записи логов в файл с ротацией.
+// Пустой Path отключает запись в файл
+type FileConfig struct {
+	Path       string
+	MaxSizeMB  int // Размер файла, после которого он ротируется
+	MaxBackups int // Сколько старых файлов хранить, 0 = все
+	MaxAgeDays int // Сколько дней хранить старые файлы, 0 = без ограничения
+}
+
+// Option функция для настройки логгера
+type Option func(*options)
+
+// options дополнительные настройки Init
+type options struct {
+	file FileConfig
+}
+
+// WithFile дублирует логи в файл с ротацией; вывод в stdout сохраняется
+func WithFile(file FileConfig) Option {
+	return func(o *options) {
+		o.file = file
+	}
+}
+
+// fileSink текущий файл логов, nil = запись в файл отключена
+var fileSink *lumberjack.Logger
+
+// teeFile добавляет к core запись в файл, если она настроена
+func teeFile(core zapcore.Core, encoder zapcore.Encoder, file FileConfig) zapcore.Core {
+	fileSink = nil
+	if file.Path == "" {
+		return core
+	}
+
+	fileSink = &lumberjack.Logger{
+		Filename:   file.Path,
+		MaxSize:    file.MaxSizeMB,
+		MaxBackups: file.MaxBackups,
+		MaxAge:     file.MaxAgeDays,
+	}
+
+	return zapcore.NewTee(core, zapcore.NewCore(encoder.Clone(), zapcore.AddSync(fileSink), level))
+}
+
+// Reopen сбрасывает логи и закрывает файл логов; следующая запись откроет
+// файл заново по тому же пути. Нужен после внешней ротации файла
+func Reopen() error {
+	err := Sync()
+
+	if fileSink != nil {
+		err = errors.Join(err, fileSink.Close())
+	}
+	return err
+}
@@ -1,7 +1,11 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"syscall"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -14,6 +18,8 @@ var (
 	RawLog *zap.Logger
 	// используем ли мы быстрый немаршалированный логгер
 	useRawLogger bool
+	// level текущий уровень логирования, может меняться во время работы
+	level = zap.NewAtomicLevel()
 )
 
 // Logger представляет интерфейс для логирования
@@ -66,7 +72,12 @@ func NewLogger() Logger {
 
 // Init инициализирует логгер на основе переданного окружения
 // env: "prod" для продакшена, иначе используется development конфигурация
-func Init(env string) {
+func Init(env string, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	isProd := env == "prod"
 
 	// Настраиваем логгер в зависимости от окружения
@@ -76,19 +87,19 @@ func Init(env string) {
 		// - Уровень логирования: InfoLevel
 		// - Простой текстовый вывод без цветов
 		useRawLogger = true
-		initProductionLogger()
+		initProductionLogger(o)
 	} else {
 		// В dev-окружении:
 		// - Используем SugaredLogger
 		// - Уровень логирования: DebugLevel
 		// - Расширенный вывод с цветами
 		useRawLogger = false
-		initDevelopmentLogger()
+		initDevelopmentLogger(o)
 	}
 }
 
 // initProductionLogger инициализирует оптимизированный логгер для продакшена
-func initProductionLogger() {
+func initProductionLogger(o options) {
 	// Конфигурация для продакшен-окружения
 	encoderConfig := zapcore.EncoderConfig{
 		MessageKey:     "message",
@@ -109,12 +120,14 @@ func initProductionLogger() {
 	stdout := zapcore.AddSync(os.Stdout)
 	stderr := zapcore.AddSync(os.Stderr)
 
-	// Основной core для логирования с уровнем Info
+	// Основной core для логирования, по умолчанию с уровнем Info
+	level.SetLevel(zapcore.InfoLevel)
 	core := zapcore.NewCore(
 		encoder,
 		stdout,
-		zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		level,
 	)
+	core = teeFile(core, encoder, o.file)
 
 	// Минимальный набор опций для производительности
 	options := []zap.Option{
@@ -129,7 +142,7 @@ func initProductionLogger() {
 }
 
 // initDevelopmentLogger инициализирует расширенный логгер для разработки
-func initDevelopmentLogger() {
+func initDevelopmentLogger(o options) {
 	// Конфигурация для dev-окружения
 	encoderConfig := zapcore.EncoderConfig{
 		MessageKey:     "message",
@@ -149,12 +162,14 @@ func initDevelopmentLogger() {
 	stdout := zapcore.AddSync(os.Stdout)
 	stderr := zapcore.AddSync(os.Stderr)
 
-	// Основной core для логирования с уровнем Debug
+	// Основной core для логирования, по умолчанию с уровнем Debug
+	level.SetLevel(zapcore.DebugLevel)
 	core := zapcore.NewCore(
 		encoder,
 		stdout,
-		zap.NewAtomicLevelAt(zapcore.DebugLevel),
+		level,
 	)
+	core = teeFile(core, encoder, o.file)
 
 	// Расширенный набор опций для dev-окружения
 	options := []zap.Option{
@@ -170,10 +185,41 @@ func initDevelopmentLogger() {
 	Log = RawLog.Sugar()
 }
 
-// Close закрывает логгер и освобождает ресурсы
+// SetLevel меняет уровень логирования во время работы ("debug", "info", "warn", "error", ...)
+func SetLevel(lvl string) error {
+	parsed, err := zapcore.ParseLevel(lvl)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", lvl, err)
+	}
+
+	level.SetLevel(parsed)
+	return nil
+}
+
+// GetLevel возвращает текущий уровень логирования
+func GetLevel() string {
+	return level.String()
+}
+
+// LevelHandler возвращает HTTP handler для чтения (GET) и изменения (PUT) уровня логирования
+func LevelHandler() http.Handler {
+	return level
+}
+
+// Close сбрасывает логи и закрывает файл логов, если он настроен
 func Close() error {
-	if RawLog != nil {
-		return RawLog.Sync()
+	return Reopen()
+}
+
+// Sync сбрасывает буферизованные записи в вывод.
+// Терминал и пайпы не поддерживают fsync, такие ошибки не возвращаются
+func Sync() error {
+	if RawLog == nil {
+		return nil
+	}
+
+	if err := RawLog.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		return err
 	}
 	return nil
 }
@@ -181,12 +227,7 @@ func Close() error {
 // Debug логирует с уровнем Debug
 func Debug(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Debug(msg, fields...)
-		} else {
-			RawLog.Debug(msg)
-		}
+		RawLog.Debug(msg, argsToFields(args)...)
 	} else {
 		Log.Debugw(msg, args...)
 	}
@@ -195,12 +236,7 @@ func Debug(msg string, args ...interface{}) {
 // Info логирует с уровнем Info
 func Info(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Info(msg, fields...)
-		} else {
-			RawLog.Info(msg)
-		}
+		RawLog.Info(msg, argsToFields(args)...)
 	} else {
 		Log.Infow(msg, args...)
 	}
@@ -209,12 +245,7 @@ func Info(msg string, args ...interface{}) {
 // Warn логирует с уровнем Warn
 func Warn(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Warn(msg, fields...)
-		} else {
-			RawLog.Warn(msg)
-		}
+		RawLog.Warn(msg, argsToFields(args)...)
 	} else {
 		Log.Warnw(msg, args...)
 	}
@@ -223,12 +254,7 @@ func Warn(msg string, args ...interface{}) {
 // Error логирует с уровнем Error
 func Error(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Error(msg, fields...)
-		} else {
-			RawLog.Error(msg)
-		}
+		RawLog.Error(msg, argsToFields(args)...)
 	} else {
 		Log.Errorw(msg, args...)
 	}
@@ -237,12 +263,7 @@ func Error(msg string, args ...interface{}) {
 // Fatal логирует с уровнем Fatal и завершает программу с кодом 1
 func Fatal(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Fatal(msg, fields...)
-		} else {
-			RawLog.Fatal(msg)
-		}
+		RawLog.Fatal(msg, argsToFields(args)...)
 	} else {
 		Log.Fatalw(msg, args...)
 	}
@@ -251,30 +272,36 @@ func Fatal(msg string, args ...interface{}) {
 // Panic логирует с уровнем Panic и вызывает panic()
 func Panic(msg string, args ...interface{}) {
 	if useRawLogger {
-		if len(args) > 0 && len(args)%2 == 0 {
-			fields := argsToFields(args)
-			RawLog.Panic(msg, fields...)
-		} else {
-			RawLog.Panic(msg)
-		}
+		RawLog.Panic(msg, argsToFields(args)...)
 	} else {
 		Log.Panicw(msg, args...)
 	}
 }
 
-// argsToFields преобразует аргументы вида [key1, val1, key2, val2...] в поля zap.Field
+// badKey ключ для значения без пары, как в zap.SugaredLogger
+const badKey = "!BADKEY"
+
+// argsToFields преобразует аргументы вида [key1, val1, key2, val2...] в поля zap.Field.
+// Нестроковый ключ приводится к строке, а непарный последний аргумент пишется под ключом "!BADKEY"
 func argsToFields(args []interface{}) []zap.Field {
-	fields := make([]zap.Field, 0, len(args)/2)
+	if len(args) == 0 {
+		return nil
+	}
+
+	fields := make([]zap.Field, 0, (len(args)+1)/2)
 	for i := 0; i < len(args); i += 2 {
+		// Последний аргумент без значения
+		if i+1 >= len(args) {
+			fields = append(fields, zap.Any(badKey, args[i]))
+			break
+		}
+
 		key, ok := args[i].(string)
 		if !ok {
-			continue // пропускаем если ключ не строка
+			key = fmt.Sprint(args[i])
 		}
 
-		// Преобразуем значение в zap.Field
-		if i+1 < len(args) {
-			fields = append(fields, zap.Any(key, args[i+1]))
-		}
+		fields = append(fields, zap.Any(key, args[i+1]))
 	}
 	return fields
 }
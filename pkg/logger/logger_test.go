@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initFileLogger пишет логи в файл во временном каталоге и возвращает путь к нему
+func initFileLogger(t *testing.T, env string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "auth.log")
+	Init(env, WithFile(FileConfig{Path: path, MaxSizeMB: 1}))
+	t.Cleanup(func() { Close() })
+	return path
+}
+
+// readLog сбрасывает буферы и читает файл логов
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+func TestLevelHandlerEnablesDebug(t *testing.T) {
+	path := initFileLogger(t, "prod")
+
+	Debug("suppressed debug line")
+
+	req := httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"debug"}`))
+	rec := httptest.NewRecorder()
+	LevelHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /loglevel = %d: %s", rec.Code, rec.Body)
+	}
+	if GetLevel() != "debug" {
+		t.Fatalf("GetLevel = %s, want debug", GetLevel())
+	}
+
+	Debug("emitted debug line")
+
+	out := readLog(t, path)
+	if strings.Contains(out, "suppressed debug line") {
+		t.Error("debug line written at info level")
+	}
+	if !strings.Contains(out, "emitted debug line") {
+		t.Errorf("debug line missing after switching to debug:\n%s", out)
+	}
+}
+
+func TestArgsToFields(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want map[string]interface{}
+	}{
+		{"pairs", []interface{}{"method", "GetSession", "count", 2}, map[string]interface{}{"method": "GetSession", "count": float64(2)}},
+		{"odd arity", []interface{}{"method", "GetSession", "dangling"}, map[string]interface{}{"method": "GetSession", badKey: "dangling"}},
+		{"non-string key", []interface{}{42, "answer"}, map[string]interface{}{"42": "answer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := initFileLogger(t, "prod")
+			Info("fields", tt.args...)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(readLog(t, path)), &entry); err != nil {
+				t.Fatalf("log line is not JSON: %v", err)
+			}
+			for key, want := range tt.want {
+				if got, ok := entry[key]; !ok || got != want {
+					t.Errorf("field %s = %v, want %v (entry %v)", key, got, want, entry)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := initFileLogger(t, "prod")
+
+	// MaxSizeMB: 1, пишем с запасом больше мегабайта
+	payload := strings.Repeat("x", 1024)
+	for i := 0; i < 1200; i++ {
+		Info("filler", "payload", payload)
+	}
+	readLog(t, path)
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "auth-*.log"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no rolled log file after writing past the rotation size")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() >= 1<<20 {
+		t.Errorf("active log file is %d bytes, want it rotated below 1MB", info.Size())
+	}
+}
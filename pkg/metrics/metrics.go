@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth_service"
+
+// Metrics собирает Prometheus метрики сервиса
+type Metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	sessionsCreated prometheus.Counter
+	sessionsRevoked prometheus.Counter
+	sessionsDeleted prometheus.Counter
+	checkDuration   *prometheus.HistogramVec
+	rpcDuration     *prometheus.HistogramVec
+}
+
+// Option функция для настройки метрик
+type Option func(*options)
+
+// options настройки набора метрик
+type options struct {
+	rpcBuckets []float64
+}
+
+// WithRPCBuckets задает границы бакетов гистограммы длительности RPC в секундах
+func WithRPCBuckets(buckets ...float64) Option {
+	return func(o *options) {
+		if len(buckets) > 0 {
+			o.rpcBuckets = buckets
+		}
+	}
+}
+
+// New создает набор метрик в отдельном реестре
+func New(opts ...Option) *Metrics {
+	o := options{rpcBuckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		sessionsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sessions_created_total",
+			Help:      "Total number of created sessions.",
+		}),
+		sessionsRevoked: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sessions_revoked_total",
+			Help:      "Total number of revoked sessions.",
+		}),
+		sessionsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sessions_deleted_total",
+			Help:      "Total number of deleted sessions.",
+		}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "health_check_duration_seconds",
+			Help:      "Duration of health checks by check name.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"check"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "Duration of gRPC calls by method and status code.",
+			Buckets:   o.rpcBuckets,
+		}, []string{"method", "code"}),
+	}
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.sessionsCreated,
+		m.sessionsRevoked,
+		m.sessionsDeleted,
+		m.checkDuration,
+		m.rpcDuration,
+	)
+
+	m.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return m
+}
+
+// ServeHTTP отдает метрики в формате Prometheus
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// Registry возвращает реестр для регистрации дополнительных метрик
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// SessionCreated увеличивает счетчик созданных сессий
+func (m *Metrics) SessionCreated() {
+	m.sessionsCreated.Inc()
+}
+
+// SessionsRevoked увеличивает счетчик отозванных сессий на count
+func (m *Metrics) SessionsRevoked(count int) {
+	m.sessionsRevoked.Add(float64(count))
+}
+
+// SessionDeleted увеличивает счетчик удаленных сессий
+func (m *Metrics) SessionDeleted() {
+	m.sessionsDeleted.Inc()
+}
+
+// ObserveCheck записывает длительность health проверки
+func (m *Metrics) ObserveCheck(name string, duration time.Duration) {
+	m.checkDuration.WithLabelValues(name).Observe(duration.Seconds())
+}
+
+// ObserveRPC записывает длительность gRPC вызова
+func (m *Metrics) ObserveRPC(method, code string, duration time.Duration) {
+	m.rpcDuration.WithLabelValues(method, code).Observe(duration.Seconds())
+}